@@ -0,0 +1,253 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// binCountField is the field of a streamed dataset holding the number of
+// rows of the query result counted in the bin of each row.
+const binCountField = "_ashby_count"
+
+// RowAggregation describes how the rows of a streamed dataset are counted
+// into bins as they are read from the datasource, so that only the counts are
+// held in memory however many rows the query returns. Exactly one of
+// Histogram and Heatmap is set.
+type RowAggregation struct {
+	Fields    []string        // fields binned: the values of a histogram series, or the x and y labels of a heatmap table
+	Histogram *BinsDef        // bins of the histogram series reading the dataset
+	Heatmap   *HeatmapBinsDef // bins of the heatmap table reading the dataset
+}
+
+type rowAggregationKey struct{}
+
+// WithRowAggregation returns a context carrying the aggregation of the rows
+// of a dataset query.
+func WithRowAggregation(ctx context.Context, a *RowAggregation) context.Context {
+	return context.WithValue(ctx, rowAggregationKey{}, a)
+}
+
+// RowAggregationFromContext returns the aggregation of the rows of a dataset
+// query carried by ctx, or nil if the rows are to be returned as they are.
+func RowAggregationFromContext(ctx context.Context) *RowAggregation {
+	a, _ := ctx.Value(rowAggregationKey{}).(*RowAggregation)
+	return a
+}
+
+// A rowAggregator counts the rows of a query result into bins as they are
+// read. Its dataset holds a row for each bin with a count, whose binned
+// fields hold the middle of the bin so that counting them again gives the
+// same bins.
+type rowAggregator interface {
+	Add(names []string, vals []any)
+	DataSet() *StaticDataSet
+}
+
+func (a *RowAggregation) aggregator() (rowAggregator, error) {
+	switch {
+	case a.Histogram != nil && len(a.Fields) == 1:
+		l, err := newHistogramLayout(a.Histogram, 0, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &histogramAggregator{field: a.Fields[0], layout: l, counts: make([]float64, l.n+2)}, nil
+	case a.Heatmap != nil && len(a.Fields) == 2:
+		counts := make([][]float64, len(a.Heatmap.YEdges)-1)
+		for i := range counts {
+			counts[i] = make([]float64, len(a.Heatmap.XEdges)-1)
+		}
+		return &heatmapAggregator{x: a.Fields[0], y: a.Fields[1], xEdges: a.Heatmap.XEdges, yEdges: a.Heatmap.YEdges, counts: counts}, nil
+	default:
+		return nil, fmt.Errorf("invalid row aggregation")
+	}
+}
+
+// fieldValue returns the value of the named field of a row, or nil if the row
+// has no such field.
+func fieldValue(names []string, vals []any, name string) any {
+	for i, n := range names {
+		if n == name {
+			return vals[i]
+		}
+	}
+	return nil
+}
+
+// histogramAggregator counts the values of a field into the bins of a
+// histogram series, including the values below and above its range.
+type histogramAggregator struct {
+	field  string
+	layout histogramLayout
+	counts []float64 // counts of the bins from -1 to n, as numbered by bin
+}
+
+func (a *histogramAggregator) Add(names []string, vals []any) {
+	f, ok := numericValue(normalizeValue(fieldValue(names, vals, a.field)))
+	if !ok || nonFinite(f) {
+		return
+	}
+	a.counts[a.layout.bin(f)+1]++
+}
+
+func (a *histogramAggregator) DataSet() *StaticDataSet {
+	data := map[string][]any{a.field: {}, binCountField: {}}
+	for k, c := range a.counts {
+		if c == 0 {
+			continue
+		}
+		data[a.field] = append(data[a.field], a.layout.middle(k-1))
+		data[binCountField] = append(data[binCountField], c)
+	}
+	return NewStaticDataSet(data)
+}
+
+// heatmapAggregator counts the x and y labels of rows into the grid of bins
+// of a heatmap table. Rows outside the grid are not counted.
+type heatmapAggregator struct {
+	x, y           string
+	xEdges, yEdges []float64
+	counts         [][]float64 // counts of the cells of the grid, indexed by y bin then x bin
+}
+
+func (a *heatmapAggregator) Add(names []string, vals []any) {
+	x, xok := numericValue(fieldValue(names, vals, a.x))
+	y, yok := numericValue(fieldValue(names, vals, a.y))
+	if !xok || !yok || math.IsNaN(x) || math.IsNaN(y) {
+		return
+	}
+	xi, yi := binIndex(a.xEdges, x), binIndex(a.yEdges, y)
+	if xi < 0 || yi < 0 {
+		return
+	}
+	a.counts[yi][xi]++
+}
+
+func (a *heatmapAggregator) DataSet() *StaticDataSet {
+	data := map[string][]any{a.x: {}, a.y: {}, binCountField: {}}
+	for yi, row := range a.counts {
+		for xi, c := range row {
+			if c == 0 {
+				continue
+			}
+			data[a.x] = append(data[a.x], (a.xEdges[xi]+a.xEdges[xi+1])/2)
+			data[a.y] = append(data[a.y], (a.yEdges[yi]+a.yEdges[yi+1])/2)
+			data[binCountField] = append(data[binCountField], c)
+		}
+	}
+	return NewStaticDataSet(data)
+}
+
+// rowWeight returns the number of rows of a query result that a row stands
+// for, given the value of its binCountField. Rows of datasets that were not
+// streamed stand for themselves.
+func rowWeight(v any) float64 {
+	if f, ok := numericValue(v); ok {
+		return f
+	}
+	return 1
+}
+
+// countedDataSet reports whether ds holds the bins of a streamed dataset
+// rather than the rows of a query result.
+func countedDataSet(ds DataSet) bool {
+	fields, _ := fieldNames(ds)
+	for _, f := range fields {
+		if f == binCountField {
+			return true
+		}
+	}
+	return false
+}
+
+// rowAggregation returns the aggregation of the rows of the named dataset if
+// it is streamed, or nil if its rows are returned as they are.
+func (pd *PlotDef) rowAggregation(name string) *RowAggregation {
+	var stream bool
+	for _, ds := range pd.Datasets {
+		if ds.Name == name {
+			stream = ds.Stream
+		}
+	}
+	if !stream {
+		return nil
+	}
+	for _, s := range pd.Series {
+		if s.DataSet == name && s.Type == SeriesTypeHistogram {
+			return &RowAggregation{Fields: []string{s.Values}, Histogram: s.Bins}
+		}
+	}
+	for _, t := range pd.Tables {
+		if t.DataSet == name && t.Type == TableTypeHeatmap {
+			return &RowAggregation{Fields: []string{t.LabelsX, t.LabelsY}, Heatmap: t.Bins}
+		}
+	}
+	return nil
+}
+
+// validateStream checks that the streamed dataset ds is read by a single
+// histogram series or heatmap table whose bins are fixed before any rows are
+// read, and by nothing else, since no other part of the plot could see its
+// rows.
+func (pd *PlotDef) validateStream(ds DataSetDef) error {
+	if len(ds.Types) > 0 || len(ds.Columns) > 0 || len(ds.OrderBy) > 0 || ds.Limit > 0 {
+		return fmt.Errorf("a streamed dataset must not have types, columns, orderBy or limit")
+	}
+	if pd.Facet != nil {
+		return fmt.Errorf("a faceted plot may not stream datasets")
+	}
+
+	var readers int
+	for _, s := range pd.Series {
+		if s.DataSet != ds.Name {
+			continue
+		}
+		readers++
+		if s.Type != SeriesTypeHistogram {
+			return fmt.Errorf("a streamed dataset may only be read by a histogram series, not %s series %q", s.Type, s.Name)
+		}
+		if s.GroupField != "" {
+			return fmt.Errorf("histogram series %q of a streamed dataset must not have a groupfield", s.Name)
+		}
+		if s.Bins == nil || s.Bins.Start == nil || s.Bins.End == nil || (s.Bins.Count == 0 && s.Bins.Size == 0) {
+			return fmt.Errorf("histogram series %q of a streamed dataset must give the start, end and nbins or size of its bins", s.Name)
+		}
+	}
+	for _, t := range pd.Tables {
+		if t.DataSet != ds.Name {
+			continue
+		}
+		readers++
+		if t.Type != TableTypeHeatmap || t.Bins == nil {
+			return fmt.Errorf("a streamed dataset may only be read by a heatmap table with bins, not %s table %q", t.Type, t.Name)
+		}
+		if len(t.Bins.XEdges) < 2 || len(t.Bins.YEdges) < 2 {
+			return fmt.Errorf("heatmap table %q of a streamed dataset must give the xEdges and yEdges of its bins", t.Name)
+		}
+		if !sort.Float64sAreSorted(t.Bins.XEdges) || !sort.Float64sAreSorted(t.Bins.YEdges) {
+			return fmt.Errorf("heatmap table %q: bin edges must be in ascending order", t.Name)
+		}
+	}
+	for _, s := range pd.Scalars {
+		if s.DataSet == ds.Name || s.DeltaDataSet == ds.Name {
+			return fmt.Errorf("a streamed dataset may not be read by scalar %q", s.Name)
+		}
+	}
+	for _, jd := range pd.Joins {
+		if jd.Left.DataSet == ds.Name || jd.Right.DataSet == ds.Name {
+			return fmt.Errorf("a streamed dataset may not be joined by %q", jd.Name)
+		}
+	}
+	for _, cds := range pd.Computed {
+		for _, in := range cds.DataSets {
+			if in.DataSet == ds.Name {
+				return fmt.Errorf("a streamed dataset may not be used by computed dataset %q", cds.Name)
+			}
+		}
+	}
+	if readers != 1 {
+		return fmt.Errorf("a streamed dataset must be read by exactly one histogram series or heatmap table, not %d", readers)
+	}
+	return nil
+}
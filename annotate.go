@@ -0,0 +1,132 @@
+package ashby
+
+// AnnotationDef marks a point of a plot with text. Positions may be given
+// as times, numbers or categories and, like the rest of the plot definition,
+// may be template expressions such as '{{ dayModify "-3" .Now | isodate }}'
+// to position the annotation relative to the basis time.
+type AnnotationDef struct {
+	X          any     `yaml:"x"`          // position along the x axis
+	Y          any     `yaml:"y"`          // optional position along the y axis, the annotation is placed at the top of the plot if not specified
+	Text       string  `yaml:"text"`       // text of the annotation, may contain plotly's html subset
+	ShowArrow  *bool   `yaml:"showArrow"`  // if an arrow should point from the text to the position, defaults to true
+	ArrowHead  int64   `yaml:"arrowHead"`  // style of the arrow head, from 0 to 8
+	ArrowColor string  `yaml:"arrowColor"` // color of the arrow
+	AX         float64 `yaml:"ax"`         // horizontal offset in pixels of the text from the position
+	AY         float64 `yaml:"ay"`         // vertical offset in pixels of the text from the position
+	Yaxis      string  `yaml:"yaxis"`      // optional name of the y axis the position refers to, such as y2
+}
+
+// ShapeDef is a reference line drawn across a plot.
+type ShapeDef struct {
+	Type  ShapeType `yaml:"type"`
+	X     any       `yaml:"x"`     // position of a vertical line
+	Y     any       `yaml:"y"`     // position of a horizontal line
+	Color string    `yaml:"color"` // color of the line
+	Dash  string    `yaml:"dash"`  // dash style of the line, such as dot or dash
+	Width float64   `yaml:"width"` // width of the line in pixels
+	Yaxis string    `yaml:"yaxis"` // optional name of the y axis a horizontal line refers to, such as y2
+}
+
+type ShapeType string
+
+const (
+	ShapeTypeVLine ShapeType = "vline" // vertical line spanning the height of the plot
+	ShapeTypeHLine ShapeType = "hline" // horizontal line spanning the width of the plot
+)
+
+func (t ShapeType) String() string { return string(t) }
+
+// PlotAnnotation is the plotly layout annotation produced from an AnnotationDef.
+type PlotAnnotation struct {
+	RefX       string  `json:"xref"`
+	RefY       string  `json:"yref"`
+	X          any     `json:"x"`
+	Y          any     `json:"y"`
+	Text       string  `json:"text"`
+	ShowArrow  bool    `json:"showarrow"`
+	ArrowHead  int64   `json:"arrowhead,omitempty"`
+	ArrowColor string  `json:"arrowcolor,omitempty"`
+	AX         float64 `json:"ax,omitempty"`
+	AY         float64 `json:"ay,omitempty"`
+	XAnchor    string  `json:"xanchor,omitempty"`
+	YAnchor    string  `json:"yanchor,omitempty"`
+}
+
+// PlotShape is the plotly layout shape produced from a ShapeDef.
+type PlotShape struct {
+	Type string        `json:"type"`
+	RefX string        `json:"xref"`
+	RefY string        `json:"yref"`
+	X0   any           `json:"x0"`
+	X1   any           `json:"x1"`
+	Y0   any           `json:"y0"`
+	Y1   any           `json:"y1"`
+	Line PlotShapeLine `json:"line"`
+
+	Fillcolor string  `json:"fillcolor,omitempty"`
+	Opacity   float64 `json:"opacity,omitempty"`
+	Layer     string  `json:"layer,omitempty"`
+}
+
+type PlotShapeLine struct {
+	Color string  `json:"color,omitempty"`
+	Dash  string  `json:"dash,omitempty"`
+	Width float64 `json:"width,omitempty"`
+}
+
+func plotAnnotations(defs []AnnotationDef, cfg *PlotConfig) []any {
+	var annotations []any
+	for _, def := range defs {
+		a := PlotAnnotation{
+			RefX:       "x",
+			RefY:       axisRef(def.Yaxis),
+			X:          normalizeValue(def.X),
+			Y:          normalizeValue(def.Y),
+			Text:       def.Text,
+			ShowArrow:  def.ShowArrow == nil || *def.ShowArrow,
+			ArrowHead:  def.ArrowHead,
+			ArrowColor: cfg.MaybeLookupColor(def.ArrowColor, ""),
+			AX:         def.AX,
+			AY:         def.AY,
+		}
+		if def.Y == nil {
+			a.RefY, a.Y = "paper", 1
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations
+}
+
+func plotShapes(defs []ShapeDef, cfg *PlotConfig) []any {
+	var shapes []any
+	for _, def := range defs {
+		s := PlotShape{
+			Type: "line",
+			Line: PlotShapeLine{
+				Color: cfg.MaybeLookupColor(def.Color, ""),
+				Dash:  def.Dash,
+				Width: def.Width,
+			},
+		}
+		switch def.Type {
+		case ShapeTypeVLine:
+			x := normalizeValue(def.X)
+			s.RefX, s.X0, s.X1 = "x", x, x
+			s.RefY, s.Y0, s.Y1 = "paper", 0, 1
+		case ShapeTypeHLine:
+			y := normalizeValue(def.Y)
+			s.RefX, s.X0, s.X1 = "paper", 0, 1
+			s.RefY, s.Y0, s.Y1 = axisRef(def.Yaxis), y, y
+		}
+		shapes = append(shapes, s)
+	}
+	return shapes
+}
+
+// axisRef returns the plotly reference to a y axis, the primary axis if name is empty.
+func axisRef(name string) string {
+	if name == "" {
+		return "y"
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LoadPlotDef executes the templates of a plot definition and parses it. The
+// name is used to report errors and as the name of the plot if the
+// definition does not give one. Templates are executed with the basis time
+// and template params of cfg, and the defaults of cfg are applied. The plot
+// is generated with the sources and other settings of cfg. It does not read
+// any files, so query files must be loaded with LoadQueryFiles.
+func LoadPlotDef(ctx context.Context, name string, content []byte, cfg *PlotConfig) (*PlotDef, error) {
+	templated, err := ExecuteTemplate(ctx, string(content), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute templates for plot definition %q: %w", name, err)
+	}
+
+	pd, err := parsePlotDef(name, []byte(templated), cfg.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse plot definition %q: %w", name, err)
+	}
+	pd.source = string(content)
+	pd.config = cfg
+	return pd, nil
+}
+
+// GeneratePlot runs the dataset queries of a plot definition loaded with
+// LoadPlotDef as of the basis time at and returns the JSON of the plot, which
+// can be passed to the plotly JavaScript library. The plot definition should
+// have been loaded with the same basis time since it is used by its
+// templates. Nothing is written and the caller decides where the plot goes.
+func GeneratePlot(ctx context.Context, pd *PlotDef, at time.Time) ([]byte, error) {
+	if pd.config == nil {
+		return nil, fmt.Errorf("plot definition %q was not loaded with LoadPlotDef", pd.Name)
+	}
+	cfg := *pd.config
+	cfg.BasisTime = at
+
+	fig, err := generateFig(ctx, pd, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	pd.fig = fig
+
+	data, err := json.Marshal(FigureData{
+		Fig:       fig,
+		Layout:    &pd.Layout,
+		Params:    pd.Parameters,
+		DynLayout: pd.DynLayout,
+		Config:    pd.Config,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal to json: %w", err)
+	}
+	return data, nil
+}
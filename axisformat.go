@@ -0,0 +1,244 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// AxisFormatDef sets how the ticks of an axis are formatted. A tick format
+// is passed to plotly as written, using d3-format for numbers, such as .2f or
+// ~s, and d3-time-format for dates, such as %b %d. A unit picks a format
+// suited to the values instead:
+//
+//   - bytes and bits are shown with SI prefixes, as in 1.2GB, or with IEC
+//     binary prefixes, as in 1.1GiB, if iec is set
+//   - count is shown with a short scale suffix, as in 1.2B
+//   - percent is shown as a percentage of values given as fractions, so that
+//     0.25 is shown as 25%
+type AxisFormatDef struct {
+	TickFormat string   `yaml:"tickformat"` // optional d3 format of the tick labels
+	Unit       AxisUnit `yaml:"unit"`       // optional unit of the values: bytes, bits, count or percent
+	IEC        bool     `yaml:"iec"`        // if bytes or bits should use binary prefixes such as KiB rather than SI prefixes such as KB
+}
+
+type AxisUnit string
+
+const (
+	AxisUnitNone    AxisUnit = ""
+	AxisUnitBytes   AxisUnit = "bytes"
+	AxisUnitBits    AxisUnit = "bits"
+	AxisUnitCount   AxisUnit = "count"
+	AxisUnitPercent AxisUnit = "percent"
+)
+
+func (u AxisUnit) String() string { return string(u) }
+
+// axisFormatAxes are the axes that may be given a format.
+var axisFormatAxes = []string{"x", "y", "y2"}
+
+// iecPrefixes are the binary prefixes of multiples of 1024.
+var iecPrefixes = []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei"}
+
+func (f *AxisFormatDef) validate() error {
+	switch f.Unit {
+	case AxisUnitNone, AxisUnitCount, AxisUnitPercent:
+		if f.IEC {
+			return fmt.Errorf("iec may only be set for bytes or bits")
+		}
+	case AxisUnitBytes, AxisUnitBits:
+		if f.IEC && f.TickFormat != "" {
+			return fmt.Errorf("tickformat cannot be combined with iec prefixes")
+		}
+	default:
+		return fmt.Errorf("unknown axis unit: %q", f.Unit)
+	}
+	return nil
+}
+
+// suffix returns the symbol of the unit shown after each tick label.
+func (f *AxisFormatDef) suffix() string {
+	switch f.Unit {
+	case AxisUnitBytes:
+		return "B"
+	case AxisUnitBits:
+		return "b"
+	default:
+		return ""
+	}
+}
+
+// axisTicks holds the tick settings shared by x and y axes.
+type axisTicks struct {
+	format         string
+	suffix         string
+	exponentformat string
+	vals           []float64
+	text           []string
+}
+
+// ticks returns the tick settings of an axis along which values in the range
+// lo to hi are plotted.
+func (f *AxisFormatDef) ticks(lo, hi float64, ok bool) axisTicks {
+	var t axisTicks
+	switch f.Unit {
+	case AxisUnitBytes, AxisUnitBits:
+		t.suffix = f.suffix()
+		if !f.IEC {
+			t.exponentformat = "SI"
+		} else if ok {
+			t.vals, t.text = iecTicks(lo, hi, t.suffix)
+			t.suffix = ""
+		}
+	case AxisUnitCount:
+		t.exponentformat = "B"
+	case AxisUnitPercent:
+		t.format = "~%"
+	}
+	if f.TickFormat != "" {
+		t.format = f.TickFormat
+	}
+	return t
+}
+
+// iecTicks returns the positions and labels of ticks spanning lo to hi at
+// round multiples of the largest power of 1024 below the larger of them, since
+// plotly can only format numbers with SI prefixes.
+func iecTicks(lo, hi float64, suffix string) ([]float64, []string) {
+	lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	span := math.Max(math.Abs(lo), math.Abs(hi))
+	if span == 0 {
+		return []float64{0}, []string{"0" + suffix}
+	}
+	k := 0
+	for k < len(iecPrefixes)-1 && span >= math.Pow(1024, float64(k+1)) {
+		k++
+	}
+	unit := math.Pow(1024, float64(k))
+
+	// about five ticks at 1, 2 or 5 times a power of ten of the unit
+	raw := (hi - lo) / unit / 5
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 10 * mag
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*mag {
+			step = m * mag
+			break
+		}
+	}
+	decimals := 0
+	if step < 1 {
+		decimals = int(-math.Floor(math.Log10(step)))
+	}
+
+	var vals []float64
+	var text []string
+	for i := math.Floor(lo / unit / step); i <= math.Ceil(hi/unit/step); i++ {
+		v := i * step
+		vals = append(vals, v*unit)
+		text = append(text, strconv.FormatFloat(v, 'f', decimals, 64)+iecPrefixes[k]+suffix)
+	}
+	return vals, text
+}
+
+// axisValueRange returns the smallest and largest numeric values or labels of the
+// series plotted along the axis, reporting false if there are none. The
+// values of stacked series are included as the totals of their stacks.
+func axisValueRange(pd *PlotDef, axis string) (float64, float64, bool) {
+	lo, hi, ok := math.Inf(1), math.Inf(-1), false
+	include := func(f float64) {
+		if !math.IsNaN(f) && !math.IsInf(f, 0) {
+			lo, hi, ok = math.Min(lo, f), math.Max(hi, f), true
+		}
+	}
+
+	// totals of stacked values keyed by stack and label
+	stacked := make(map[[2]string]float64)
+	for _, ps := range pd.plotted {
+		ls := ps.series
+		var vals []any
+		switch axis {
+		case ls.SeriesDef.valueAxis():
+			vals = ls.Values
+		case ls.SeriesDef.labelAxis():
+			vals = ls.Labels
+		}
+		for i, v := range vals {
+			f, isNum := numericValue(v)
+			if !isNum {
+				continue
+			}
+			if ls.SeriesDef.Stack != "" && axis == ls.SeriesDef.valueAxis() && i < len(ls.Labels) {
+				stacked[[2]string{ls.SeriesDef.Stack, stringify(ls.Labels[i])}] += f
+				continue
+			}
+			include(f)
+		}
+	}
+	for _, total := range stacked {
+		include(total)
+	}
+	return lo, hi, ok
+}
+
+// applyAxisFormats sets the tick formats of the axes of the figure. The axes
+// are copied so that axes shared with the defaults of other plots are not
+// changed.
+func applyAxisFormats(fig *grob.Fig, pd *PlotDef) {
+	for _, axis := range axisFormatAxes {
+		def, ok := pd.AxisFormat[axis]
+		if !ok {
+			continue
+		}
+		t := def.ticks(axisValueRange(pd, axis))
+
+		switch axis {
+		case "x":
+			var ax grob.LayoutXaxis
+			if fig.Layout.Xaxis != nil {
+				ax = *fig.Layout.Xaxis
+			}
+			if t.format != "" {
+				ax.Tickformat = t.format
+			}
+			if t.suffix != "" {
+				ax.Ticksuffix = t.suffix
+			}
+			if t.exponentformat != "" {
+				ax.Exponentformat = grob.LayoutXaxisExponentformat(t.exponentformat)
+			}
+			if t.vals != nil {
+				ax.Tickmode, ax.Tickvals, ax.Ticktext = grob.LayoutXaxisTickmodeArray, t.vals, t.text
+			}
+			fig.Layout.Xaxis = &ax
+		case "y", "y2":
+			var ax grob.LayoutYaxis
+			src := fig.Layout.Yaxis
+			if axis == "y2" {
+				src = pd.Layout.Yaxis2
+			}
+			if src != nil {
+				ax = *src
+			}
+			if t.format != "" {
+				ax.Tickformat = t.format
+			}
+			if t.suffix != "" {
+				ax.Ticksuffix = t.suffix
+			}
+			if t.exponentformat != "" {
+				ax.Exponentformat = grob.LayoutYaxisExponentformat(t.exponentformat)
+			}
+			if t.vals != nil {
+				ax.Tickmode, ax.Tickvals, ax.Ticktext = grob.LayoutYaxisTickmodeArray, t.vals, t.text
+			}
+			if axis == "y2" {
+				pd.Layout.Yaxis2 = &ax
+			} else {
+				fig.Layout.Yaxis = &ax
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A Backend stores the files written by an Organizer. Names are paths
+// constructed by the Organizer from its base directory. Each method is given
+// the context of the run, whose cancellation aborts requests in progress.
+type Backend interface {
+	// Write stores data under name, replacing any existing content.
+	Write(ctx context.Context, name string, data []byte) error
+
+	// Read returns the content stored under name.
+	Read(ctx context.Context, name string) ([]byte, error)
+
+	// Stat returns information about name without following symlinks. It
+	// returns an error wrapping fs.ErrNotExist if name does not exist.
+	Stat(ctx context.Context, name string) (fs.FileInfo, error)
+
+	// List returns the names matching the glob pattern, using the syntax of
+	// filepath.Match.
+	List(ctx context.Context, pattern string) ([]string, error)
+
+	// Remove deletes name.
+	Remove(ctx context.Context, name string) error
+
+	// Touch sets the modification time of name to the current time without
+	// changing its content.
+	Touch(ctx context.Context, name string) error
+}
+
+// A SymlinkBackend is a Backend that supports symbolic links.
+type SymlinkBackend interface {
+	Backend
+
+	// Symlink atomically replaces name with a relative symlink to target.
+	Symlink(ctx context.Context, name string, target string) error
+
+	// Readlink returns the destination of the symlink name.
+	Readlink(ctx context.Context, name string) (string, error)
+}
+
+var _ SymlinkBackend = FSBackend{}
+
+// FSBackend is a Backend that stores files on the local filesystem.
+type FSBackend struct{}
+
+func (FSBackend) Write(_ context.Context, name string, data []byte) error {
+	return writeOutput(name, data)
+}
+
+func (FSBackend) Read(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (FSBackend) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (FSBackend) List(_ context.Context, pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (FSBackend) Remove(_ context.Context, name string) error {
+	return os.Remove(name)
+}
+
+func (FSBackend) Touch(_ context.Context, name string) error {
+	now := time.Now()
+	return os.Chtimes(name, now, now)
+}
+
+func (FSBackend) Symlink(_ context.Context, name string, target string) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o775); err != nil {
+		return fmt.Errorf("make directories: %w", err)
+	}
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return fmt.Errorf("relative path: %w", err)
+	}
+
+	tmp := fmt.Sprintf("%s.tmp-%d", name, os.Getpid())
+	os.Remove(tmp) // clear any leftover from an interrupted run
+	if err := os.Symlink(rel, tmp); err != nil {
+		return fmt.Errorf("create symlink: %w", err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename symlink: %w", err)
+	}
+	return nil
+}
+
+func (FSBackend) Readlink(_ context.Context, name string) (string, error) {
+	return os.Readlink(name)
+}
@@ -0,0 +1,104 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// backfillRange is the range of time a backfill generates plots for. It ends
+// at the basis time of the run.
+type backfillRange struct {
+	from time.Time
+}
+
+// basisTimes returns the basis times of the plot definition for each of its
+// periods from the start of the range to end, which are the starts of the
+// periods. It returns false if the plot definition has no frequency with
+// dated periods.
+func (r *backfillRange) basisTimes(pd *PlotDef, end time.Time) ([]time.Time, bool) {
+	if _, ok := datedLayout(pd.Frequency); !ok {
+		return nil, false
+	}
+	var times []time.Time
+	last := pd.expectedBasisTime(end)
+	for t := pd.expectedBasisTime(r.from); !t.After(last); {
+		times = append(times, t)
+		next := pd.Frequency.Truncate(nextPeriod(pd.Frequency, t), pd.location, pd.StartOfWeek())
+		if !next.After(t) {
+			break
+		}
+		t = next
+	}
+	return times, true
+}
+
+// nextPeriod returns a time within the period of the frequency that follows
+// the one starting at t.
+func nextPeriod(f PlotFrequency, t time.Time) time.Time {
+	switch f {
+	case PlotFrequencyHourly:
+		return t.Add(time.Hour)
+	case PlotFrequencyDaily:
+		return t.AddDate(0, 0, 1)
+	case PlotFrequencyWeekly:
+		return t.AddDate(0, 0, 7)
+	case PlotFrequencyMonthly:
+		return t.AddDate(0, 1, 0)
+	case PlotFrequencyYearly:
+		return t.AddDate(1, 0, 0)
+	default:
+		d, _ := f.Interval()
+		return t.Add(d)
+	}
+}
+
+// runPeriods generates the plot of a template variant of the plot definition,
+// or of the plot definition itself if the variant is nil. In a backfill, the
+// plot is generated for each period of the range in turn.
+func (j *plotJob) runPeriods(ctx context.Context, source string, v *PlotVariant, cfg *PlotConfig, out *batchOutput, results *batchResults) []PlotResult {
+	if j.backfill == nil {
+		return []PlotResult{j.runVariant(ctx, source, v, cfg, out, results)}
+	}
+
+	// the frequency and timezone are read from the plot definition as
+	// templated for the end of the range
+	start := j.clock.Now()
+	vcfg := cfg
+	if v != nil {
+		vcfg = v.config(cfg)
+	}
+	templated, err := ExecuteTemplate(ctx, source, vcfg)
+	if err != nil {
+		return []PlotResult{j.failed(ctx, start, nil, fmt.Errorf("failed to execute templates for plot definition %q: %w", j.fname, err))}
+	}
+	pd, err := parsePlotDef(j.fname, []byte(templated), cfg.Defaults)
+	if err != nil {
+		return []PlotResult{j.failed(ctx, start, nil, fmt.Errorf("failed to parse plot definition %q: %w", j.fname, err))}
+	}
+	if !cfg.Selected(pd) {
+		return []PlotResult{j.runVariant(ctx, source, v, cfg, out, results)}
+	}
+	times, ok := j.backfill.basisTimes(pd, cfg.BasisTime)
+	if !ok {
+		pr := PlotResult{PlotDef: j.fname, Name: pd.Name, Outcome: PlotOutcomeSkipped}
+		if v != nil {
+			pr.Variant = v.Name
+		}
+		pr.logger(LoggerFromContext(ctx)).Info("skipping plot, frequency has no periods to backfill", "frequency", pd.Frequency)
+		return []PlotResult{pr}
+	}
+
+	results.Expand(len(times) - 1)
+	prs := make([]PlotResult, 0, len(times))
+	for _, t := range times {
+		pcfg := *cfg
+		pcfg.BasisTime = t
+		pctx := WithLogger(ctx, LoggerFromContext(ctx).With("basis", t.Format(time.RFC3339)))
+		pr := j.runVariant(pctx, source, v, &pcfg, out, results)
+		basis := t
+		pr.BasisTime = &basis
+		prs = append(prs, pr)
+	}
+	return prs
+}
@@ -0,0 +1,148 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestPlotJobsShareOrganizer runs plot jobs concurrently against a single
+// Organizer, as a batch run does for the plots of a profile variant. Several
+// of the plot definitions write to the same output paths so their writes,
+// latest copies and pruning contend for the same files. Run with -race.
+func TestPlotJobsShareOrganizer(t *testing.T) {
+	const plotDefs = 6
+	fsys := fstest.MapFS{}
+	for i := 0; i < plotDefs; i++ {
+		// pairs of plot definitions share a name and so their output paths
+		fsys[fmt.Sprintf("plot%d.yaml", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(`
+name: shared%d
+frequency: daily
+datasets:
+  - name: d
+    source: static
+    query: '{"x": ["a", "b", "c"], "y": [%d, 2, 3]}'
+series:
+  - type: bar
+    dataset: d
+    labels: x
+    values: y
+`, i%3, i))}
+	}
+
+	base := t.TempDir()
+	for _, mode := range []LatestMode{LatestModeCopy, LatestModeSymlink} {
+		t.Run(string(mode), func(t *testing.T) {
+			org := &Organizer{
+				Base:       filepath.Join(base, string(mode)),
+				Template:   "{{ .PlotDefFilename }}.json",
+				Retention:  RetentionPolicy{MaxCount: 2},
+				LatestMode: mode,
+			}
+			out := &batchOutput{Base: org.Base, Backend: FSBackend{}}
+			results := &batchResults{ids: newRequestIDs(), clock: SystemClock}
+			opts := &BatchOptions{Force: true}
+			basis := time.Date(2023, 5, 8, 12, 0, 0, 0, time.UTC)
+
+			var wg sync.WaitGroup
+			for day := 0; day < 4; day++ {
+				for i := 0; i < plotDefs; i++ {
+					cfg := &PlotConfig{
+						BasisTime: basis.AddDate(0, 0, day),
+						Sources:   map[string]DataSource{"static": &StaticDataSource{}},
+						Clock:     SystemClock,
+					}
+					job := &plotJob{fsys: fsys, fname: fmt.Sprintf("plot%d.yaml", i), opts: opts, org: org, req: results.ids.next(), clock: SystemClock}
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for _, pr := range job.run(context.Background(), cfg, out, results) {
+							results.Record(pr)
+						}
+					}()
+				}
+			}
+			wg.Wait()
+
+			if results.failed != 0 {
+				for _, pr := range results.plots {
+					if pr.Outcome == PlotOutcomeFailed {
+						t.Errorf("plot %s failed: %s", pr.PlotDef, pr.Error)
+					}
+				}
+			}
+
+			for i := 0; i < 3; i++ {
+				name := fmt.Sprintf("shared%d.json", i)
+				data, err := os.ReadFile(filepath.Join(org.Base, "latest", name))
+				if err != nil {
+					t.Fatalf("read latest plot: %v", err)
+				}
+				if !json.Valid(data) {
+					t.Errorf("latest plot %s is not valid json", name)
+				}
+
+				dated, err := filepath.Glob(filepath.Join(org.Base, "2023", "05", "*", name))
+				if err != nil {
+					t.Fatalf("glob: %v", err)
+				}
+				if len(dated) > 2 {
+					t.Errorf("got %d dated versions of %s, want at most 2 after pruning: %v", len(dated), name, dated)
+				}
+				for _, path := range dated {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatalf("read dated plot: %v", err)
+					}
+					if !json.Valid(data) {
+						t.Errorf("dated plot %s is not valid json", path)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestBatchProfileFS runs a batch with a profile built in the program whose
+// plot definitions are read from a filesystem rather than a directory on disk.
+func TestBatchProfileFS(t *testing.T) {
+	fsys := fstest.MapFS{"plots/peers.yaml": &fstest.MapFile{Data: []byte(`
+name: peers
+frequency: daily
+datasets:
+  - name: d
+    source: static
+    query: '{"x": ["a", "b"], "y": [1, 2]}'
+series:
+  - type: bar
+    dataset: d
+    labels: x
+    values: y
+`)}}
+	cfg := &PlotConfig{
+		BasisTime: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC),
+		Sources:   map[string]DataSource{"static": &StaticDataSource{}},
+		Profiles:  []*ProcessingProfile{{Source: "plots", FS: fsys, OutTpl: "{{ .PlotDefFilename }}.json"}},
+	}
+	out := t.TempDir()
+	summary, err := Batch(context.Background(), cfg, &BatchOptions{OutDir: out, Concurrency: 1, LatestMode: LatestModeCopy})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if summary.Updated != 1 {
+		t.Errorf("got %d plots updated, want 1", summary.Updated)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "latest", "peers.json"))
+	if err != nil {
+		t.Fatalf("read latest plot: %v", err)
+	}
+	if !json.Valid(data) {
+		t.Errorf("latest plot is not valid json")
+	}
+}
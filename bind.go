@@ -0,0 +1,151 @@
+package ashby
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bound params are template params whose values are passed to dataset
+// queries as driver-level parameters instead of being substituted into the
+// query text. A plot definition lists them in its bind field. When templates
+// are executed, each reference to a bound param, such as {{ .Params.host }},
+// produces a marker in place of the value. Before a query is run the markers
+// are replaced by numbered placeholders ($1, $2, ...) and the values are
+// passed alongside the query. Since the markers are only replaced in queries,
+// bound params should not be used elsewhere in the plot definition.
+
+var (
+	bindNameRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	bindMarkerRe = regexp.MustCompile(`__ashby_bind_([A-Za-z_][A-Za-z0-9_]*)__`)
+)
+
+// bindMarker returns the marker produced in place of the value of the bound
+// param with the name.
+func bindMarker(name string) string {
+	return "__ashby_bind_" + name + "__"
+}
+
+// boundParams returns the names of the bound params listed by the plot
+// definition in source, which are read before it is templated. A source that
+// is only valid YAML once templated has its top-level bind field read on its
+// own, which must then be valid YAML without templating.
+func boundParams(source string) ([]string, error) {
+	var fields struct {
+		Bind []string `yaml:"bind"`
+	}
+	if err := yaml.Unmarshal([]byte(source), &fields); err != nil {
+		if err := yaml.Unmarshal([]byte(bindField(source)), &fields); err != nil {
+			return nil, fmt.Errorf("bind: %w", err)
+		}
+	}
+	for _, name := range fields.Bind {
+		if !bindNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid bound param name: %q", name)
+		}
+	}
+	return fields.Bind, nil
+}
+
+// bindField returns the lines of source holding its top-level bind field,
+// which are the line starting with the key and the indented lines or list
+// items following it, or an empty string if it has none.
+func bindField(source string) string {
+	var (
+		field []string
+		in    bool
+	)
+	for _, line := range strings.Split(source, "\n") {
+		switch {
+		case strings.HasPrefix(line, "bind:"):
+			in = true
+		case in && (line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '-' || line[0] == '#'):
+		default:
+			in = false
+		}
+		if in {
+			field = append(field, line)
+		}
+	}
+	return strings.Join(field, "\n")
+}
+
+// checkBoundParams checks that the templated plot definition lists the same
+// bound params as were read before templating, since params listed only once
+// templated would have had their values substituted into the queries.
+func checkBoundParams(templated string, bound []string) error {
+	var fields struct {
+		Bind []string `yaml:"bind"`
+	}
+	if err := yaml.Unmarshal([]byte(templated), &fields); err != nil {
+		// the error is reported when the plot definition is parsed
+		return nil
+	}
+	if strings.Join(fields.Bind, ",") != strings.Join(bound, ",") {
+		return fmt.Errorf("bound params %v differ from %v listed before templating; the bind field must not be templated", fields.Bind, bound)
+	}
+	return nil
+}
+
+// bindTemplateParams returns a copy of the template params in which the
+// values of the bound params are replaced by their markers.
+func bindTemplateParams(params map[string]any, bound []string) (map[string]any, error) {
+	if len(bound) == 0 {
+		return params, nil
+	}
+	bparams := make(map[string]any, len(params))
+	for k, v := range params {
+		bparams[k] = v
+	}
+	for _, name := range bound {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("bound param %q has no value", name)
+		}
+		bparams[name] = bindMarker(name)
+	}
+	return bparams, nil
+}
+
+// bindQuery replaces the bound param markers in the query with numbered
+// placeholders and returns the values of the params in placeholder order.
+// Each param is given a single placeholder however many times it is used.
+func bindQuery(query string, params map[string]any) (string, []any, error) {
+	var (
+		args    []any
+		err     error
+		indexes = make(map[string]int)
+	)
+	query = bindMarkerRe.ReplaceAllStringFunc(query, func(marker string) string {
+		name := bindMarkerRe.FindStringSubmatch(marker)[1]
+		n, ok := indexes[name]
+		if !ok {
+			v, exists := params[name]
+			if !exists && err == nil {
+				err = fmt.Errorf("bound param %q has no value", name)
+			}
+			args = append(args, v)
+			n = len(args)
+			indexes[name] = n
+		}
+		return "$" + strconv.Itoa(n)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return query, args, nil
+}
+
+// A ParamBinder is a DataSource whose queries may refer to parameter values
+// passed with the query using numbered placeholders, starting at $1.
+type ParamBinder interface {
+	BindsParams() bool
+}
+
+// bindsParams reports whether the datasource accepts bound parameters.
+func bindsParams(src DataSource) bool {
+	b, ok := src.(ParamBinder)
+	return ok && b.BindsParams()
+}
@@ -0,0 +1,85 @@
+package ashby
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBoundParamsTemplatedSource(t *testing.T) {
+	// the source is only valid YAML once templated
+	source := `name: visits
+bind:
+  - host
+{{- if .Params.daily }}
+frequency: daily
+{{- end }}
+datasets:
+  - name: d
+    source: pg
+    query: select count(*) from visits where host = {{ .Params.host }}
+`
+	bound, err := boundParams(source)
+	if err != nil {
+		t.Fatalf("bound params: %v", err)
+	}
+	if len(bound) != 1 || bound[0] != "host" {
+		t.Errorf("got bound params %v, want [host]", bound)
+	}
+
+	cfg := &PlotConfig{BasisTime: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC), TemplateParams: map[string]any{"host": "x' or '1'='1", "daily": true}}
+	templated, err := ExecuteTemplate(context.Background(), source, cfg)
+	if err != nil {
+		t.Fatalf("execute template: %v", err)
+	}
+	if strings.Contains(templated, "x' or") || !strings.Contains(templated, bindMarker("host")) {
+		t.Errorf("got templated source %q, want the marker of the bound param in place of its value", templated)
+	}
+}
+
+func TestBoundParamsInvalid(t *testing.T) {
+	for name, source := range map[string]string{
+		"malformed field":  "bind: [host\n{{ if true }}\nname: x\n",
+		"templated field":  "bind: {{ .Params.names }}\n",
+		"invalid name":     "bind: [\"host; drop\"]\n",
+		"field not a list": "{{ if true }}\nbind: host: x\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if bound, err := boundParams(source); err == nil {
+				t.Errorf("got bound params %v, want an error", bound)
+			}
+		})
+	}
+}
+
+func TestBoundParamsNotTemplated(t *testing.T) {
+	cfg := &PlotConfig{TemplateParams: map[string]any{"names": "[host]", "host": "example.com"}}
+	_, err := ExecuteTemplate(context.Background(), "{{ if true }}\nbind: {{ .Params.names }}\n{{ end }}\n", cfg)
+	if err == nil {
+		t.Errorf("templated a source whose bind field is only present once templated, want an error")
+	}
+}
+
+func TestBoundParamsQueryFile(t *testing.T) {
+	pd, err := parsePlotDef("visits", []byte(`
+name: visits
+bind: [host]
+datasets:
+  - name: d
+    source: pg
+    queryFile: visits.sql
+`), nil)
+	if err != nil {
+		t.Fatalf("parse plot definition: %v", err)
+	}
+	fsys := fstest.MapFS{"visits.sql": &fstest.MapFile{Data: []byte("select count(*) from visits where host = {{ .Params.host }}")}}
+	cfg := &PlotConfig{TemplateParams: map[string]any{"host": "example.com"}}
+	if err := pd.LoadQueryFiles(context.Background(), fsys, cfg); err != nil {
+		t.Fatalf("load query files: %v", err)
+	}
+	if want := "select count(*) from visits where host = " + bindMarker("host"); pd.Datasets[0].Query != want {
+		t.Errorf("got query %q, want %q", pd.Datasets[0].Query, want)
+	}
+}
@@ -0,0 +1,212 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	// concrete types that may be held in cached datasets
+	gob.Register(time.Time{})
+	gob.Register(pgtype.Interval{})
+}
+
+// A Cache stores the data of query results.
+type Cache interface {
+	// Get returns the data stored under key, reporting false if there is no
+	// data or it has expired.
+	Get(key string) (map[string][]any, bool)
+
+	// Put stores data under key.
+	Put(key string, data map[string][]any) error
+}
+
+var _ Cache = (*DiskCache)(nil)
+
+// DiskCache is a Cache that stores each entry as a file in a directory.
+// Entries expire TTL after they were written.
+type DiskCache struct {
+	Dir   string
+	TTL   time.Duration
+	Clock Clock // tells the current time that entries expire by, defaults to the system clock
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".gob")
+}
+
+func (c *DiskCache) Get(key string) (map[string][]any, bool) {
+	fname := c.path(key)
+	info, err := os.Stat(fname)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to stat cache entry", "filename", fname, "error", err)
+		}
+		return nil, false
+	}
+	if c.TTL > 0 && clockOrSystem(c.Clock).Now().Sub(info.ModTime()) > c.TTL {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		slog.Warn("failed to read cache entry", "filename", fname, "error", err)
+		return nil, false
+	}
+
+	var data map[string][]any
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		slog.Warn("failed to decode cache entry", "filename", fname, "error", err)
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *DiskCache) Put(key string, data map[string][]any) error {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(data); err != nil {
+		return fmt.Errorf("encode cache entry: %w", err)
+	}
+	return writeOutput(c.path(key), buf.Bytes())
+}
+
+var _ Cache = (*MemoryCache)(nil)
+
+// MemoryCache is a Cache that holds entries in memory for the lifetime of
+// the process.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]map[string][]any
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]map[string][]any)}
+}
+
+func (c *MemoryCache) Get(key string) (map[string][]any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.entries[key]
+	return data, ok
+}
+
+func (c *MemoryCache) Put(key string, data map[string][]any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = data
+	return nil
+}
+
+var _ DataSource = (*CachingDataSource)(nil)
+
+// CachingDataSource is a DataSource that returns cached results for queries
+// it has seen before, falling back to an underlying DataSource. Results are
+// keyed on the name of the datasource, the query text and the time window of
+// the plot the query is run for, as well as the basis time itself for
+// datasources whose results depend on it.
+type CachingDataSource struct {
+	Name   string
+	Source DataSource
+	Cache  Cache
+}
+
+func NewCachingDataSource(name string, src DataSource, cache Cache) *CachingDataSource {
+	return &CachingDataSource{
+		Name:   name,
+		Source: src,
+		Cache:  cache,
+	}
+}
+
+func (c *CachingDataSource) GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error) {
+	key := c.key(ctx, query, params)
+	if data, ok := c.Cache.Get(key); ok {
+		LoggerFromContext(ctx).Info("using cached query result", "source", c.Name, "key", key)
+		return NewStaticDataSet(data), nil
+	}
+
+	ds, err := c.Source.GetDataSet(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	sds, ok := ds.(*StaticDataSet)
+	if !ok {
+		return ds, nil
+	}
+	if err := c.Cache.Put(key, sds.Data); err != nil {
+		LoggerFromContext(ctx).Warn("failed to cache query result", "source", c.Name, "error", err)
+	}
+	return ds, nil
+}
+
+func (c *CachingDataSource) key(ctx context.Context, query string, params []any) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%v\x00", c.Name, query, params)
+	// settings made by setup statements may change the result of the query
+	for _, stmt := range SetupFromContext(ctx) {
+		fmt.Fprintf(h, "%s\x00", stmt)
+	}
+	// the rows of a streamed dataset are returned as the counts of its bins
+	if a := RowAggregationFromContext(ctx); a != nil {
+		agg, _ := json.Marshal(a)
+		fmt.Fprintf(h, "%s\x00", agg)
+	}
+	// plots without a known frequency have no time window, so any
+	// dependence on the basis time must come through the query text or
+	// the datasource reading it
+	if b, ok := QueryBasisFromContext(ctx); ok {
+		if _, known := datedLayout(b.Frequency); known {
+			window := b.Frequency.Truncate(b.Time, b.Location, b.WeekStart)
+			fmt.Fprintf(h, "%s\x00%s\x00", b.Frequency, window.UTC().Format(time.RFC3339Nano))
+		}
+		if readsBasisTime(c.Source) {
+			fmt.Fprintf(h, "%s\x00", b.Time.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReadsBasisTime reports whether the results of the underlying DataSource
+// depend on the basis time.
+func (c *CachingDataSource) ReadsBasisTime() bool {
+	return readsBasisTime(c.Source)
+}
+
+// BindsParams reports whether the underlying DataSource accepts bound
+// parameters.
+func (c *CachingDataSource) BindsParams() bool {
+	return bindsParams(c.Source)
+}
+
+// RunsSetup reports whether the underlying DataSource runs setup statements.
+func (c *CachingDataSource) RunsSetup() bool {
+	return runsSetup(c.Source)
+}
+
+// Close closes the underlying DataSource if it holds open connections.
+func (c *CachingDataSource) Close() error {
+	if cl, ok := c.Source.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+func (c *CachingDataSource) IsTransient(err error) bool {
+	return transientClassifier(c.Source)(err)
+}
@@ -0,0 +1,57 @@
+package ashby
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// basisTimeSource is a DataSource that reports whether its results depend on
+// the basis time of the query.
+type basisTimeSource struct {
+	StaticDataSource
+	reads bool
+}
+
+func (s *basisTimeSource) ReadsBasisTime() bool { return s.reads }
+
+func TestCachingDataSourceKeyBasisTime(t *testing.T) {
+	morning := time.Date(2023, 5, 8, 9, 0, 0, 0, time.UTC)
+	evening := time.Date(2023, 5, 8, 18, 0, 0, 0, time.UTC)
+	keys := func(reads bool) (string, string) {
+		c := NewCachingDataSource("src", &basisTimeSource{reads: reads}, NewMemoryCache())
+		at := func(tm time.Time) context.Context {
+			return WithQueryBasis(context.Background(), QueryBasis{Time: tm, Frequency: PlotFrequencyDaily})
+		}
+		return c.key(at(morning), "up", nil), c.key(at(evening), "up", nil)
+	}
+
+	if a, b := keys(false); a != b {
+		t.Errorf("got different keys for basis times in the same period of a datasource not reading them")
+	}
+	if a, b := keys(true); a == b {
+		t.Errorf("got the same key for different basis times of a datasource reading them")
+	}
+}
+
+func TestDiskCacheTTL(t *testing.T) {
+	dir := t.TempDir()
+	written := time.Now()
+	c := &DiskCache{Dir: dir, TTL: time.Hour, Clock: FixedClock(written)}
+	if err := c.Put("k", map[string][]any{"x": {1.0}}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := os.Chtimes(c.path("k"), written, written); err != nil {
+		t.Fatalf("set mtime: %v", err)
+	}
+
+	c.Clock = FixedClock(written.Add(30 * time.Minute))
+	if _, ok := c.Get("k"); !ok {
+		t.Errorf("got no entry before the ttl elapsed")
+	}
+	c.Clock = FixedClock(written.Add(2 * time.Hour))
+	if _, ok := c.Get("k"); ok {
+		t.Errorf("got an entry after the ttl elapsed")
+	}
+}
@@ -0,0 +1,129 @@
+package ashby
+
+import (
+	"fmt"
+	"strings"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+	"golang.org/x/exp/slog"
+)
+
+// CategoryOrderDef orders the categories of a categorical axis. The order is
+// one of the plotly category orders: trace, which keeps the order of the
+// data, category ascending or descending, which sorts the names of the
+// categories, total, min, max, sum, mean or median followed by ascending or
+// descending, which sort the categories by their values, or array, which
+// uses an explicit list of categories. Categories of the data that are not
+// listed follow those that are.
+type CategoryOrderDef struct {
+	Order      string   `yaml:"order"`      // the order of the categories, defaults to array if categories are listed
+	Categories []string `yaml:"categories"` // the categories of an array order, in the order they are shown
+}
+
+// categoryOrderAxes are the axes that may be given a category order.
+var categoryOrderAxes = []string{"x", "y"}
+
+// categoryOrderAggregates are the aggregates of values that categories may be
+// sorted by.
+var categoryOrderAggregates = map[string]bool{"total": true, "min": true, "max": true, "sum": true, "mean": true, "median": true}
+
+// order returns the plotly category order.
+func (c *CategoryOrderDef) order() string {
+	if c.Order == "" && len(c.Categories) > 0 {
+		return "array"
+	}
+	return c.Order
+}
+
+func (c *CategoryOrderDef) validate() error {
+	order := c.order()
+	switch order {
+	case "trace", "category ascending", "category descending":
+	case "array":
+		if len(c.Categories) == 0 {
+			return fmt.Errorf("array category order requires a list of categories")
+		}
+		return nil
+	default:
+		agg, dir, _ := strings.Cut(order, " ")
+		if !categoryOrderAggregates[agg] || dir != "ascending" && dir != "descending" {
+			return fmt.Errorf("unknown category order: %q", c.Order)
+		}
+	}
+	if len(c.Categories) > 0 {
+		return fmt.Errorf("categories may only be listed for an array category order")
+	}
+	return nil
+}
+
+// applyCategoryOrders sets the category order of the axes of the figure. The
+// categories of an array order that do not appear in the labels of any
+// series plotted along the axis are reported since they are usually
+// misspelled. The axes are copied so that axes shared with the defaults of
+// other plots are not changed.
+func applyCategoryOrders(fig *grob.Fig, pd *PlotDef, logger *slog.Logger) {
+	for _, axis := range categoryOrderAxes {
+		def, ok := pd.CategoryOrder[axis]
+		if !ok {
+			continue
+		}
+		order := def.order()
+		var categories any
+		if order == "array" {
+			categories = def.Categories
+			for _, c := range unknownCategories(pd, axis, def.Categories) {
+				logger.Warn("category listed in category order does not appear in the data", "axis", axis, "category", c)
+			}
+		}
+
+		switch axis {
+		case "x":
+			var ax grob.LayoutXaxis
+			if fig.Layout.Xaxis != nil {
+				ax = *fig.Layout.Xaxis
+			}
+			ax.Categoryorder = grob.LayoutXaxisCategoryorder(order)
+			ax.Categoryarray = categories
+			fig.Layout.Xaxis = &ax
+		case "y":
+			var ax grob.LayoutYaxis
+			if fig.Layout.Yaxis != nil {
+				ax = *fig.Layout.Yaxis
+			}
+			ax.Categoryorder = grob.LayoutYaxisCategoryorder(order)
+			ax.Categoryarray = categories
+			fig.Layout.Yaxis = &ax
+		}
+	}
+}
+
+// unknownCategories returns the categories that are not labels of the series
+// plotted along the axis, or none if no series is plotted along it.
+func unknownCategories(pd *PlotDef, axis string, categories []string) []string {
+	labels := make(map[string]bool)
+	plotted := false
+	for _, ps := range pd.plotted {
+		labelAxis := "x"
+		if ps.series.SeriesDef.horizontal() {
+			labelAxis = "y"
+		}
+		if labelAxis != axis {
+			continue
+		}
+		plotted = true
+		for _, l := range ps.series.Labels {
+			labels[stringify(l)] = true
+		}
+	}
+	if !plotted {
+		return nil
+	}
+
+	var unknown []string
+	for _, c := range categories {
+		if !labels[c] {
+			unknown = append(unknown, c)
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,46 @@
+package ashby
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Clock tells the current time. The batch runner and Organizer take the
+// times they record and derive from the current time from a Clock so that it
+// can be fixed, making their output reproducible.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock that tells the time of the system clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FixedClock is a Clock that always tells the same time.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// clockOrSystem returns c, or the system clock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// ParseClock returns a clock fixed at the RFC3339 time s, or the system clock
+// if s is empty.
+func ParseClock(s string) (Clock, error) {
+	if s == "" {
+		return SystemClock, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current time: %w", err)
+	}
+	return FixedClock(t), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var backfillCommand = &cli.Command{
+	Name:   "backfill",
+	Usage:  "Generate the versioned plots of a group of plot definitions for each period of a past range of time",
+	Action: Backfill,
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:        "from",
+			Required:    true,
+			Usage:       "Start of the range of time to generate plots for, in RFC3339 or 2006-01-02 format. The period of each plot's frequency that contains it is the first generated.",
+			Destination: &backfillOpts.from,
+			EnvVars:     []string{envPrefix + "FROM"},
+		},
+		&cli.StringFlag{
+			Name:        "to",
+			Required:    false,
+			Usage:       "End of the range of time to generate plots for, in RFC3339 or 2006-01-02 format. The period of each plot's frequency that contains it is the last generated. Defaults to the current time.",
+			Destination: &backfillOpts.to,
+			EnvVars:     []string{envPrefix + "TO"},
+		},
+	}, batchFlagsExcept("basis")...),
+}
+
+var backfillOpts struct {
+	from string
+	to   string
+}
+
+// Backfill generates the plots of a batch run for each period from the start
+// of the range up to its end, which is used as the basis time of the run.
+// Plots are written to the versioned paths of their periods, so that existing
+// plots are skipped unless forced, as in a batch run.
+func Backfill(cc *cli.Context) error {
+	if !batchOpts.version {
+		return fmt.Errorf("backfill requires versioned output")
+	}
+
+	from, err := parseBackfillTime(backfillOpts.from)
+	if err != nil {
+		return fmt.Errorf("invalid start of range: %w", err)
+	}
+	batchOpts.basis = "now"
+	if backfillOpts.to != "" {
+		to, err := parseBackfillTime(backfillOpts.to)
+		if err != nil {
+			return fmt.Errorf("invalid end of range: %w", err)
+		}
+		if to.Before(from) {
+			return fmt.Errorf("end of range is before its start: %s", backfillOpts.to)
+		}
+		batchOpts.basis = to.Format(time.RFC3339)
+	}
+	batchOpts.backfillFrom = from
+
+	return Batch(cc)
+}
+
+// parseBackfillTime parses a time given in RFC3339 format or as a date, which
+// is taken to be midnight UTC.
+func parseBackfillTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
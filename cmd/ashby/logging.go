@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iand/pontium/hlog"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slog"
+)
+
+var loggingFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:        "verbose",
+		Aliases:     []string{"v"},
+		EnvVars:     []string{envPrefix + "VERBOSE"},
+		Usage:       "Set logging level more verbose to include info level logs",
+		Value:       true,
+		Destination: &loggingOpts.Verbose,
+	},
+
+	&cli.BoolFlag{
+		Name:        "veryverbose",
+		EnvVars:     []string{envPrefix + "VERYVERBOSE"},
+		Aliases:     []string{"vv"},
+		Usage:       "Set logging level more verbose to include debug level logs",
+		Destination: &loggingOpts.VeryVerbose,
+	},
+	&cli.BoolFlag{
+		Name:        "hlog",
+		EnvVars:     []string{envPrefix + "HLOG"},
+		Usage:       "Use human friendly log output",
+		Value:       true,
+		Destination: &loggingOpts.Hlog,
+	},
+	&cli.StringFlag{
+		Name:        "log-level",
+		EnvVars:     []string{envPrefix + "LOG_LEVEL"},
+		Usage:       "Set the logging level to one of debug, info, warn or error, overriding --verbose and --veryverbose. Debug logs include the text and timing of queries.",
+		Destination: &loggingOpts.Level,
+	},
+	&cli.StringFlag{
+		Name:        "log-format",
+		EnvVars:     []string{envPrefix + "LOG_FORMAT"},
+		Usage:       "Set the format of log output to text or json, overriding --hlog",
+		Destination: &loggingOpts.Format,
+	},
+}
+
+var loggingOpts struct {
+	Verbose     bool
+	VeryVerbose bool
+	Hlog        bool
+	Level       string // overrides Verbose and VeryVerbose if not empty
+	Format      string // overrides Hlog if not empty
+}
+
+func setupLogging() error {
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(slog.LevelWarn)
+	if loggingOpts.Verbose {
+		logLevel.Set(slog.LevelInfo)
+	}
+	if loggingOpts.VeryVerbose {
+		logLevel.Set(slog.LevelDebug)
+	}
+	switch strings.ToLower(loggingOpts.Level) {
+	case "":
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		return fmt.Errorf("unsupported log level: %q", loggingOpts.Level)
+	}
+
+	human := loggingOpts.Hlog
+	switch strings.ToLower(loggingOpts.Format) {
+	case "":
+	case "text":
+		human = true
+	case "json":
+		human = false
+	default:
+		return fmt.Errorf("unsupported log format: %q", loggingOpts.Format)
+	}
+
+	var h slog.Handler
+	if human {
+		h = new(hlog.Handler).WithLevel(logLevel.Level())
+	} else {
+		h = (slog.HandlerOptions{
+			Level: logLevel,
+		}).NewJSONHandler(os.Stdout)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	appName   = "ashby"
+	envPrefix = "ASHBY_"
+)
+
+func main() {
+	app := &cli.App{
+		Name:     appName,
+		HelpName: appName,
+		Usage:    "Plot server",
+		Commands: []*cli.Command{
+			plotCommand,
+			batchCommand,
+			backfillCommand,
+			verifyCommand,
+			validateCommand,
+		},
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:        "shutdown-timeout",
+				EnvVars:     []string{envPrefix + "SHUTDOWN_TIMEOUT"},
+				Usage:       "Maximum time in-flight work may take to finish after an interrupt before ashby exits anyway. Zero waits until it finishes.",
+				Value:       30 * time.Second,
+				Destination: &shutdownTimeout,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.Before = func(*cli.Context) error {
+		handleSignals(cancel)
+		return nil
+	}
+
+	err := app.RunContext(ctx, os.Args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+	}
+	if interrupted.Load() {
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
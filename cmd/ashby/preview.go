@@ -2,19 +2,14 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"html/template"
 
 	"github.com/pkg/browser"
 )
 
-func preview(fig FigureData) error {
-	figBytes, err := json.Marshal(fig)
-	if err != nil {
-		return fmt.Errorf("marshal fig: %w", err)
-	}
-
+// preview opens a page showing the plot with the JSON data in a browser.
+func preview(figBytes []byte) error {
 	tmpl, err := template.New("plotly").Parse(baseHtml)
 	if err != nil {
 		return fmt.Errorf("parse plotly html: %w", err)
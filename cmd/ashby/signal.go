@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// exitInterrupted is the exit code of a run that was interrupted by a
+// signal, following the shell convention for SIGINT.
+const exitInterrupted = 130
+
+// shutdownTimeout is how long in-flight work may take to finish after the
+// first interrupt before the process exits anyway.
+var shutdownTimeout time.Duration
+
+// interrupted is set once the run has been interrupted by a signal.
+var interrupted atomic.Bool
+
+// handleSignals cancels the run when the process receives SIGINT or SIGTERM
+// so that queries are aborted and no further plots are started, while plots
+// that are being written are finished, since their files are replaced
+// atomically. A second signal, or in-flight work outliving shutdownTimeout,
+// exits the process immediately.
+func handleSignals(cancel context.CancelFunc) {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		interrupted.Store(true)
+		slog.Warn("interrupted, finishing in-flight work, interrupt again to exit immediately", "signal", sig.String(), "timeout", shutdownTimeout)
+		cancel()
+
+		var timeout <-chan time.Time
+		if shutdownTimeout > 0 {
+			timeout = time.After(shutdownTimeout)
+		}
+		select {
+		case sig = <-ch:
+			fmt.Fprintf(os.Stderr, "exiting immediately after second %s\n", sig)
+		case <-timeout:
+			fmt.Fprintf(os.Stderr, "exiting after in-flight work did not finish within %s\n", shutdownTimeout)
+		}
+		os.Exit(exitInterrupted)
+	}()
+}
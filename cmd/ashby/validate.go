@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/plprobelab/ashby"
+	"github.com/urfave/cli/v2"
+)
+
+var validateCommand = &cli.Command{
+	Name:      "validate",
+	Usage:     "Check plot definitions for problems without running any queries",
+	ArgsUsage: "<file or directory>...",
+	Action:    Validate,
+	Flags: append([]cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "params",
+			Aliases:     []string{"p"},
+			Required:    false,
+			Usage:       "Specify templating parameters, in the format key=value. May be repeated to specify multiple parameters.",
+			Destination: &validateOpts.params,
+		},
+		&cli.StringFlag{
+			Name:        "conf",
+			Required:    false,
+			Usage:       "Path of directory containing configuration, which may define defaults for plot definitions.",
+			Destination: &validateOpts.confDir,
+		},
+		&cli.StringFlag{
+			Name:        "match",
+			Required:    false,
+			Value:       "*.yaml",
+			Usage:       "Glob used to find plot definitions in directories.",
+			Destination: &validateOpts.match,
+		},
+		&cli.StringFlag{
+			Name:        "now",
+			Required:    false,
+			Usage:       "Time in RFC3339 format to use as the current time and basis time when templating plot definitions. Defaults to the system clock.",
+			Destination: &validateOpts.now,
+		},
+	}, loggingFlags...),
+}
+
+var validateOpts struct {
+	params  cli.StringSlice
+	confDir string
+	match   string
+	now     string
+}
+
+func Validate(cc *cli.Context) error {
+	ctx := cc.Context
+	if err := setupLogging(); err != nil {
+		return err
+	}
+
+	if cc.NArg() == 0 {
+		return fmt.Errorf("no plot definitions specified")
+	}
+
+	clock, err := ashby.ParseClock(validateOpts.now)
+	if err != nil {
+		return err
+	}
+	cfg := &ashby.PlotConfig{
+		BasisTime:      clock.Now().UTC(),
+		Clock:          clock,
+		TemplateParams: map[string]any{},
+	}
+	for _, param := range validateOpts.params.Value() {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return fmt.Errorf("params option not valid, use format 'key=value'")
+		}
+		if _, exists := cfg.TemplateParams[key]; exists {
+			return fmt.Errorf("duplicate template parameter %q specified", key)
+		}
+		cfg.TemplateParams[key] = value
+	}
+
+	if validateOpts.confDir != "" {
+		defaults, err := ashby.LoadDefaults(os.DirFS(validateOpts.confDir))
+		if err != nil {
+			return err
+		}
+		cfg.Defaults = defaults
+	}
+
+	var fnames []string
+	for _, arg := range cc.Args().Slice() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return fmt.Errorf("stat plot definition: %w", err)
+		}
+		if !info.IsDir() {
+			fnames = append(fnames, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, validateOpts.match))
+		if err != nil {
+			return fmt.Errorf("find plot definitions: %w", err)
+		}
+		fnames = append(fnames, matches...)
+	}
+	sort.Strings(fnames)
+
+	var errored, warned int
+	for _, fname := range fnames {
+		problems := ashby.ValidatePlotDefFile(ctx, fname, cfg)
+		hasError := false
+		for _, p := range problems {
+			fmt.Println(p)
+			if !p.Warning {
+				hasError = true
+			}
+		}
+		if hasError {
+			errored++
+		} else if len(problems) > 0 {
+			warned++
+		}
+	}
+
+	fmt.Printf("%d plot definitions checked, %d with errors, %d with warnings\n", len(fnames), errored, warned)
+	if errored > 0 {
+		return fmt.Errorf("%d plot definitions are not valid", errored)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "github.com/urfave/cli/v2"
+
+var verifyCommand = &cli.Command{
+	Name:   "verify",
+	Usage:  "Verify that the latest copy of each plot of a group of plot definitions is its newest dated plot",
+	Action: Verify,
+	Flags: append([]cli.Flag{
+		&cli.BoolFlag{
+			Name:        "repair",
+			Required:    false,
+			Usage:       "Replace the latest copies that are not the newest dated plot with it, rather than reporting them as failures.",
+			Destination: &verifyOpts.repair,
+			EnvVars:     []string{envPrefix + "REPAIR"},
+		},
+	}, batchFlagsExcept("basis", "version")...),
+}
+
+var verifyOpts struct {
+	repair bool
+}
+
+// Verify checks the latest copies of the plots of a batch run without
+// generating them. The run fails if any latest copy is not the newest dated
+// plot, unless it is repaired.
+func Verify(cc *cli.Context) error {
+	batchOpts.verify = true
+	batchOpts.basis = "now"
+	return Batch(cc)
+}
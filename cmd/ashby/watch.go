@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/slog"
+)
+
+// A fileWatcher calls a function with the files changed in the directories
+// it watches. Changes made in quick succession, such as by an editor saving a
+// file in several steps, are collected into a single call once no further
+// changes are made for the debounce interval.
+//
+// Directories are watched rather than files so that changes are still seen
+// when an editor replaces a file on save, and so that new files are seen.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	dirs    map[string]bool // absolute paths of the directories watched
+}
+
+func newFileWatcher() (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("new watcher: %w", err)
+	}
+	return &fileWatcher{watcher: watcher, dirs: make(map[string]bool)}, nil
+}
+
+// WatchFile watches the directory of the file.
+func (w *fileWatcher) WatchFile(fname string) error {
+	return w.WatchDir(filepath.Dir(fname))
+}
+
+// WatchDir watches the directory, if it is not already watched.
+func (w *fileWatcher) WatchDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("absolute path: %w", err)
+	}
+	if w.dirs[abs] {
+		return nil
+	}
+	if err := w.watcher.Add(abs); err != nil {
+		return fmt.Errorf("watch directory: %w", err)
+	}
+	w.dirs[abs] = true
+	return nil
+}
+
+func (w *fileWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// Run calls fn with the absolute paths of the files changed in the watched
+// directories until the context is cancelled.
+func (w *fileWatcher) Run(ctx context.Context, debounce time.Duration, fn func(changed map[string]bool)) error {
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	changed := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			slog.Debug("file changed", "filename", ev.Name, "op", ev.Op.String())
+			changed[filepath.Clean(ev.Name)] = true
+			timer.Reset(debounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("error watching files", "error", err)
+		case <-timer.C:
+			fn(changed)
+			changed = make(map[string]bool)
+		}
+	}
+}
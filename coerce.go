@@ -0,0 +1,194 @@
+package ashby
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeDef gives the type that the values of a field of a dataset are
+// converted to after it is fetched, for sources that return numbers as
+// strings, such as Postgres money or BigQuery NUMERIC columns, which would
+// otherwise be plotted as categories. Null values and empty strings are left
+// as nulls.
+type TypeDef struct {
+	Field  string     `yaml:"field"`  // the name of the field to convert
+	Type   ColumnType `yaml:"type"`   // number, integer, string or time
+	Layout string     `yaml:"layout"` // optional Go time layout used to parse the values of a time field, defaults to RFC3339 or a date
+}
+
+type ColumnType string
+
+const (
+	ColumnTypeNumber  ColumnType = "number"  // a floating point number
+	ColumnTypeInteger ColumnType = "integer" // a whole number
+	ColumnTypeString  ColumnType = "string"  // the string form of the value
+	ColumnTypeTime    ColumnType = "time"    // a time, parsed using the layout
+)
+
+func (t ColumnType) String() string { return string(t) }
+
+// timeLayouts are the layouts tried in turn when parsing a time field
+// without a layout.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// validate checks that the type definition names a field and a known type.
+func (d *TypeDef) validate() error {
+	if d.Field == "" {
+		return fmt.Errorf("type must name a field")
+	}
+	switch d.Type {
+	case ColumnTypeNumber, ColumnTypeInteger, ColumnTypeString:
+		if d.Layout != "" {
+			return fmt.Errorf("layout of field %q may only be given for the time type", d.Field)
+		}
+	case ColumnTypeTime:
+	default:
+		return fmt.Errorf("unknown type of field %q: %q", d.Field, d.Type)
+	}
+	return nil
+}
+
+// coerceDataSet returns the rows of ds with the values of the fields given by
+// types converted to their types. It fails on the first value that cannot be
+// converted, reporting its field, the value and the index of its row, which
+// starts at zero.
+func coerceDataSet(ds DataSet, types []TypeDef) (DataSet, error) {
+	fields, ok := fieldNames(ds)
+	if !ok {
+		return nil, fmt.Errorf("dataset does not list its fields")
+	}
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+	byField := make(map[string]TypeDef, len(types))
+	for _, td := range types {
+		if !known[td.Field] {
+			return nil, fmt.Errorf("unknown field to convert: %q", td.Field)
+		}
+		byField[td.Field] = td
+	}
+
+	data := make(map[string][]any, len(fields))
+	row := 0
+	ds.ResetIterator()
+	for ds.Next() {
+		for _, f := range fields {
+			v := ds.Field(f)
+			if err, ok := v.(error); ok {
+				return nil, fmt.Errorf("field %q: %w", f, err)
+			}
+			if td, ok := byField[f]; ok {
+				cv, err := coerceValue(v, td)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: row %d: %w", f, row, err)
+				}
+				v = cv
+			}
+			data[f] = append(data[f], v)
+		}
+		row++
+	}
+	if ds.Err() != nil {
+		return nil, fmt.Errorf("iteration ended with an error: %w", ds.Err())
+	}
+	for _, f := range fields {
+		if data[f] == nil {
+			data[f] = []any{}
+		}
+	}
+
+	sds := NewStaticDataSet(data)
+	sds.fields = fields
+	return sds, nil
+}
+
+// coerceValue converts a value to the type of td.
+func coerceValue(v any, td TypeDef) (any, error) {
+	if dv, ok := v.(driver.Valuer); ok {
+		var err error
+		if v, err = dv.Value(); err != nil {
+			return nil, fmt.Errorf("read value: %w", err)
+		}
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if s, ok := v.(string); ok && td.Type != ColumnTypeString && strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	switch td.Type {
+	case ColumnTypeNumber:
+		if f, ok := numericValue(v); ok {
+			return f, nil
+		}
+		if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(numericString(s), 64); err == nil {
+				return f, nil
+			}
+		}
+	case ColumnTypeInteger:
+		if f, ok := numericValue(v); ok {
+			if f == math.Trunc(f) {
+				return int64(f), nil
+			}
+			break
+		}
+		if s, ok := v.(string); ok {
+			s = numericString(s)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		}
+	case ColumnTypeString:
+		return stringify(v), nil
+	case ColumnTypeTime:
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		if s, ok := v.(string); ok {
+			s = strings.TrimSpace(s)
+			if td.Layout != "" {
+				t, err := time.Parse(td.Layout, s)
+				if err != nil {
+					return nil, fmt.Errorf("cannot convert %q to time with layout %q", s, td.Layout)
+				}
+				return t, nil
+			}
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %q to %s", stringify(v), td.Type)
+}
+
+// numericString removes the surrounding space, a leading currency symbol and
+// the thousands separators from the string form of a number, as in the
+// output of a Postgres money column.
+func numericString(s string) string {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	s = strings.TrimLeft(s, "$€£¥")
+	s = strings.ReplaceAll(s, ",", "")
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// CollisionAction determines what a batch run does when the plots of two
+// plot definitions would be written to the same output filename, so that one
+// would overwrite the other in both the dated and latest directories.
+type CollisionAction string
+
+const (
+	CollisionActionError  CollisionAction = "error"  // fail the run before generating any plot
+	CollisionActionWarn   CollisionAction = "warn"   // log a warning and let the plots overwrite each other (the default)
+	CollisionActionSuffix CollisionAction = "suffix" // append a number to the names of the plots after the first
+)
+
+func (a CollisionAction) String() string { return string(a) }
+
+// plotRef identifies the plot of a template variant of a plot definition,
+// generated for one of the variants of the params of a profile.
+type plotRef struct {
+	params  int    // index of the variant of the params of the profile
+	fname   string // name of the plot definition within the profile's source
+	variant string // name of the template variant, empty if it has none
+}
+
+// plotOutput is a plot found by detectCollisions.
+type plotOutput struct {
+	profile *ProcessingProfile
+	ref     plotRef
+	name    string // name of the plot
+}
+
+// detectCollisions templates and parses every plot definition selected for
+// the run to find the plots that would be written to the same output
+// filename, which is then handled according to action. Plot definitions that
+// cannot be templated or parsed, or whose filenames are invalid, are ignored
+// here, since they fail when generated. With the suffix action, the new names
+// of the plots are recorded in their profiles for the plot jobs to use.
+func detectCollisions(ctx context.Context, cfg *PlotConfig, action CollisionAction, compression Compression) error {
+	var filenames []string
+	byFilename := make(map[string][]plotOutput)
+	for _, profile := range cfg.Profiles {
+		profile.renames = nil
+		infs, _, fnames, err := profile.plotDefFiles(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("processing plot definitions: %w", err)
+		}
+		for i, params := range profile.Variants {
+			org := &Organizer{Template: profile.OutTpl, Params: params, Compression: compression}
+			pcfg := *cfg
+			pcfg.TemplateParams = params
+			for _, fname := range fnames {
+				for _, po := range profilePlots(ctx, infs, fname, &pcfg) {
+					po.profile = profile
+					po.ref.params = i
+					filename, err := org.Filename(po.name, po.ref.variant)
+					if err != nil {
+						continue
+					}
+					if _, seen := byFilename[filename]; !seen {
+						filenames = append(filenames, filename)
+					}
+					byFilename[filename] = append(byFilename[filename], po)
+				}
+			}
+		}
+	}
+
+	var collisions []string
+	for _, filename := range filenames {
+		pos := byFilename[filename]
+		if len(pos) < 2 {
+			continue
+		}
+		var plotDefs []string
+		for _, po := range pos {
+			plotDefs = append(plotDefs, po.ref.fname)
+		}
+		switch action {
+		case CollisionActionError:
+			collisions = append(collisions, fmt.Sprintf("%q (%s)", filename, strings.Join(plotDefs, ", ")))
+		case CollisionActionWarn:
+			slog.Warn("plots have the same output filename and overwrite each other", "filename", filename, "plotdefs", strings.Join(plotDefs, ","))
+		case CollisionActionSuffix:
+			for i, po := range pos[1:] {
+				org := &Organizer{Template: po.profile.OutTpl, Params: po.profile.Variants[po.ref.params], Compression: compression}
+				var name, renamed string
+				for n := i + 2; ; n++ {
+					name = po.name + "-" + strconv.Itoa(n)
+					var err error
+					if renamed, err = org.Filename(name, po.ref.variant); err != nil {
+						return fmt.Errorf("plot filename: %w", err)
+					}
+					if _, taken := byFilename[renamed]; !taken {
+						break
+					}
+				}
+				byFilename[renamed] = []plotOutput{po}
+				if po.profile.renames == nil {
+					po.profile.renames = make(map[plotRef]string)
+				}
+				po.profile.renames[po.ref] = name
+				slog.Info("renaming plot to avoid an output filename collision", "plotdef", po.ref.fname, "name", po.name, "renamed", name, "filename", renamed)
+			}
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("plots have the same output filename: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// profilePlots returns the plots selected for the run from the template
+// variants of a plot definition, or from the plot definition itself if it
+// has none.
+func profilePlots(ctx context.Context, fsys fs.FS, fname string, cfg *PlotConfig) []plotOutput {
+	fcontent, err := fs.ReadFile(fsys, fname)
+	if err != nil {
+		return nil
+	}
+	variants, err := plotVariants(ctx, fname, string(fcontent), cfg)
+	if err != nil {
+		return nil
+	}
+	if len(variants) == 0 {
+		variants = []PlotVariant{{}}
+	}
+
+	var pos []plotOutput
+	for _, v := range variants {
+		vcfg := cfg
+		if v.Name != "" {
+			vcfg = v.config(cfg)
+		}
+		templated, err := ExecuteTemplate(ctx, string(fcontent), vcfg)
+		if err != nil {
+			continue
+		}
+		pd, err := parsePlotDef(fname, []byte(templated), cfg.Defaults)
+		if err != nil || !cfg.Selected(pd) {
+			continue
+		}
+		pos = append(pos, plotOutput{ref: plotRef{fname: fname, variant: v.Name}, name: pd.Name})
+	}
+	return pos
+}
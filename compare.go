@@ -0,0 +1,263 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+	"golang.org/x/exp/slog"
+)
+
+// CompareDef adds a copy of a series for an earlier period, such as the week
+// before, to the plot. The plot definition is templated again with its basis
+// time moved back by the shift and the queries the series depends on are run
+// as of that time. The times of the labels of the earlier series are then
+// moved forward by the shift so that it is drawn over the series it is
+// compared with, faded so the two can be told apart.
+type CompareDef struct {
+	Shift   string   `yaml:"shift"`   // how far back the earlier period is, such as 1w or 1y, defaults to one period of the plot frequency
+	Label   string   `yaml:"label"`   // text added to the name of the earlier series, defaults to previous
+	Opacity *float64 `yaml:"opacity"` // opacity of the earlier series, defaults to 0.4
+}
+
+// frequencyShifts are the default shifts of compared series by the frequency
+// of their plot.
+var frequencyShifts = map[PlotFrequency]string{
+	PlotFrequencyHourly:  "1h",
+	PlotFrequencyDaily:   "1d",
+	PlotFrequencyWeekly:  "1w",
+	PlotFrequencyMonthly: "1mo",
+	PlotFrequencyYearly:  "1y",
+}
+
+// previousSeries describes a series copied for an earlier period.
+type previousSeries struct {
+	label   string
+	opacity float64
+	shift   rangeLength // length of time the labels are moved forward by
+}
+
+// shift returns the shift of the comparison for a plot of the frequency,
+// both as written and parsed.
+func (c *CompareDef) shift(freq PlotFrequency) (string, rangeLength, error) {
+	s := c.Shift
+	if s == "" {
+		var ok bool
+		if s, ok = frequencyShifts[freq]; !ok {
+			return "", rangeLength{}, fmt.Errorf("compare requires a shift for plots without a frequency")
+		}
+	}
+	l, err := parseRangeLength(s)
+	if err != nil {
+		return "", rangeLength{}, fmt.Errorf("invalid compare shift: %w", err)
+	}
+	return s, l, nil
+}
+
+func (c *CompareDef) validate(freq PlotFrequency) error {
+	if _, _, err := c.shift(freq); err != nil {
+		return err
+	}
+	if c.Opacity != nil && (*c.Opacity <= 0 || *c.Opacity > 1) {
+		return fmt.Errorf("compare opacity must be greater than 0 and at most 1: %v", *c.Opacity)
+	}
+	return nil
+}
+
+// previousDataSetName returns the name under which a dataset queried for an
+// earlier period is kept.
+func previousDataSetName(name string, shift string) string {
+	return name + "@-" + shift
+}
+
+// previousSeriesDefs returns the definitions of the earlier copies of the
+// series that are compared with an earlier period. They read the datasets
+// added by addPreviousDataSets and are not themselves smoothed or given
+// trendlines.
+func previousSeriesDefs(pd *PlotDef) ([]SeriesDef, error) {
+	var defs []SeriesDef
+	for _, s := range pd.Series {
+		if s.Compare == nil {
+			continue
+		}
+		name, length, err := s.Compare.shift(pd.Frequency)
+		if err != nil {
+			return nil, fmt.Errorf("series %q: %w", s.Name, err)
+		}
+		prev := &previousSeries{label: s.Compare.Label, opacity: 0.4, shift: length}
+		if prev.label == "" {
+			prev.label = "previous"
+		}
+		if s.Compare.Opacity != nil {
+			prev.opacity = *s.Compare.Opacity
+		}
+
+		p := s
+		p.DataSet = previousDataSetName(s.DataSet, name)
+		p.Compare = nil
+		p.MovingAverage = nil
+		p.Trendline = ""
+		if p.Stack != "" {
+			p.Stack = fmt.Sprintf("%s (%s)", p.Stack, prev.label)
+		}
+		p.previous = prev
+		defs = append(defs, p)
+	}
+	return defs, nil
+}
+
+// addPreviousDataSets queries the datasets read by compared series for their
+// earlier periods and adds them to dataSets. Datasets that are joined or
+// computed from others are derived from the queries of the earlier period.
+func addPreviousDataSets(ctx context.Context, pd *PlotDef, cfg *PlotConfig, dataSets map[string]DataSet, logger *slog.Logger) error {
+	needed := make(map[string]map[string]bool)
+	lengths := make(map[string]rangeLength)
+	for _, s := range pd.Series {
+		if s.Compare == nil {
+			continue
+		}
+		name, length, err := s.Compare.shift(pd.Frequency)
+		if err != nil {
+			return fmt.Errorf("series %q: %w", s.Name, err)
+		}
+		if needed[name] == nil {
+			needed[name] = make(map[string]bool)
+		}
+		needed[name][s.DataSet] = true
+		lengths[name] = length
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+	if pd.source == "" {
+		return fmt.Errorf("compared series require the source of the plot definition")
+	}
+
+	for _, shift := range sortedKeys(needed) {
+		prevCfg := *cfg
+		prevCfg.BasisTime = lengths[shift].before(cfg.BasisTime)
+
+		templated, err := ExecuteTemplate(ctx, pd.source, &prevCfg)
+		if err != nil {
+			return fmt.Errorf("failed to execute templates for previous period %s: %w", shift, err)
+		}
+		prev, err := parsePlotDef(pd.Name, []byte(templated), cfg.Defaults)
+		if err != nil {
+			return fmt.Errorf("failed to parse plot definition for previous period %s: %w", shift, err)
+		}
+		if err := prev.LoadQueryFiles(ctx, pd.queryFS, &prevCfg); err != nil {
+			return fmt.Errorf("failed to load query files for previous period %s: %w", shift, err)
+		}
+		keepDataSetDependencies(prev, needed[shift])
+		if pd.timing != nil {
+			prev.timing = &PlotTiming{}
+		}
+
+		logger.Debug("getting datasets of previous period", "shift", shift, "basis", prevCfg.BasisTime.Format(time.RFC3339))
+		prevSets, err := buildDataSets(ctx, prev, &prevCfg, logger.With("shift", shift))
+		if err != nil {
+			return fmt.Errorf("previous period %s: %w", shift, err)
+		}
+		if prev.timing != nil {
+			for _, q := range prev.timing.Queries {
+				pd.timing.Queries = append(pd.timing.Queries, QueryTiming{Dataset: previousDataSetName(q.Dataset, shift), Source: q.Source, Duration: q.Duration})
+			}
+		}
+		for name := range needed[shift] {
+			ds, ok := prevSets[name]
+			if !ok {
+				continue
+			}
+			dataSets[previousDataSetName(name, shift)] = ds
+		}
+	}
+	return nil
+}
+
+// keepDataSetDependencies removes the datasets, joins and computed datasets
+// of the plot definition that are not needed to derive the named datasets.
+func keepDataSetDependencies(pd *PlotDef, names map[string]bool) {
+	keep := make(map[string]bool, len(names))
+	for name := range names {
+		keep[name] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		add := func(name string) {
+			if !keep[name] {
+				keep[name], changed = true, true
+			}
+		}
+		for _, j := range pd.Joins {
+			if keep[j.Name] {
+				add(j.Left.DataSet)
+				add(j.Right.DataSet)
+			}
+		}
+		for _, c := range pd.Computed {
+			if keep[c.Name] {
+				for _, in := range c.DataSets {
+					add(in.DataSet)
+				}
+			}
+		}
+	}
+
+	datasets := pd.Datasets[:0]
+	for _, ds := range pd.Datasets {
+		if keep[ds.Name] {
+			datasets = append(datasets, ds)
+		}
+	}
+	pd.Datasets = datasets
+	joins := pd.Joins[:0]
+	for _, j := range pd.Joins {
+		if keep[j.Name] {
+			joins = append(joins, j)
+		}
+	}
+	pd.Joins = joins
+	computed := pd.Computed[:0]
+	for _, c := range pd.Computed {
+		if keep[c.Name] {
+			computed = append(computed, c)
+		}
+	}
+	pd.Computed = computed
+}
+
+// shiftLabels moves the time labels of an earlier series forward into the
+// period it is compared with. Labels that are not times are kept.
+func shiftLabels(ls *LabeledSeries, shift rangeLength) {
+	for i, l := range ls.Labels {
+		switch v := l.(type) {
+		case time.Time:
+			ls.Labels[i] = shift.after(v)
+		case string:
+			if t, layout, ok := parseTimeLabel(v); ok {
+				ls.Labels[i] = formatGapTime(shift.after(t), layout)
+			}
+		}
+	}
+}
+
+// setTraceOpacity sets the opacity of a trace, reporting false if the type of
+// trace cannot be faded.
+func setTraceOpacity(trace grob.Trace, opacity float64) bool {
+	switch t := trace.(type) {
+	case *grob.Bar:
+		t.Opacity = opacity
+	case *grob.Scatter:
+		t.Opacity = opacity
+	case *grob.Box:
+		t.Opacity = opacity
+	case *grob.Violin:
+		t.Opacity = opacity
+	case *grob.Candlestick:
+		t.Opacity = opacity
+	default:
+		return false
+	}
+	return true
+}
@@ -1,4 +1,4 @@
-package main
+package ashby
 
 import (
 	"context"
@@ -46,7 +46,7 @@ func ComputeBinaryPredicate(ctx context.Context, pred BinaryPredicate, in1 Compu
 
 		value2, ok := rows2[stringify(join)]
 		if !ok {
-			slog.Debug("no matching row for join field", "join", join)
+			LoggerFromContext(ctx).Debug("no matching row for join field", "join", join)
 			continue
 		}
 
@@ -0,0 +1,159 @@
+package ashby
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CSVQuery is the query of a dataset read from a CSVDataSource. It is written
+// as YAML in the query field of the dataset definition, which is templated
+// along with the rest of the plot definition so the path may be derived from
+// the basis time.
+type CSVQuery struct {
+	Path       string            `yaml:"path"`       // path of the file, relative to the datasource directory
+	Delimiter  string            `yaml:"delimiter"`  // field delimiter, defaults to a comma
+	Header     *bool             `yaml:"header"`     // whether the first row names the columns, defaults to true
+	Timestamps map[string]string `yaml:"timestamps"` // maps the names of timestamp columns to their time layout
+}
+
+// CSVDataSource is a DataSource that reads CSV files from a directory. It is
+// configured with a url such as 'csv:///path/to/dir'. Columns in which every
+// value is an integer or a number are converted to int64 or float64, empty
+// values become nil and all other values are strings. Columns without a header
+// row are named column1, column2 and so on.
+type CSVDataSource struct {
+	dir string
+}
+
+func init() {
+	RegisterDataSource("csv", func(cfg DataSourceConfig) (DataSource, error) {
+		return NewCSVDataSource(cfg.URL), nil
+	})
+}
+
+func NewCSVDataSource(rawurl string) *CSVDataSource {
+	dir := strings.TrimPrefix(strings.TrimPrefix(rawurl, "csv:"), "//")
+	if dir == "" {
+		dir = "."
+	}
+	return &CSVDataSource{dir: dir}
+}
+
+func (c *CSVDataSource) GetDataSet(_ context.Context, query string, params ...any) (DataSet, error) {
+	var q CSVQuery
+	if err := yaml.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("failed to decode csv query: %w", err)
+	}
+	if q.Path == "" {
+		return nil, fmt.Errorf("csv query is missing a path")
+	}
+
+	f, err := os.Open(filepath.Join(c.dir, q.Path))
+	if err != nil {
+		return nil, fmt.Errorf("open csv file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	if q.Delimiter != "" {
+		delim := []rune(q.Delimiter)
+		if len(delim) != 1 {
+			return nil, fmt.Errorf("csv delimiter must be a single character: %q", q.Delimiter)
+		}
+		r.Comma = delim[0]
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read csv file: %w", err)
+	}
+	if len(records) == 0 {
+		return NewStaticDataSet(map[string][]any{}), nil
+	}
+
+	var names []string
+	if q.Header == nil || *q.Header {
+		names = records[0]
+		records = records[1:]
+	} else {
+		for i := range records[0] {
+			names = append(names, fmt.Sprintf("column%d", i+1))
+		}
+	}
+
+	data := make(map[string][]any, len(names))
+	for i, name := range names {
+		col := make([]string, len(records))
+		for j, rec := range records {
+			col[j] = rec[i]
+		}
+
+		if layout, ok := q.Timestamps[name]; ok {
+			vals, err := parseTimeColumn(col, layout)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", name, err)
+			}
+			data[name] = vals
+			continue
+		}
+		data[name] = inferColumn(col)
+	}
+
+	return NewStaticDataSet(data), nil
+}
+
+func parseTimeColumn(col []string, layout string) ([]any, error) {
+	vals := make([]any, len(col))
+	for i, s := range col {
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, fmt.Errorf("parse time on row %d: %w", i+1, err)
+		}
+		vals[i] = t
+	}
+	return vals, nil
+}
+
+// inferColumn converts the values of a column to int64 if they are all
+// integers, float64 if they are all numbers or leaves them as strings.
+func inferColumn(col []string) []any {
+	isInt, isFloat := true, true
+	for _, s := range col {
+		if s == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			isInt = false
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			isFloat = false
+			break
+		}
+	}
+
+	vals := make([]any, len(col))
+	for i, s := range col {
+		switch {
+		case s == "":
+			vals[i] = nil
+		case isInt:
+			vals[i], _ = strconv.ParseInt(s, 10, 64)
+		case isFloat:
+			vals[i], _ = strconv.ParseFloat(s, 64)
+		default:
+			vals[i] = s
+		}
+	}
+	return vals
+}
@@ -0,0 +1,70 @@
+package ashby
+
+import (
+	"sort"
+)
+
+// CumulativeDef configures the replacement of the values of a series by
+// their running total. The points of the series are first sorted by their
+// labels, so the total accumulates along the label axis whatever order the
+// dataset returned its rows in.
+type CumulativeDef struct {
+	Reset string `yaml:"reset"` // optional name of a field, such as the month of each point, whose value changing restarts the total
+}
+
+// cumulativeResetColumn is the role of the column holding the values of the
+// reset field of a cumulative series.
+const cumulativeResetColumn = "cumulative_reset"
+
+// cumulate sorts the points of the series by label and replaces their values
+// with the running total. Values that are not numeric are left null and do
+// not add to the total. When the series has a reset field, the total starts
+// again from zero at each point where the value of the field differs from
+// that of the previous point with a value.
+func cumulate(ls *LabeledSeries) {
+	if len(ls.Labels) != len(ls.Values) {
+		return
+	}
+	sortPoints(ls)
+
+	resets := ls.Columns[cumulativeResetColumn]
+	var (
+		total float64
+		group any
+	)
+	for i, v := range ls.Values {
+		if i < len(resets) && resets[i] != nil {
+			if group != nil && compareOrderValues(resets[i], group) != 0 {
+				total = 0
+			}
+			group = resets[i]
+		}
+		f, ok := numericValue(v)
+		if !ok {
+			ls.Values[i] = nil
+			continue
+		}
+		total += f
+		ls.Values[i] = total
+	}
+}
+
+// sortPoints stably sorts the points of the series by their labels, keeping
+// the values of its other columns with their points.
+func sortPoints(ls *LabeledSeries) {
+	order := make([]int, len(ls.Labels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return compareOrderValues(ls.Labels[order[a]], ls.Labels[order[b]]) < 0
+	})
+
+	ls.Labels = selectIndexes(ls.Labels, order)
+	ls.Values = selectIndexes(ls.Values, order)
+	for role, col := range ls.Columns {
+		if len(col) == len(order) {
+			ls.Columns[role] = selectIndexes(col, order)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// PoolOptions configures the pool of connections held by a database
+// datasource. Zero values leave the driver defaults in place.
+type PoolOptions struct {
+	// MaxOpenConns is the maximum number of connections open to the database at once.
+	MaxOpenConns int
+
+	// MaxIdleConns is the maximum number of idle connections kept for reuse.
+	MaxIdleConns int
+}
+
+// DataSourceConfig is the configuration a datasource is created from.
+type DataSourceConfig struct {
+	URL   string      // the source url given on the command line
+	Pool  PoolOptions // options for sources that hold a pool of connections, which others may ignore
+	Clock Clock       // tells the current time to sources that query relative to it when a query has no basis time
+}
+
+// A DataSourceFactory creates a datasource from its configuration.
+type DataSourceFactory func(cfg DataSourceConfig) (DataSource, error)
+
+var (
+	dataSourceTypesMu sync.RWMutex
+	dataSourceTypes   = make(map[string]DataSourceFactory)
+)
+
+// RegisterDataSource makes a type of datasource available for source urls
+// with the scheme, such as "postgres" for 'postgres://...'. The factory of a
+// scheme such as "prometheus" is also used for urls with a scheme that
+// extends it, such as 'prometheus+https://...', unless that is registered
+// itself. It is intended to be called from an init function, either of the
+// file implementing a built-in datasource or of a program importing the
+// package, and panics if the scheme is already registered or the factory is
+// nil.
+func RegisterDataSource(scheme string, factory DataSourceFactory) {
+	dataSourceTypesMu.Lock()
+	defer dataSourceTypesMu.Unlock()
+	if factory == nil {
+		panic("datasource factory is nil for scheme " + scheme)
+	}
+	if _, dup := dataSourceTypes[scheme]; dup {
+		panic("datasource registered twice for scheme " + scheme)
+	}
+	dataSourceTypes[scheme] = factory
+}
+
+// DataSourceSchemes returns the sorted url schemes of the registered
+// datasource types.
+func DataSourceSchemes() []string {
+	dataSourceTypesMu.RLock()
+	defer dataSourceTypesMu.RUnlock()
+	schemes := make([]string, 0, len(dataSourceTypes))
+	for scheme := range dataSourceTypes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewDataSourceFromURL creates a DataSource for a source url given on the
+// command line. The scheme of the url determines the type of datasource.
+func NewDataSourceFromURL(url string, pool PoolOptions, clock Clock) (DataSource, error) {
+	scheme, _, ok := strings.Cut(url, ":")
+	if !ok {
+		return nil, fmt.Errorf("unsupported source url: %q", url)
+	}
+
+	dataSourceTypesMu.RLock()
+	factory, ok := dataSourceTypes[scheme]
+	if !ok {
+		if base, _, extended := strings.Cut(scheme, "+"); extended {
+			factory, ok = dataSourceTypes[base]
+		}
+	}
+	dataSourceTypesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported source url: %q", url)
+	}
+	return factory(DataSourceConfig{URL: url, Pool: pool, Clock: clock})
+}
+
+// CloseSources closes any of the datasources that hold open connections.
+func CloseSources(srcs map[string]DataSource) {
+	for name, src := range srcs {
+		c, ok := src.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			slog.Warn("failed to close datasource", "source", name, "error", err)
+		}
+	}
+}
+
+// ParseSourceMap parses remappings of datasource names given on the command
+// line in the format from=to. Each remapped name must be one of the sources.
+func ParseSourceMap(opts []string, sources map[string]DataSource) (map[string]string, error) {
+	if len(opts) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(opts))
+	for _, opt := range opts {
+		from, to, ok := strings.Cut(opt, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("datasource map option not valid, use format 'from=to'")
+		}
+		if _, exists := m[from]; exists {
+			return nil, fmt.Errorf("duplicate datasource map for %q specified", from)
+		}
+		if _, exists := sources[to]; !exists {
+			return nil, fmt.Errorf("datasource map for %q: unknown dataset source: %q", from, to)
+		}
+		m[from] = to
+		slog.Info("datasource references will be remapped", "from", from, "to", to)
+	}
+	return m, nil
+}
+
+type queryBasisKey struct{}
+
+// QueryBasis describes the plot a dataset query is being run for. Datasources
+// that query over a time range may use it to derive the range.
+type QueryBasis struct {
+	Time      time.Time
+	Frequency PlotFrequency
+	Location  *time.Location // time zone the periods of the plot begin in, nil for UTC
+	WeekStart time.Weekday   // day the weeks of a weekly plot begin on
+}
+
+// WithQueryBasis returns a context carrying the basis of a query.
+func WithQueryBasis(ctx context.Context, b QueryBasis) context.Context {
+	return context.WithValue(ctx, queryBasisKey{}, b)
+}
+
+// QueryBasisFromContext returns the basis of a query carried by ctx.
+func QueryBasisFromContext(ctx context.Context) (QueryBasis, bool) {
+	b, ok := ctx.Value(queryBasisKey{}).(QueryBasis)
+	return b, ok
+}
+
+// Period returns the nominal duration of a single period of the basis
+// frequency, or zero if the frequency is unknown.
+func (b QueryBasis) Period() time.Duration {
+	switch b.Frequency {
+	case PlotFrequencyHourly:
+		return time.Hour
+	case PlotFrequencyDaily:
+		return 24 * time.Hour
+	case PlotFrequencyWeekly:
+		return 7 * 24 * time.Hour
+	case PlotFrequencyMonthly:
+		return 30 * 24 * time.Hour
+	case PlotFrequencyYearly:
+		return 365 * 24 * time.Hour
+	default:
+		d, _ := b.Frequency.Interval()
+		return d
+	}
+}
+
+type rowLimitKey struct{}
+
+// WithRowLimit returns a context carrying the maximum number of rows a
+// dataset query may return.
+func WithRowLimit(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, rowLimitKey{}, n)
+}
+
+// RowLimitFromContext returns the maximum number of rows a dataset query may
+// return, or zero if there is no limit.
+func RowLimitFromContext(ctx context.Context) int {
+	n, _ := ctx.Value(rowLimitKey{}).(int)
+	return n
+}
+
+type setupKey struct{}
+
+// WithSetup returns a context carrying the setup statements, such as SET
+// statements, that a datasource must run before the dataset query in the same
+// session, so that the settings they make apply to the query.
+func WithSetup(ctx context.Context, stmts []string) context.Context {
+	return context.WithValue(ctx, setupKey{}, stmts)
+}
+
+// SetupFromContext returns the setup statements to run before the dataset
+// query, if any.
+func SetupFromContext(ctx context.Context) []string {
+	stmts, _ := ctx.Value(setupKey{}).([]string)
+	return stmts
+}
+
+// A SetupRunner is a DataSource that runs the setup statements carried by the
+// context of a query in the same session as the query.
+type SetupRunner interface {
+	RunsSetup() bool
+}
+
+// runsSetup reports whether the datasource runs setup statements.
+func runsSetup(src DataSource) bool {
+	r, ok := src.(SetupRunner)
+	return ok && r.RunsSetup()
+}
+
+// A BasisTimeReader is a DataSource whose results depend on the time of the
+// query basis carried by the context, not just on the period it falls in.
+type BasisTimeReader interface {
+	ReadsBasisTime() bool
+}
+
+// readsBasisTime reports whether the results of the datasource depend on the
+// basis time of the query.
+func readsBasisTime(src DataSource) bool {
+	r, ok := src.(BasisTimeReader)
+	return ok && r.ReadsBasisTime()
+}
+
+// RowLimitError is returned by a datasource when a query returns more rows
+// than the row limit allows.
+type RowLimitError struct {
+	Limit int
+}
+
+func (e *RowLimitError) Error() string {
+	return fmt.Sprintf("query returned more than %d rows", e.Limit)
+}
+
+// rowCollector accumulates the rows of a query result as they are read,
+// failing as soon as the row limit is exceeded so that an oversized result
+// is never held in memory. The rows of a streamed dataset are instead counted
+// into the bins of its aggregation, which holds only the counts however many
+// rows there are, so the row limit does not apply to them.
+type rowCollector struct {
+	limit int
+	rows  int
+	data  map[string][]any
+	agg   rowAggregator
+	err   error
+}
+
+func newRowCollector(ctx context.Context) *rowCollector {
+	c := &rowCollector{
+		limit: RowLimitFromContext(ctx),
+		data:  make(map[string][]any),
+	}
+	if a := RowAggregationFromContext(ctx); a != nil {
+		c.agg, c.err = a.aggregator()
+	}
+	return c
+}
+
+// Add appends the values of a single row, given in the same order as names.
+func (c *rowCollector) Add(names []string, vals []any) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.agg != nil {
+		c.agg.Add(names, vals)
+		return nil
+	}
+	c.rows++
+	if c.limit > 0 && c.rows > c.limit {
+		return &RowLimitError{Limit: c.limit}
+	}
+	for i, name := range names {
+		c.data[name] = append(c.data[name], vals[i])
+	}
+	return nil
+}
+
+func (c *rowCollector) DataSet() *StaticDataSet {
+	if c.agg != nil {
+		return c.agg.DataSet()
+	}
+	return NewStaticDataSet(c.data)
+}
@@ -0,0 +1,93 @@
+package ashby
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PlotDefaults are values inherited by every plot definition, read from the
+// defaults block of defaults.yaml in the configuration directory.
+//
+// Defaults are merged field by field: a default only fills a field that the
+// plot definition leaves empty, so a plot definition may override the theme
+// while inheriting the source. The source default is merged into each
+// dataset that does not name a source. Defaults are applied after templates
+// are executed, so a templated value in the plot definition takes precedence,
+// while one that is executed to an empty string is filled by the default.
+type PlotDefaults struct {
+	Source       string        `yaml:"source"`       // datasource of datasets that do not name one
+	Frequency    PlotFrequency `yaml:"frequency"`    // frequency of plots that do not specify one
+	Theme        string        `yaml:"theme"`        // theme of plots that do not specify one
+	Timezone     string        `yaml:"timezone"`     // timezone of plots that do not specify one
+	WeekStart    string        `yaml:"weekStart"`    // start of week of plots that do not specify one
+	QueryTimeout time.Duration `yaml:"queryTimeout"` // query timeout of plots that do not specify one
+	Tags         []string      `yaml:"tags"`         // tags of plots that do not specify any
+	OnEmpty      EmptyAction   `yaml:"onEmpty"`      // handling of empty datasets of plots that do not specify one
+}
+
+type DefaultsDoc struct {
+	Defaults PlotDefaults `yaml:"defaults"`
+}
+
+// LoadDefaults reads the plot definition defaults from defaults.yaml in the
+// configuration directory. It returns nil if conffs is nil or the file does
+// not exist.
+func LoadDefaults(conffs fs.FS) (*PlotDefaults, error) {
+	if conffs == nil {
+		return nil, nil
+	}
+
+	content, err := fs.ReadFile(conffs, "defaults.yaml")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read defaults: %w", err)
+	}
+
+	var dd DefaultsDoc
+	if err := yaml.Unmarshal(content, &dd); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal defaults.yaml: %w", err)
+	}
+	return &dd.Defaults, nil
+}
+
+// apply fills the empty fields of the plot definition with the defaults. A
+// nil PlotDefaults leaves the plot definition unchanged.
+func (d *PlotDefaults) apply(pd *PlotDef) {
+	if d == nil {
+		return
+	}
+	if d.Source != "" {
+		for i := range pd.Datasets {
+			if pd.Datasets[i].Source == "" {
+				pd.Datasets[i].Source = d.Source
+			}
+		}
+	}
+	if pd.Frequency == "" {
+		pd.Frequency = d.Frequency
+	}
+	if pd.Theme == "" {
+		pd.Theme = d.Theme
+	}
+	if pd.Timezone == "" {
+		pd.Timezone = d.Timezone
+	}
+	if pd.WeekStart == "" {
+		pd.WeekStart = d.WeekStart
+	}
+	if pd.QueryTimeout == 0 {
+		pd.QueryTimeout = d.QueryTimeout
+	}
+	if pd.OnEmpty == EmptyActionDefault {
+		pd.OnEmpty = d.OnEmpty
+	}
+	if len(pd.Tags) == 0 && len(d.Tags) > 0 {
+		pd.Tags = append([]string(nil), d.Tags...)
+	}
+}
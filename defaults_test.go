@@ -0,0 +1,148 @@
+package ashby
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDefaultsPartialOverride(t *testing.T) {
+	defaults, err := LoadDefaults(fstest.MapFS{"defaults.yaml": &fstest.MapFile{Data: []byte(`
+defaults:
+  source: pgnebula
+  frequency: daily
+  theme: light
+`)}})
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+
+	pd, err := parsePlotDef("peers", []byte(`
+name: peers
+theme: dark
+datasets:
+  - name: inherited
+    query: select 1
+  - name: named
+    source: pgcrawler
+    query: select 1
+`), defaults)
+	if err != nil {
+		t.Fatalf("parse plot definition: %v", err)
+	}
+
+	if pd.Theme != "dark" {
+		t.Errorf("got theme %q, want the plot definition's dark", pd.Theme)
+	}
+	if pd.Frequency != PlotFrequencyDaily {
+		t.Errorf("got frequency %q, want the default daily", pd.Frequency)
+	}
+	if got := pd.Datasets[0].Source; got != "pgnebula" {
+		t.Errorf("got source %q of dataset without a source, want the default pgnebula", got)
+	}
+	if got := pd.Datasets[1].Source; got != "pgcrawler" {
+		t.Errorf("got source %q of dataset naming a source, want its own pgcrawler", got)
+	}
+}
+
+func TestDefaultsPrecedence(t *testing.T) {
+	defaults := &PlotDefaults{
+		Source:       "pgnebula",
+		Frequency:    PlotFrequencyDaily,
+		Theme:        "light",
+		Timezone:     "Europe/London",
+		WeekStart:    "sunday",
+		QueryTimeout: time.Minute,
+		Tags:         []string{"network"},
+		OnEmpty:      EmptyActionSkip,
+	}
+
+	testCases := []struct {
+		name    string
+		plotdef string
+		check   func(t *testing.T, pd *PlotDef)
+	}{
+		{
+			name:    "all inherited",
+			plotdef: "name: demo\n",
+			check: func(t *testing.T, pd *PlotDef) {
+				if pd.Frequency != PlotFrequencyDaily || pd.Theme != "light" || pd.Timezone != "Europe/London" || pd.WeekStart != "sunday" {
+					t.Errorf("got frequency %q, theme %q, timezone %q and week start %q, want the defaults", pd.Frequency, pd.Theme, pd.Timezone, pd.WeekStart)
+				}
+				if pd.QueryTimeout != time.Minute || pd.OnEmpty != EmptyActionSkip || len(pd.Tags) != 1 || pd.Tags[0] != "network" {
+					t.Errorf("got query timeout %s, on empty %q and tags %v, want the defaults", pd.QueryTimeout, pd.OnEmpty, pd.Tags)
+				}
+			},
+		},
+		{
+			name:    "all overridden",
+			plotdef: "name: demo\nfrequency: weekly\ntheme: dark\ntimezone: UTC\nweekStart: monday\nqueryTimeout: 5s\ntags: [dht]\nonEmpty: error\n",
+			check: func(t *testing.T, pd *PlotDef) {
+				if pd.Frequency != PlotFrequencyWeekly || pd.Theme != "dark" || pd.Timezone != "UTC" || pd.WeekStart != "monday" {
+					t.Errorf("got frequency %q, theme %q, timezone %q and week start %q, want the plot definition's", pd.Frequency, pd.Theme, pd.Timezone, pd.WeekStart)
+				}
+				if pd.QueryTimeout != 5*time.Second || pd.OnEmpty != EmptyActionError || len(pd.Tags) != 1 || pd.Tags[0] != "dht" {
+					t.Errorf("got query timeout %s, on empty %q and tags %v, want the plot definition's", pd.QueryTimeout, pd.OnEmpty, pd.Tags)
+				}
+			},
+		},
+		{
+			name:    "empty value inherited",
+			plotdef: "name: demo\ntheme: \"\"\ntags: []\n",
+			check: func(t *testing.T, pd *PlotDef) {
+				if pd.Theme != "light" {
+					t.Errorf("got theme %q, want the default light", pd.Theme)
+				}
+				if len(pd.Tags) != 1 || pd.Tags[0] != "network" {
+					t.Errorf("got tags %v, want the default tags", pd.Tags)
+				}
+			},
+		},
+		{
+			name:    "templated value",
+			plotdef: "name: demo\ntheme: '{{ if true }}dark{{ end }}'\nfrequency: '{{ if false }}weekly{{ end }}'\n",
+			check: func(t *testing.T, pd *PlotDef) {
+				if pd.Theme != "dark" {
+					t.Errorf("got theme %q, want the templated dark", pd.Theme)
+				}
+				if pd.Frequency != PlotFrequencyDaily {
+					t.Errorf("got frequency %q, want the default daily for a value templated to be empty", pd.Frequency)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &PlotConfig{BasisTime: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC), Defaults: defaults}
+			templated, err := ExecuteTemplate(context.Background(), tc.plotdef, cfg)
+			if err != nil {
+				t.Fatalf("execute template: %v", err)
+			}
+			pd, err := parsePlotDef("demo", []byte(templated), defaults)
+			if err != nil {
+				t.Fatalf("parse plot definition: %v", err)
+			}
+			tc.check(t, pd)
+		})
+	}
+}
+
+func TestDefaultsMissing(t *testing.T) {
+	defaults, err := LoadDefaults(fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	if defaults != nil {
+		t.Errorf("got defaults %+v without a defaults.yaml, want nil", defaults)
+	}
+
+	pd, err := parsePlotDef("demo", []byte("name: demo\ntheme: dark\n"), defaults)
+	if err != nil {
+		t.Fatalf("parse plot definition: %v", err)
+	}
+	if pd.Theme != "dark" || pd.Frequency != "" {
+		t.Errorf("got theme %q and frequency %q, want the plot definition unchanged", pd.Theme, pd.Frequency)
+	}
+}
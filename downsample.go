@@ -0,0 +1,98 @@
+package ashby
+
+import "math"
+
+// DownsampleDef configures the reduction of a dense series to fewer points
+// before it is plotted.
+type DownsampleDef struct {
+	Points int `yaml:"points"` // the target number of points, series with no more points are left as-is
+}
+
+// downsample reduces the series to the target number of points of def using
+// the Largest-Triangle-Three-Buckets algorithm, which keeps the points that
+// contribute most to the visual shape of the series. The first and last
+// points are always kept. Labels are positioned as by labelPositions and the
+// fields read alongside the values are reduced with them.
+func downsample(ls *LabeledSeries, def *DownsampleDef) {
+	n := len(ls.Values)
+	if def.Points < 3 || n <= def.Points {
+		return
+	}
+
+	xs := labelPositions(ls.Labels, n)
+	ys := make([]float64, n)
+	numeric := make([]bool, n)
+	for i, v := range ls.Values {
+		if f, ok := numericValue(v); ok && !math.IsNaN(f) {
+			ys[i], numeric[i] = f, true
+		}
+	}
+
+	keep := make([]int, 0, def.Points)
+	keep = append(keep, 0)
+
+	// the points between the first and last are split into equal buckets and
+	// the point of each bucket that forms the largest triangle with the point
+	// kept from the previous bucket and the average of the next is kept
+	size := float64(n-2) / float64(def.Points-2)
+	prev := 0
+	for b := 0; b < def.Points-2; b++ {
+		start := int(float64(b)*size) + 1
+		end := int(float64(b+1)*size) + 1
+
+		nextStart, nextEnd := end, int(float64(b+2)*size)+1
+		if nextEnd > n {
+			nextEnd = n
+		}
+		var avgX, avgY float64
+		var count int
+		for i := nextStart; i < nextEnd; i++ {
+			if numeric[i] {
+				avgX += xs[i]
+				avgY += ys[i]
+				count++
+			}
+		}
+		if count > 0 {
+			avgX /= float64(count)
+			avgY /= float64(count)
+		} else {
+			avgX, avgY = xs[n-1], ys[n-1]
+		}
+
+		// a bucket without numeric values keeps its first point
+		chosen, largest := start, -1.0
+		for i := start; i < end; i++ {
+			if !numeric[i] {
+				continue
+			}
+			area := math.Abs((xs[prev]-avgX)*(ys[i]-ys[prev]) - (xs[prev]-xs[i])*(avgY-ys[prev]))
+			if area > largest {
+				chosen, largest = i, area
+			}
+		}
+		keep = append(keep, chosen)
+		prev = chosen
+	}
+	keep = append(keep, n-1)
+
+	ls.Values = selectIndexes(ls.Values, keep)
+	if len(ls.Labels) == n {
+		ls.Labels = selectIndexes(ls.Labels, keep)
+	}
+	for role, col := range ls.Columns {
+		if len(col) == n {
+			ls.Columns[role] = selectIndexes(col, keep)
+		}
+	}
+}
+
+// selectIndexes returns the values at the indexes, in the order of the
+// indexes.
+func selectIndexes(vals []any, indexes []int) []any {
+	selected := make([]any, len(indexes))
+	for i, idx := range indexes {
+		selected[i] = vals[idx]
+	}
+	return selected
+}
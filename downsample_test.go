@@ -0,0 +1,85 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+	const n = 1000
+	ls := &LabeledSeries{Columns: map[string][]any{"text": {}}}
+	for i := 0; i < n; i++ {
+		v := math.Sin(float64(i) / 50)
+		if i == 500 {
+			v = 10 // a spike that must survive downsampling
+		}
+		ls.Labels = append(ls.Labels, float64(i))
+		ls.Values = append(ls.Values, v)
+		ls.Columns["text"] = append(ls.Columns["text"], fmt.Sprint(i))
+	}
+
+	downsample(ls, &DownsampleDef{Points: 50})
+
+	if len(ls.Values) != 50 || len(ls.Labels) != 50 || len(ls.Columns["text"]) != 50 {
+		t.Fatalf("got %d values, %d labels and %d texts, want 50 of each", len(ls.Values), len(ls.Labels), len(ls.Columns["text"]))
+	}
+	if ls.Labels[0] != 0.0 || ls.Labels[49] != float64(n-1) {
+		t.Errorf("got first label %v and last label %v, want the first and last points kept", ls.Labels[0], ls.Labels[49])
+	}
+	var spike bool
+	prev := -1.0
+	for i, l := range ls.Labels {
+		x := l.(float64)
+		if x <= prev {
+			t.Errorf("got label %v after %v, want the points in order", x, prev)
+		}
+		prev = x
+		if ls.Columns["text"][i] != fmt.Sprint(x) {
+			t.Errorf("got text %v for label %v, want the fields reduced with the values", ls.Columns["text"][i], x)
+		}
+		if ls.Values[i] == 10.0 {
+			spike = true
+		}
+	}
+	if !spike {
+		t.Errorf("got the spike dropped")
+	}
+}
+
+func TestDownsampleBucketWithoutNumbers(t *testing.T) {
+	// with 10 points reduced to 4, the points from 1 to 4 and from 5 to 8
+	// form the two buckets between the first and last point
+	ls := &LabeledSeries{Values: []any{0.0, nil, "x", nil, math.NaN(), 1.0, 5.0, 2.0, 1.0, 0.0}}
+
+	downsample(ls, &DownsampleDef{Points: 4})
+
+	if len(ls.Values) != 4 {
+		t.Fatalf("got %d values, want 4", len(ls.Values))
+	}
+	if ls.Values[1] != nil {
+		t.Errorf("got %v kept from the bucket without numbers, want its first point", ls.Values[1])
+	}
+	if ls.Values[2] != 5.0 {
+		t.Errorf("got %v kept from the second bucket, want its peak 5", ls.Values[2])
+	}
+	if ls.Values[0] != 0.0 || ls.Values[3] != 0.0 {
+		t.Errorf("got first value %v and last value %v, want both 0", ls.Values[0], ls.Values[3])
+	}
+}
+
+func TestDownsampleUnderThreshold(t *testing.T) {
+	values := []any{1.0, 2.0, 3.0, 4.0, 5.0}
+	for name, def := range map[string]*DownsampleDef{
+		"fewer points than target": {Points: 10},
+		"as many as target":        {Points: 5},
+		"target too small":         {Points: 2},
+		"no target":                {},
+	} {
+		ls := &LabeledSeries{Labels: []any{"a", "b", "c", "d", "e"}, Values: append([]any(nil), values...)}
+		downsample(ls, def)
+		if fmt.Sprint(ls.Values) != fmt.Sprint(values) || len(ls.Labels) != len(values) {
+			t.Errorf("%s: got values %v and labels %v, want the series unchanged", name, ls.Values, ls.Labels)
+		}
+	}
+}
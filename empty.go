@@ -0,0 +1,77 @@
+package ashby
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// EmptyAction determines what happens to a plot whose datasets are all empty,
+// such as when a query for a new metric legitimately returns no rows.
+type EmptyAction string
+
+const (
+	EmptyActionDefault     EmptyAction = ""            // same as placeholder
+	EmptyActionPlaceholder EmptyAction = "placeholder" // write the plot with a no data annotation
+	EmptyActionSkip        EmptyAction = "skip"        // do not write the plot
+	EmptyActionError       EmptyAction = "error"       // fail the plot
+)
+
+func (a EmptyAction) String() string { return string(a) }
+
+// ErrEmptyPlot is returned when generating a plot whose datasets are all
+// empty and whose plot definition does not ask for a placeholder.
+var ErrEmptyPlot = errors.New("all datasets of the plot are empty")
+
+// emptyText is the text of the annotation of a placeholder plot.
+const emptyText = "No data"
+
+// dataSetsEmpty reports whether all the datasets queried for the plot
+// definition returned no rows. A plot without datasets is not empty since it
+// may still show annotations and shapes.
+func dataSetsEmpty(pd *PlotDef, dataSets map[string]DataSet) bool {
+	if len(pd.Datasets) == 0 {
+		return false
+	}
+	for _, def := range pd.Datasets {
+		ds, ok := dataSets[def.Name]
+		if !ok {
+			continue
+		}
+		ds.ResetIterator()
+		hasRows := ds.Next()
+		ds.ResetIterator()
+		if hasRows {
+			return false
+		}
+	}
+	return true
+}
+
+// emptyAnnotation returns the annotation shown in the middle of a placeholder
+// plot.
+func emptyAnnotation() PlotAnnotation {
+	return PlotAnnotation{
+		RefX: "paper",
+		RefY: "paper",
+		X:    0.5,
+		Y:    0.5,
+		Text: emptyText,
+	}
+}
+
+// MarshalJSON always includes the data of the figure, even when it has no
+// traces, since plotly requires it.
+func (f FigureData) MarshalJSON() ([]byte, error) {
+	type figureData FigureData
+	data, err := json.Marshal(figureData(f))
+	if err != nil || (f.Fig != nil && len(f.Fig.Data) > 0) {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["data"] = json.RawMessage("[]")
+	return json.Marshal(fields)
+}
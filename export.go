@@ -0,0 +1,176 @@
+package ashby
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// DataExport collects the data plotted by a figure so that it can be written
+// as CSV alongside the plot. Each row holds a point of a series, overlay or
+// table, in a column named "series", followed by columns named after the
+// dataset fields it was read from. A nil DataExport ignores everything added
+// to it.
+type DataExport struct {
+	fields []string            // names of the columns after series, in the order they were first added
+	index  map[string]struct{} // set of fields
+	rows   []exportRow
+}
+
+type exportRow struct {
+	series string
+	values map[string]any
+}
+
+func NewDataExport() *DataExport {
+	return &DataExport{index: make(map[string]struct{})}
+}
+
+// add appends a row for each value of the columns, which are keyed by field
+// name. Columns with an empty field name are not exported.
+func (e *DataExport) add(series string, names []string, columns ...[]any) {
+	n := 0
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, ok := e.index[name]; !ok {
+			e.index[name] = struct{}{}
+			e.fields = append(e.fields, name)
+		}
+		if len(columns[i]) > n {
+			n = len(columns[i])
+		}
+	}
+
+	for r := 0; r < n; r++ {
+		row := exportRow{series: series, values: make(map[string]any, len(names))}
+		for i, name := range names {
+			if name != "" && r < len(columns[i]) {
+				row.values[name] = columns[i][r]
+			}
+		}
+		e.rows = append(e.rows, row)
+	}
+}
+
+// AddSeries adds the labels, values and other fields of a series.
+func (e *DataExport) AddSeries(ls *LabeledSeries) {
+	if e == nil {
+		return
+	}
+	names := []string{ls.SeriesDef.Labels, ls.SeriesDef.Values}
+	columns := [][]any{ls.Labels, ls.Values}
+	fields := ls.SeriesDef.columnFields()
+	roles := make([]string, 0, len(fields))
+	for role := range fields {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		names = append(names, fields[role])
+		columns = append(columns, ls.Columns[role])
+	}
+	e.add(ls.Name, names, columns...)
+}
+
+// AddOverlay adds the values of a trace drawn over a series, such as a moving
+// average or trendline, under the field names of the series.
+func (e *DataExport) AddOverlay(trace *grob.Scatter, ls *LabeledSeries) {
+	if e == nil {
+		return
+	}
+	labels, values := trace.X, trace.Y
+	if ls.SeriesDef.horizontal() {
+		labels, values = values, labels
+	}
+	l, _ := labels.([]any)
+	v, _ := values.([]any)
+	name, _ := trace.Name.(string)
+	e.add(name, []string{ls.SeriesDef.Labels, ls.SeriesDef.Values}, l, v)
+}
+
+// AddTable adds a row for each cell of a table.
+func (e *DataExport) AddTable(lt *LabeledTable) {
+	if e == nil {
+		return
+	}
+	var xs, ys, zs []any
+	for _, y := range lt.LabelsY {
+		for _, x := range lt.LabelsX {
+			if z, ok := lt.Values[x][y]; ok {
+				xs, ys, zs = append(xs, x), append(ys, y), append(zs, z)
+			}
+		}
+	}
+	e.add(lt.Name, []string{lt.TableDef.LabelsX, lt.TableDef.LabelsY, lt.TableDef.Values}, xs, ys, zs)
+}
+
+// AddBinnedHeatmap adds a row for each bin of a binned heatmap, holding the
+// centers of the bin and the count of points within it.
+func (e *DataExport) AddBinnedHeatmap(trace *grob.Heatmap, table *TableDef) {
+	if e == nil {
+		return
+	}
+	xc, _ := trace.X.([]any)
+	yc, _ := trace.Y.([]any)
+	counts, _ := trace.Z.([][]any)
+
+	var xs, ys, zs []any
+	for j, row := range counts {
+		for i, z := range row {
+			if i < len(xc) && j < len(yc) {
+				xs, ys, zs = append(xs, xc[i]), append(ys, yc[j]), append(zs, z)
+			}
+		}
+	}
+	e.add(table.Name, []string{table.LabelsX, table.LabelsY, "count"}, xs, ys, zs)
+}
+
+// CSV formats the collected data as CSV with a header row.
+func (e *DataExport) CSV() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+
+	if err := w.Write(append([]string{"series"}, e.fields...)); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	record := make([]string, len(e.fields)+1)
+	for _, row := range e.rows {
+		record[0] = row.series
+		for i, f := range e.fields {
+			record[i+1] = formatCSVValue(row.values[f])
+		}
+		if err := w.Write(record); err != nil {
+			return nil, fmt.Errorf("write row: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("flush csv: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatCSVValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,281 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ColumnDef defines a column computed from other columns of the same dataset
+// using an arithmetic expression, such as 'errors / total * 100'. Expressions
+// may use the operators + - * / and parentheses, numbers and the names of
+// fields of the dataset, including earlier computed columns. A field whose
+// name is not a valid identifier may be written in square brackets, as in
+// '[error count]'. The result is null when any field used is null or not
+// numeric, or when dividing by zero.
+type ColumnDef struct {
+	Name string `yaml:"name"` // the name of the computed field
+	Expr string `yaml:"expr"` // the expression computing the value of the field for each row
+}
+
+// An exprNode is a parsed expression that can be evaluated against a row.
+type exprNode interface {
+	eval(field func(string) any) (any, error)
+}
+
+type (
+	exprNumber float64
+	exprField  string
+	exprNeg    struct{ x exprNode }
+	exprBinary struct {
+		op   byte
+		x, y exprNode
+	}
+)
+
+func (n exprNumber) eval(func(string) any) (any, error) { return float64(n), nil }
+
+func (n exprField) eval(field func(string) any) (any, error) {
+	v := field(string(n))
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("field %q: %w", string(n), err)
+	}
+	return v, nil
+}
+
+func (n exprNeg) eval(field func(string) any) (any, error) {
+	v, err := n.x.eval(field)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := numericValue(v)
+	if !ok {
+		return nil, nil
+	}
+	return -f, nil
+}
+
+func (n exprBinary) eval(field func(string) any) (any, error) {
+	xv, err := n.x.eval(field)
+	if err != nil {
+		return nil, err
+	}
+	yv, err := n.y.eval(field)
+	if err != nil {
+		return nil, err
+	}
+	x, xok := numericValue(xv)
+	y, yok := numericValue(yv)
+	if !xok || !yok {
+		return nil, nil
+	}
+
+	var r float64
+	switch n.op {
+	case '+':
+		r = x + y
+	case '-':
+		r = x - y
+	case '*':
+		r = x * y
+	case '/':
+		if y == 0 {
+			return nil, nil
+		}
+		r = x / y
+	}
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// parseExpr parses an arithmetic expression of a computed column.
+func parseExpr(s string) (exprNode, error) {
+	p := &exprParser{s: s}
+	n, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression", p.s[p.pos:], p.pos)
+	}
+	return n, nil
+}
+
+// exprParser is a recursive descent parser of arithmetic expressions.
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) space() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or zero at the end of the expression.
+func (p *exprParser) peek() byte {
+	p.space()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// sum parses terms separated by + or -.
+func (p *exprParser) sum() (exprNode, error) {
+	x, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+}
+
+// product parses factors separated by * or /.
+func (p *exprParser) product() (exprNode, error) {
+	x, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+}
+
+// factor parses a number, field, negation or parenthesized expression.
+func (p *exprParser) factor() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return exprNeg{x: x}, nil
+	case c == '(':
+		p.pos++
+		x, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis in expression")
+		}
+		p.pos++
+		return x, nil
+	case c == '[':
+		end := strings.IndexByte(p.s[p.pos:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("missing closing bracket in expression")
+		}
+		name := p.s[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		if name == "" {
+			return nil, fmt.Errorf("empty field name in expression")
+		}
+		return exprField(name), nil
+	case c == '.' || c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '.' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9') {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression", p.s[start:p.pos])
+		}
+		return exprNumber(f), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '_' || unicode.IsLetter(rune(p.s[p.pos])) || unicode.IsDigit(rune(p.s[p.pos]))) {
+			p.pos++
+		}
+		return exprField(p.s[start:p.pos]), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d in expression", c, p.pos)
+	}
+}
+
+// ColumnsDataSet adds computed columns to the rows of a dataset.
+type ColumnsDataSet struct {
+	DataSet
+	names   map[string]int // index of each column by name
+	order   []string       // names of the columns in definition order
+	columns []exprNode
+}
+
+// NewColumnsDataSet returns ds with the columns computed by defs added to it.
+func NewColumnsDataSet(ds DataSet, defs []ColumnDef) (*ColumnsDataSet, error) {
+	cds := &ColumnsDataSet{
+		DataSet: ds,
+		names:   make(map[string]int, len(defs)),
+	}
+	for _, def := range defs {
+		if _, exists := cds.names[def.Name]; exists {
+			return nil, fmt.Errorf("duplicate column name: %q", def.Name)
+		}
+		n, err := parseExpr(def.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", def.Name, err)
+		}
+		cds.names[def.Name] = len(cds.columns)
+		cds.order = append(cds.order, def.Name)
+		cds.columns = append(cds.columns, n)
+	}
+	return cds, nil
+}
+
+// Field returns the value of a field of the current row, computing it if it
+// is one of the added columns.
+func (c *ColumnsDataSet) Field(name string) any {
+	return c.field(name, len(c.columns))
+}
+
+// Fields returns the names of the fields of the underlying dataset followed
+// by those of the computed columns.
+func (c *ColumnsDataSet) Fields() []string {
+	names, _ := fieldNames(c.DataSet)
+	return append(names, c.order...)
+}
+
+// field returns the value of a field of the current row, where only the
+// first n columns are computed so that a column cannot refer to itself or
+// to those after it.
+func (c *ColumnsDataSet) field(name string, n int) any {
+	i, ok := c.names[name]
+	if !ok || i >= n {
+		return c.DataSet.Field(name)
+	}
+	v, err := c.columns[i].eval(func(name string) any { return c.field(name, i) })
+	if err != nil {
+		return fmt.Errorf("column %q: %w", name, err)
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package ashby
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExprEval(t *testing.T) {
+	row := map[string]any{"a": 2.0, "b": int64(3), "c": 4.0, "zero": 0.0, "error count": 5.0, "text": "x", "null": nil}
+	field := func(name string) any { return row[name] }
+
+	for expr, want := range map[string]any{
+		"1 + 2 * 3":          7.0,
+		"(1 + 2) * 3":        9.0,
+		"a - b - c":          -5.0,
+		"c / a / a":          1.0,
+		"c - a * b / a":      1.0,
+		"-a":                 -2.0,
+		"--a":                2.0,
+		"-a * b":             -6.0,
+		"c - -a":             6.0,
+		"-(a + b)":           -5.0,
+		"[error count] / a":  2.5,
+		"[a] + [b]":          5.0,
+		".5 * c":             2.0,
+		"  a*b  ":            6.0,
+		"a / zero":           nil,
+		"a / (b - b)":        nil,
+		"-(a / zero)":        nil,
+		"a + text":           nil,
+		"null * 2":           nil,
+		"(a / zero) + 1":     nil,
+		"b / c * 100":        75.0,
+		"[error count] - -1": 6.0,
+	} {
+		n, err := parseExpr(expr)
+		if err != nil {
+			t.Errorf("parse %q: %v", expr, err)
+			continue
+		}
+		got, err := n.eval(field)
+		if err != nil {
+			t.Errorf("eval %q: %v", expr, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("eval %q: got %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		"":          "unexpected end of expression",
+		"a +":       "unexpected end of expression",
+		"(a + b":    "missing closing parenthesis",
+		"a + b)":    `unexpected ")"`,
+		"[a + b":    "missing closing bracket",
+		"[] + 1":    "empty field name",
+		"1..2":      `invalid number "1..2"`,
+		"a b":       `unexpected "b"`,
+		"a % b":     `unexpected "% b"`,
+		"a * (b +)": "unexpected ')'",
+	} {
+		_, err := parseExpr(expr)
+		if err == nil {
+			t.Errorf("parse %q: got no error, want %q", expr, want)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("parse %q: got error %q, want it to contain %q", expr, err, want)
+		}
+	}
+}
+
+func TestColumnsDataSetReferences(t *testing.T) {
+	ds := NewStaticDataSet(map[string][]any{"x": {1.0, 2.0}, "y": {10.0, 0.0}})
+	cds, err := NewColumnsDataSet(ds, []ColumnDef{
+		{Name: "x", Expr: "x * 2"},     // refers to the field of the dataset it replaces
+		{Name: "ratio", Expr: "x / y"}, // sees the computed x
+		{Name: "loop", Expr: "loop + 1"},
+		{Name: "early", Expr: "late"},
+		{Name: "late", Expr: "1"},
+	})
+	if err != nil {
+		t.Fatalf("new columns dataset: %v", err)
+	}
+
+	want := []map[string]any{
+		{"x": 2.0, "ratio": 0.2},
+		{"x": 4.0, "ratio": nil},
+	}
+	for i := 0; cds.Next(); i++ {
+		for name, w := range want[i] {
+			if got := cds.Field(name); got != w {
+				t.Errorf("row %d: got %s %v, want %v", i, name, got, w)
+			}
+		}
+		// a column cannot refer to itself or to a later column, so these
+		// read fields the dataset does not have
+		for _, name := range []string{"loop", "early"} {
+			if _, ok := cds.Field(name).(error); !ok {
+				t.Errorf("row %d: got %s %v, want an error", i, name, cds.Field(name))
+			}
+		}
+	}
+}
+
+func TestNewColumnsDataSetErrors(t *testing.T) {
+	ds := NewStaticDataSet(map[string][]any{"x": {1.0}})
+	for name, defs := range map[string][]ColumnDef{
+		"duplicate": {{Name: "a", Expr: "x"}, {Name: "a", Expr: "x + 1"}},
+		"parse":     {{Name: "a", Expr: "x +"}},
+	} {
+		if _, err := NewColumnsDataSet(ds, defs); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package ashby
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// FacetDef splits the series of a plot into a grid of subplots, one for each
+// value of a field, in the order the values first appear in the data. Each
+// subplot is titled with its value. Tables and scalars are not split and are
+// drawn on the first subplot.
+type FacetDef struct {
+	Field   string    `yaml:"field"`   // the name of the field whose values split the series
+	Columns int       `yaml:"columns"` // number of columns of the grid, defaults to the square root of the number of subplots
+	Axes    FacetAxes `yaml:"axes"`    // the axes shared by the subplots: shared, x, y or independent
+}
+
+// FacetAxes determines which axes of the subplots of a faceted plot share
+// their range.
+type FacetAxes string
+
+const (
+	FacetAxesDefault     FacetAxes = ""            // same as shared
+	FacetAxesShared      FacetAxes = "shared"      // all subplots have the same x and y ranges
+	FacetAxesSharedX     FacetAxes = "x"           // all subplots have the same x range
+	FacetAxesSharedY     FacetAxes = "y"           // all subplots have the same y range
+	FacetAxesIndependent FacetAxes = "independent" // each subplot has its own ranges
+)
+
+func (a FacetAxes) String() string { return string(a) }
+
+func (f *FacetDef) validate(pd *PlotDef) error {
+	if f.Field == "" {
+		return fmt.Errorf("facet must name a field")
+	}
+	if f.Columns < 0 {
+		return fmt.Errorf("facet columns must not be negative: %d", f.Columns)
+	}
+	switch f.Axes {
+	case FacetAxesDefault, FacetAxesShared, FacetAxesSharedX, FacetAxesSharedY, FacetAxesIndependent:
+	default:
+		return fmt.Errorf("unknown facet axes: %q", f.Axes)
+	}
+	if pd.usesSecondaryYaxis() || pd.Layout.Yaxis2 != nil {
+		return fmt.Errorf("faceted plots do not support a secondary y axis")
+	}
+	return nil
+}
+
+func (f *FacetDef) sharesX() bool {
+	return f.Axes == FacetAxesDefault || f.Axes == FacetAxesShared || f.Axes == FacetAxesSharedX
+}
+
+func (f *FacetDef) sharesY() bool {
+	return f.Axes == FacetAxesDefault || f.Axes == FacetAxesShared || f.Axes == FacetAxesSharedY
+}
+
+// facetAxisIDs returns the ids of the x and y axes of the subplot of the
+// facet with index i, as used by traces.
+func facetAxisIDs(i int) (string, string) {
+	if i == 0 {
+		return "x", "y"
+	}
+	return fmt.Sprintf("x%d", i+1), fmt.Sprintf("y%d", i+1)
+}
+
+// setTraceFacet places a trace on the subplot of the facet with index i. The
+// traces of a series are grouped in the legend across facets and only shown
+// in it for the first facet the series appears in. It reports false if the
+// type of trace cannot be placed on a subplot.
+func setTraceFacet(trace grob.Trace, i int, group string, inLegend bool) bool {
+	x, y := facetAxisIDs(i)
+	var show grob.Bool
+	if !inLegend {
+		show = grob.False
+	}
+	switch t := trace.(type) {
+	case *grob.Bar:
+		t.Xaxis, t.Yaxis, t.Legendgroup, t.Showlegend = x, y, group, show
+	case *grob.Scatter:
+		t.Xaxis, t.Yaxis, t.Legendgroup, t.Showlegend = x, y, group, show
+	case *grob.Box:
+		t.Xaxis, t.Yaxis, t.Legendgroup, t.Showlegend = x, y, group, show
+	case *grob.Violin:
+		t.Xaxis, t.Yaxis, t.Legendgroup, t.Showlegend = x, y, group, show
+	case *grob.Candlestick:
+		t.Xaxis, t.Yaxis, t.Legendgroup, t.Showlegend = x, y, group, show
+	default:
+		return false
+	}
+	return true
+}
+
+// applyFacets lays out the subplots of a faceted plot in a grid, adding the
+// axes of each subplot after the first and a title above each. The axes of
+// the first subplot are those of the layout, which the others copy without
+// their titles.
+func applyFacets(fig *grob.Fig, pd *PlotDef) {
+	n := len(pd.facets)
+	if n == 0 {
+		return
+	}
+	cols := pd.Facet.Columns
+	if cols == 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	if cols > n {
+		cols = n
+	}
+	rows := (n + cols - 1) / cols
+	fig.Layout.Grid = &grob.LayoutGrid{
+		Rows:    int64(rows),
+		Columns: int64(cols),
+		Pattern: grob.LayoutGridPatternIndependent,
+	}
+
+	pd.Layout.facetXaxes, pd.Layout.facetYaxes = nil, nil
+	for i := 1; i < n; i++ {
+		var xaxis grob.LayoutXaxis
+		if fig.Layout.Xaxis != nil {
+			xaxis = *fig.Layout.Xaxis
+		}
+		xaxis.Title = nil
+		if pd.Facet.sharesX() {
+			xaxis.Matches = "x"
+		}
+		var yaxis grob.LayoutYaxis
+		if fig.Layout.Yaxis != nil {
+			yaxis = *fig.Layout.Yaxis
+		}
+		yaxis.Title = nil
+		if pd.Facet.sharesY() {
+			yaxis.Matches = "y"
+		}
+		pd.Layout.facetXaxes = append(pd.Layout.facetXaxes, &xaxis)
+		pd.Layout.facetYaxes = append(pd.Layout.facetYaxes, &yaxis)
+	}
+
+	all, _ := fig.Layout.Annotations.([]interface{})
+	for i, value := range pd.facets {
+		x, y := facetAxisIDs(i)
+		all = append(all, PlotAnnotation{
+			RefX:    x + " domain",
+			RefY:    y + " domain",
+			X:       0.5,
+			Y:       1,
+			Text:    value,
+			XAnchor: "center",
+			YAnchor: "bottom",
+		})
+	}
+	fig.Layout.Annotations = all
+}
+
+// MarshalJSON adds the axes of the subplots of a faceted plot to the layout.
+func (l PlotLayout) MarshalJSON() ([]byte, error) {
+	type plotLayout PlotLayout
+	data, err := json.Marshal(plotLayout(l))
+	if err != nil || len(l.facetXaxes) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for i := range l.facetXaxes {
+		x, err := json.Marshal(l.facetXaxes[i])
+		if err != nil {
+			return nil, err
+		}
+		y, err := json.Marshal(l.facetYaxes[i])
+		if err != nil {
+			return nil, err
+		}
+		fields[fmt.Sprintf("xaxis%d", i+2)] = x
+		fields[fmt.Sprintf("yaxis%d", i+2)] = y
+	}
+	return json.Marshal(fields)
+}
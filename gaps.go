@@ -0,0 +1,157 @@
+package ashby
+
+import (
+	"fmt"
+	"time"
+)
+
+// GapMode determines how missing intervals in a time series are plotted.
+type GapMode string
+
+const (
+	GapModeDefault GapMode = ""        // same as connect
+	GapModeConnect GapMode = "connect" // points either side of a gap are joined
+	GapModeBreak   GapMode = "break"   // a null is inserted in each gap so that lines are broken
+	GapModeZero    GapMode = "zero"    // each missing interval is filled with a zero value
+)
+
+func (m GapMode) String() string { return string(m) }
+
+// maxGapPoints limits the number of zero values inserted into a single gap.
+// Larger gaps are broken instead.
+const maxGapPoints = 10000
+
+// timeLabelLayouts are the layouts of labels that are recognized as times.
+var timeLabelLayouts = []string{time.RFC3339, time.DateOnly}
+
+// A gapStep advances a time by the expected interval between the points of a
+// series.
+type gapStep func(time.Time) time.Time
+
+// gapStep returns the expected interval between the points of the series,
+// which is its interval if set, otherwise the frequency of the plot.
+func (s *SeriesDef) gapStep(freq PlotFrequency) (gapStep, error) {
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid series interval: %q", s.Interval)
+		}
+		return func(t time.Time) time.Time { return t.Add(d) }, nil
+	}
+
+	switch freq {
+	case PlotFrequencyHourly:
+		return func(t time.Time) time.Time { return t.Add(time.Hour) }, nil
+	case PlotFrequencyDaily:
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, nil
+	case PlotFrequencyWeekly:
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }, nil
+	case PlotFrequencyMonthly:
+		return func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, nil
+	case PlotFrequencyYearly:
+		return func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }, nil
+	}
+	if d, ok := freq.Interval(); ok {
+		return func(t time.Time) time.Time { return t.Add(d) }, nil
+	}
+	return nil, fmt.Errorf("series gaps require an interval or a plot frequency: %q", freq)
+}
+
+// fillGaps inserts points into the gaps between the time labels of the series
+// according to mode. Two consecutive points are separated by a gap when the
+// later falls more than half an interval after the point expected to follow
+// the earlier. Series whose labels are not all times are left as-is.
+func fillGaps(ls *LabeledSeries, mode GapMode, step gapStep) {
+	if mode != GapModeBreak && mode != GapModeZero || len(ls.Labels) < 2 || len(ls.Labels) != len(ls.Values) {
+		return
+	}
+
+	times := make([]time.Time, len(ls.Labels))
+	layouts := make([]string, len(ls.Labels))
+	for i, l := range ls.Labels {
+		var ok bool
+		times[i], layouts[i], ok = parseTimeLabel(l)
+		if !ok {
+			return
+		}
+	}
+
+	// a missing point is one that is expected before the next actual point
+	missing := func(expected, next time.Time) bool {
+		tolerance := step(expected).Sub(expected) / 2
+		return expected.Add(tolerance).Before(next)
+	}
+
+	labels := make([]any, 0, len(ls.Labels))
+	values := make([]any, 0, len(ls.Values))
+	columns := make(map[string][]any, len(ls.Columns))
+	add := func(label, value any, i int) {
+		labels = append(labels, label)
+		values = append(values, value)
+		for role, col := range ls.Columns {
+			var v any
+			if i >= 0 && i < len(col) {
+				v = col[i]
+			}
+			columns[role] = append(columns[role], v)
+		}
+	}
+
+	for i := range times {
+		add(ls.Labels[i], ls.Values[i], i)
+		if i == len(times)-1 {
+			break
+		}
+
+		expected := step(times[i])
+		if !missing(expected, times[i+1]) {
+			continue
+		}
+
+		fill := mode == GapModeZero
+		if fill {
+			n := 0
+			for t := expected; missing(t, times[i+1]); t = step(t) {
+				if n++; n > maxGapPoints {
+					fill = false
+					break
+				}
+			}
+		}
+		if !fill {
+			add(formatGapTime(expected, layouts[i]), nil, -1)
+			continue
+		}
+		for t := expected; missing(t, times[i+1]); t = step(t) {
+			add(formatGapTime(t, layouts[i]), 0, -1)
+		}
+	}
+
+	ls.Labels, ls.Values = labels, values
+	for role := range ls.Columns {
+		ls.Columns[role] = columns[role]
+	}
+}
+
+// parseTimeLabel parses a time label, returning the layout it was written in.
+func parseTimeLabel(label any) (time.Time, string, bool) {
+	s, ok := label.(string)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	for _, layout := range timeLabelLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// formatGapTime formats a time inserted into a gap in the same way as the
+// labels it is placed between.
+func formatGapTime(t time.Time, layout string) string {
+	if layout == time.RFC3339 {
+		t = t.UTC()
+	}
+	return t.Format(layout)
+}
@@ -1,11 +1,15 @@
-package main
+package ashby
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
@@ -15,28 +19,204 @@ import (
 
 func generateFig(ctx context.Context, pd *PlotDef, cfg *PlotConfig) (*grob.Fig, error) {
 	fig := &grob.Fig{
-		Layout: &pd.Layout,
+		Layout: &pd.Layout.Layout,
 	}
 
-	logger := slog.With("name", pd.Name)
+	logger := LoggerFromContext(ctx)
 
-	dataSets := make(map[string]DataSet)
-	for _, ds := range pd.Datasets {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+	start := time.Now()
+	pd.timing = nil
+	if cfg.Timing {
+		pd.timing = &PlotTiming{}
+	}
+	dataSets, err := buildDataSets(ctx, pd, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := addPreviousDataSets(ctx, pd, cfg, dataSets, logger); err != nil {
+		return nil, err
+	}
+	fetched := time.Now()
+
+	pd.empty = dataSetsEmpty(pd, dataSets)
+	if pd.empty {
+		if pd.OnEmpty == EmptyActionSkip || pd.OnEmpty == EmptyActionError {
+			return nil, ErrEmptyPlot
+		}
+		logger.Info("all datasets are empty, generating placeholder plot")
+	}
+
+	if pd.BarMode != BarModeDefault {
+		fig.Layout.Barmode = grob.LayoutBarmode(pd.BarMode)
+	}
+	applySize(fig, pd)
+
+	if pd.XRange != nil {
+		if err := applyXRange(fig, pd, cfg.BasisTime); err != nil {
+			return nil, err
+		}
+	}
+
+	fig.Data = grob.Traces{}
+
+	pd.plotted = nil
+	pd.export = nil
+	if pd.ExportData {
+		pd.export = NewDataExport()
+	}
+
+	traces, err := seriesTraces(dataSets, pd, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("series traces: %w", err)
+	}
+	fig.Data = append(fig.Data, traces...)
+	applyCategoryOrders(fig, pd, logger)
+	applyAxisFormats(fig, pd)
+	applyFacets(fig, pd)
+
+	traces, err = scalarTraces(dataSets, pd.Scalars, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("scalar traces: %w", err)
+	}
+	fig.Data = append(fig.Data, traces...)
+
+	traces, annotations, err := tableTraces(dataSets, pd.Tables, cfg, pd.export, logger)
+	if err != nil {
+		return nil, fmt.Errorf("table traces: %w", err)
+	}
+	fig.Data = append(fig.Data, traces...)
+
+	if n := sanitizeNonFinite(fig.Data); n > 0 {
+		logger.Warn("replaced values that are not finite numbers with nulls", "count", n)
+	}
+
+	if pd.usesSecondaryYaxis() {
+		// series on each axis are grouped in the legend to show which axis they use
+		for _, trace := range fig.Data {
+			setLegendGroup(trace)
+		}
+		if pd.Layout.Yaxis2 == nil {
+			pd.Layout.Yaxis2 = &grob.LayoutYaxis{}
+		}
+		pd.Layout.Yaxis2.Overlaying = "y"
+		if pd.Layout.Yaxis2.Side == "" {
+			pd.Layout.Yaxis2.Side = grob.LayoutYaxisSideRight
+		}
+	}
+
+	thresholds, labels := thresholdShapes(pd.Thresholds, cfg)
+	if pd.empty {
+		labels = append(labels, emptyAnnotation())
+	}
+
+	if fig.Layout.Annotations == nil && len(pd.Annotations) == 0 && len(labels) == 0 {
+		fig.Layout.Annotations = annotations
+	} else {
+		// annotations from the layout come first, followed by those of tables, the plot and its thresholds
+		all, _ := fig.Layout.Annotations.([]interface{})
+		for _, a := range annotations {
+			all = append(all, a)
+		}
+		all = append(all, plotAnnotations(pd.Annotations, cfg)...)
+		fig.Layout.Annotations = append(all, labels...)
+	}
+
+	if len(pd.Shapes) > 0 {
+		all, _ := fig.Layout.Shapes.([]interface{})
+		fig.Layout.Shapes = append(all, plotShapes(pd.Shapes, cfg)...)
+	}
+	if len(thresholds) > 0 {
+		all, _ := fig.Layout.Shapes.([]interface{})
+		fig.Layout.Shapes = append(all, thresholds...)
+	}
+
+	if pd.timing != nil {
+		pd.timing.Fetch = fetched.Sub(start).Seconds()
+		pd.timing.Render = time.Since(fetched).Seconds()
+		setTimingMeta(&pd.Layout, pd.timing)
+		pd.timing.log(logger)
+	}
+
+	// keep the layout before the theme is applied so that variants can be
+	// styled with other themes
+	pd.unthemed = pd.Layout.clone()
+	if pd.Theme != "" {
+		theme, ok := cfg.Themes[pd.Theme]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme: %q", pd.Theme)
+		}
+		theme.Apply(&pd.Layout, cfg)
+	}
+
+	return fig, nil
+}
+
+// buildDataSets runs the dataset queries of the plot definition as of the
+// basis time of cfg and derives its computed columns, joined and computed
+// datasets, returning all of them by name.
+func buildDataSets(ctx context.Context, pd *PlotDef, cfg *PlotConfig, logger *slog.Logger) (map[string]DataSet, error) {
+	for _, dsd := range pd.Datasets {
+		if dsd.QueryFile != "" && pd.queryFS == nil {
+			return nil, fmt.Errorf("dataset %q: query file %q was not loaded", dsd.Name, dsd.QueryFile)
+		}
+	}
+	remapSources(pd, cfg, logger)
+	ctx = WithQueryBasis(ctx, QueryBasis{Time: cfg.BasisTime, Frequency: pd.Frequency, Location: pd.location, WeekStart: pd.StartOfWeek()})
+	if cfg.MaxRows > 0 {
+		ctx = WithRowLimit(ctx, cfg.MaxRows)
+	}
+	dataSets, err := fetchDataSets(ctx, pd, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dsd := range pd.Datasets {
+		ds, ok := dataSets[dsd.Name]
+		if !ok {
+			continue
 		}
-		src, exists := cfg.Sources[ds.Source]
-		if !exists {
-			return nil, fmt.Errorf("unknown dataset source: %q", ds.Source)
+		if len(dsd.Types) > 0 {
+			if ds, err = coerceDataSet(ds, dsd.Types); err != nil {
+				return nil, fmt.Errorf("dataset %q: %w", dsd.Name, err)
+			}
 		}
-		var err error
-		logger.Debug("getting dataset", "dataset", ds.Name, "source", ds.Source, "query", stripNewlines(ds.Query))
-		dataSets[ds.Name], err = src.GetDataSet(ctx, ds.Query)
+		if len(dsd.Columns) > 0 {
+			if ds, err = NewColumnsDataSet(ds, dsd.Columns); err != nil {
+				return nil, fmt.Errorf("dataset %q: %w", dsd.Name, err)
+			}
+		}
+		if len(dsd.OrderBy) > 0 || dsd.Limit > 0 {
+			if ds, err = orderDataSet(ds, dsd.OrderBy, dsd.Limit); err != nil {
+				return nil, fmt.Errorf("dataset %q: %w", dsd.Name, err)
+			}
+		}
+		dataSets[dsd.Name] = ds
+	}
+
+	for _, jd := range pd.Joins {
+		if _, exists := dataSets[jd.Name]; exists {
+			return nil, fmt.Errorf("joined dataset name conflicts with existing dataset: %q", jd.Name)
+		}
+		left, ok := dataSets[jd.Left.DataSet]
+		if !ok {
+			return nil, fmt.Errorf("unknown dataset in joined dataset %q: %q", jd.Name, jd.Left.DataSet)
+		}
+		right, ok := dataSets[jd.Right.DataSet]
+		if !ok {
+			return nil, fmt.Errorf("unknown dataset in joined dataset %q: %q", jd.Name, jd.Right.DataSet)
+		}
+
+		logger.Debug("joining datasets", "joined", jd.Name, "type", jd.Type, "left", jd.Left.DataSet, "right", jd.Right.DataSet)
+		ds, err := joinDataSets(jd, left, right)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get dataset from source %q: %w", ds.Source, err)
+			return nil, fmt.Errorf("failed to join dataset %q: %w", jd.Name, err)
+		}
+		if len(jd.Columns) > 0 {
+			if ds, err = NewColumnsDataSet(ds, jd.Columns); err != nil {
+				return nil, fmt.Errorf("joined dataset %q: %w", jd.Name, err)
+			}
 		}
+		dataSets[jd.Name] = ds
 	}
 
 	for _, cds := range pd.Computed {
@@ -72,34 +252,141 @@ func generateFig(ctx context.Context, pd *PlotDef, cfg *PlotConfig) (*grob.Fig,
 		}
 
 	}
+	return dataSets, nil
+}
 
-	fig.Data = grob.Traces{}
+// remapSources replaces the datasources of the dataset definitions with those
+// they are remapped to by the config. Each remapping is logged so that the
+// backend actually queried is known.
+func remapSources(pd *PlotDef, cfg *PlotConfig, logger *slog.Logger) {
+	for i, ds := range pd.Datasets {
+		to, ok := cfg.SourceMap[ds.Source]
+		if !ok {
+			continue
+		}
+		logger.Info("remapping dataset source", "dataset", ds.Name, "from", ds.Source, "to", to)
+		pd.Datasets[i].Source = to
+	}
+}
 
-	traces, err := seriesTraces(dataSets, pd.Series, cfg, logger)
-	if err != nil {
-		return nil, fmt.Errorf("series traces: %w", err)
+// fetchDataSets runs the queries for the dataset definitions concurrently,
+// bounded by the configured query concurrency. Errors from all failed queries
+// are reported together, in definition order.
+func fetchDataSets(ctx context.Context, pd *PlotDef, cfg *PlotConfig, logger *slog.Logger) (map[string]DataSet, error) {
+	defs := pd.Datasets
+	for _, ds := range defs {
+		if _, exists := cfg.Sources[ds.Source]; !exists {
+			return nil, fmt.Errorf("dataset %q: unknown dataset source: %q", ds.Name, ds.Source)
+		}
 	}
-	fig.Data = append(fig.Data, traces...)
 
-	traces, err = scalarTraces(dataSets, pd.Scalars, cfg, logger)
-	if err != nil {
-		return nil, fmt.Errorf("scalar traces: %w", err)
+	concurrency := cfg.QueryConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
 	}
-	fig.Data = append(fig.Data, traces...)
 
-	traces, annotations, err := tableTraces(dataSets, pd.Tables, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("table traces: %w", err)
+	results := make([]DataSet, len(defs))
+	durations := make([]time.Duration, len(defs))
+	errs := make([]error, len(defs))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, ds := range defs {
+		i, ds := i, ds
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			timeout := cfg.QueryTimeout
+			if pd.QueryTimeout > 0 {
+				timeout = pd.QueryTimeout
+			}
+
+			// cancelling the context cancels the query in the datasource's driver
+			qctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				qctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			src := cfg.Sources[ds.Source]
+			query, args, err := bindQuery(ds.Query, cfg.TemplateParams)
+			if err == nil && len(args) > 0 && !bindsParams(src) {
+				err = fmt.Errorf("datasource does not support bound params")
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to bind params of dataset %q for source %q: %w", ds.Name, ds.Source, err)
+				return
+			}
+			if len(ds.Setup) > 0 {
+				if !runsSetup(src) {
+					errs[i] = fmt.Errorf("dataset %q: source %q does not support setup statements", ds.Name, ds.Source)
+					return
+				}
+				qctx = WithSetup(qctx, ds.Setup)
+			}
+			if agg := pd.rowAggregation(ds.Name); agg != nil {
+				qctx = WithRowAggregation(qctx, agg)
+			}
+
+			logger.Debug("getting dataset", "dataset", ds.Name, "source", ds.Source, "query", redactSecrets(stripNewlines(query)), "bound", len(args), "setup", len(ds.Setup))
+			start := time.Now()
+			err = cfg.Retry.Do(qctx, transientClassifier(src), func(ctx context.Context) error {
+				var err error
+				results[i], err = src.GetDataSet(ctx, query, args...)
+				return err
+			})
+			durations[i] = time.Since(start)
+			runMetrics.observeQuery(ds.Source, durations[i], err)
+			if err != nil {
+				if ctx.Err() == nil && errors.Is(qctx.Err(), context.DeadlineExceeded) {
+					err = &QueryTimeoutError{Plot: pd.Name, Dataset: ds.Name, Timeout: timeout, Err: err}
+				}
+				errs[i] = fmt.Errorf("failed to get dataset %q from source %q: %w", ds.Name, ds.Source, err)
+				return
+			}
+			logger.Debug("got dataset", "dataset", ds.Name, "source", ds.Source, "duration", time.Since(start))
+		}()
 	}
-	fig.Data = append(fig.Data, traces...)
+	wg.Wait()
 
-	if fig.Layout.Annotations == nil {
-		fig.Layout.Annotations = annotations
-	} else if existingAnnotations, ok := fig.Layout.Annotations.([]interface{}); ok {
-		fig.Layout.Annotations = append(existingAnnotations, annotations)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
 
-	return fig, nil
+	dataSets := make(map[string]DataSet, len(defs))
+	for i, ds := range defs {
+		dataSets[ds.Name] = results[i]
+		if pd.timing != nil {
+			pd.timing.addQuery(ds.Name, ds.Source, durations[i])
+		}
+	}
+	return dataSets, nil
+}
+
+// QueryTimeoutError is returned when a dataset query is cancelled because it
+// ran for longer than its timeout.
+type QueryTimeoutError struct {
+	Plot    string
+	Dataset string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *QueryTimeoutError) Error() string {
+	return fmt.Sprintf("query for dataset %q of plot %q timed out after %s: %v", e.Dataset, e.Plot, e.Timeout, e.Err)
+}
+
+func (e *QueryTimeoutError) Unwrap() error {
+	return e.Err
 }
 
 type Annotation struct {
@@ -117,17 +404,30 @@ type LabeledSeries struct {
 	SeriesDef *SeriesDef
 	Labels    []any
 	Values    []any
+	Columns   map[string][]any // values of other fields used by the series, keyed by role
+	facet     int              // index of the subplot of a faceted plot the series is drawn on
 }
 
-func seriesTraces(dataSets map[string]DataSet, seriesDefs []SeriesDef, cfg *PlotConfig, logger *slog.Logger) ([]grob.Trace, error) {
+func seriesTraces(dataSets map[string]DataSet, pd *PlotDef, cfg *PlotConfig, logger *slog.Logger) ([]grob.Trace, error) {
 	var traces []grob.Trace
+	previous, err := previousSeriesDefs(pd)
+	if err != nil {
+		return nil, err
+	}
+	seriesDefs := append(append([]SeriesDef(nil), pd.Series...), previous...)
 
+	// datasets are read in the order they are first used so that the series
+	// and facets read from them are created in the same order on every run
 	seriesByDataSet := make(map[string][]SeriesDef)
+	var dsnames []string
 	for i, s := range seriesDefs {
 		if _, ok := dataSets[s.DataSet]; !ok {
 			logger.Error(fmt.Sprintf("unknown dataset name %q in series %d", s.DataSet, i))
 			continue
 		}
+		if _, seen := seriesByDataSet[s.DataSet]; !seen {
+			dsnames = append(dsnames, s.DataSet)
+		}
 		seriesByDataSet[s.DataSet] = append(seriesByDataSet[s.DataSet], s)
 	}
 
@@ -135,16 +435,31 @@ func seriesTraces(dataSets map[string]DataSet, seriesDefs []SeriesDef, cfg *Plot
 	data := make([]*LabeledSeries, 0)
 	dataIndex := make(map[string]*LabeledSeries)
 
+	// index of the subplot of each value of the facet field
+	pd.facets = nil
+	facetIndex := make(map[string]int)
+
 	// if series are generated from a groupfield then it uses that ordering
-	for dsname, series := range seriesByDataSet {
-		ds := dataSets[dsname]
+	for _, dsname := range dsnames {
+		series, ds := seriesByDataSet[dsname], dataSets[dsname]
+
+		hovers := make([]*template.Template, len(series))
+		for i := range series {
+			var err error
+			if hovers[i], err = series[i].rowHoverTemplate(); err != nil {
+				return nil, fmt.Errorf("series %q: %w", series[i].Name, err)
+			}
+		}
+		// the fields of the row that hover templates may reference
+		fields, _ := fieldNames(ds)
+		counted := countedDataSet(ds)
 
 		logger.Info("reading dataset", "dataset", dsname)
 		ds.ResetIterator()
 		rowcount := 0
 		for ds.Next() {
 			rowcount++
-			for _, s := range series {
+			for i, s := range series {
 				s := s
 				name := s.Name
 				if s.GroupField != "" {
@@ -158,25 +473,81 @@ func seriesTraces(dataSets map[string]DataSet, seriesDefs []SeriesDef, cfg *Plot
 						continue
 					}
 				}
+				if s.previous != nil {
+					if name != "" {
+						name = fmt.Sprintf("%s (%s)", name, s.previous.label)
+					} else {
+						name = s.previous.label
+					}
+				}
 
-				ls, ok := dataIndex[name]
+				key, facet := name, 0
+				if pd.Facet != nil {
+					v := ds.Field(pd.Facet.Field)
+					if _, isErr := v.(error); isErr {
+						return nil, fmt.Errorf("plot %q: facet field %q not found in dataset %q", pd.Name, pd.Facet.Field, dsname)
+					}
+					value := stringify(normalizeValue(v))
+					i, ok := facetIndex[value]
+					if !ok {
+						i = len(pd.facets)
+						facetIndex[value] = i
+						pd.facets = append(pd.facets, value)
+					}
+					key, facet = fmt.Sprintf("%s\x00%d", name, i), i
+				}
+
+				ls, ok := dataIndex[key]
 				if !ok {
 					logger.Debug("creating series", "dataset", dsname, "series", name)
 					ls = &LabeledSeries{
 						Name:      name,
 						SeriesDef: &s,
+						facet:     facet,
 					}
 					data = append(data, ls)
-					dataIndex[ls.Name] = ls
+					dataIndex[key] = ls
 				}
 				if s.Labels != "" {
 					ls.Labels = append(ls.Labels, normalizeValue(ds.Field(s.Labels)))
 				}
-				ls.Values = append(ls.Values, normalizeValue(ds.Field(s.Values)))
+				if s.Values != "" {
+					ls.Values = append(ls.Values, normalizeValue(ds.Field(s.Values)))
+				}
+				if counted {
+					if ls.Columns == nil {
+						ls.Columns = make(map[string][]any)
+					}
+					ls.Columns[binCountField] = append(ls.Columns[binCountField], ds.Field(binCountField))
+				}
+				for role, field := range s.columnFields() {
+					if ls.Columns == nil {
+						ls.Columns = make(map[string][]any)
+					}
+					v := ds.Field(field)
+					if _, isErr := v.(error); isErr {
+						return nil, fmt.Errorf("plot %q: series %q: field %q not found in dataset %q", pd.Name, name, field, dsname)
+					}
+					ls.Columns[role] = append(ls.Columns[role], normalizeValue(v))
+				}
+				if hovers[i] != nil {
+					if ls.Columns == nil {
+						ls.Columns = make(map[string][]any)
+					}
+					rowFields := fields
+					if rowFields == nil {
+						rowFields = []string{s.Labels, s.Values}
+					}
+					text, err := executeHoverTemplate(hovers[i], ds, rowFields)
+					if err != nil {
+						return nil, fmt.Errorf("plot %q: series %q: %w", pd.Name, name, err)
+					}
+					ls.Columns[hoverColumn] = append(ls.Columns[hoverColumn], text)
+				}
 			}
 		}
 		if ds.Err() != nil {
-			return nil, fmt.Errorf("dataset iteration ended with an error: %w", ds.Err())
+			return nil, fmt.Errorf("dataset %q: iteration ended with an error: %w", dsname, ds.Err())
 		}
 		logger.Info("finished reading dataset", "dataset", dsname, "rowcount", rowcount)
 	}
@@ -185,139 +556,285 @@ func seriesTraces(dataSets map[string]DataSet, seriesDefs []SeriesDef, cfg *Plot
 		if data[i].SeriesDef.order != data[j].SeriesDef.order {
 			return data[i].SeriesDef.order < data[j].SeriesDef.order
 		}
-		return data[i].Name < data[j].Name
+		if data[i].Name != data[j].Name {
+			return data[i].Name < data[j].Name
+		}
+		return data[i].facet < data[j].facet
 	})
 
-	for _, ls := range data {
-		ls := ls
-		visible := true
-		if ls.SeriesDef.Visible != nil {
-			visible = *ls.SeriesDef.Visible
+	if pd.NonPositive != NonPositiveModeKeep {
+		logAxes := pd.logAxes()
+		for _, ls := range data {
+			guardValues, guardLabels := logAxes[ls.SeriesDef.valueAxis()], logAxes[ls.SeriesDef.labelAxis()]
+			if guardValues || guardLabels {
+				guardLogValues(ls, guardValues, guardLabels, pd.NonPositive, pd.ClampValue)
+			}
 		}
+	}
 
-		switch ls.SeriesDef.Type {
-		case SeriesTypeBar:
-			trace := &grob.Bar{
-				Type:          grob.TraceTypeBar,
-				Name:          ls.Name,
-				Orientation:   grob.BarOrientationV,
-				X:             ls.Labels,
-				Y:             ls.Values,
-				Hovertemplate: ls.SeriesDef.HoverTemplate,
-				Visible:       visible,
-				Yaxis:         ls.SeriesDef.Yaxis,
+	for _, ls := range data {
+		if ls.SeriesDef.previous != nil {
+			shiftLabels(ls, ls.SeriesDef.previous.shift)
+		}
+		switch ls.SeriesDef.Gaps {
+		case GapModeBreak, GapModeZero:
+			step, err := ls.SeriesDef.gapStep(pd.Frequency)
+			if err != nil {
+				return nil, fmt.Errorf("series %q: %w", ls.Name, err)
 			}
+			fillGaps(ls, ls.SeriesDef.Gaps, step)
+		}
+		if ls.SeriesDef.Cumulative != nil {
+			cumulate(ls)
+		}
+	}
 
-			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker = &grob.BarMarker{
-					Color: c,
-				}
-			}
+	// series are normalized together, so before any is downsampled
+	normalizePercent(data)
 
-			traces = append(traces, trace)
-		case SeriesTypeHBar:
-			trace := &grob.Bar{
-				Type:        grob.TraceTypeBar,
-				Name:        ls.Name,
-				Orientation: grob.BarOrientationH,
-				X:           ls.Values,
-				Y:           ls.Labels,
-				Visible:     visible,
-				Yaxis:       ls.SeriesDef.Yaxis,
-			}
-			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker = &grob.BarMarker{
-					Color: c,
-				}
+	for _, ls := range data {
+		if ls.SeriesDef.Downsample != nil {
+			before := len(ls.Values)
+			downsample(ls, ls.SeriesDef.Downsample)
+			if len(ls.Values) < before {
+				logger.Debug("downsampled series", "series", ls.Name, "points", before, "downsampled", len(ls.Values))
 			}
+		}
+	}
 
-			traces = append(traces, trace)
-		case SeriesTypeLine:
-			trace := &grob.Scatter{
-				Type:    grob.TraceTypeScatter,
-				Name:    ls.Name,
-				X:       ls.Labels,
-				Y:       ls.Values,
-				Mode:    "lines",
-				Marker:  &grob.ScatterMarker{},
-				Visible: visible,
-				Yaxis:   ls.SeriesDef.Yaxis,
-			}
+	inLegend := make(map[string]bool)
+	for _, ls := range data {
+		ls := ls
+		first := len(traces)
+		visible := ls.SeriesDef.Visible.traceValue()
 
-			if ls.SeriesDef.Fill == FillTypeToZero {
-				trace.Fill = "tozeroy"
-			}
+		pd.export.AddSeries(ls)
+		pd.plotted = append(pd.plotted, plottedSeries{series: ls, color: cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name)})
 
-			if ls.SeriesDef.Marker != MarkerTypeNone {
-				trace.Mode = "lines+markers"
-				trace.Marker.Symbol = ls.SeriesDef.Marker
-			}
+		build, ok := plotBuilder(ls.SeriesDef.Type)
+		if !ok {
+			return nil, fmt.Errorf("unsupported series type: %s", ls.SeriesDef.Type)
+		}
+		built, err := build(ls, PlotBuild{Plot: pd, Config: cfg, Visible: visible})
+		if err != nil {
+			return nil, fmt.Errorf("series %q: %w", ls.Name, err)
+		}
+		for i, trace := range built {
+			highlightThresholds(trace, ls, pd, cfg, len(traces)+i)
+		}
+		traces = append(traces, built...)
 
+		if ls.SeriesDef.MovingAverage != nil {
+			trace := movingAverageTrace(ls)
 			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker.Color = c
+				trace.Line.Color = c
 			}
+			pd.export.AddOverlay(trace, ls)
 			traces = append(traces, trace)
-		case SeriesTypeScatter:
-			trace := &grob.Scatter{
-				Type: grob.TraceTypeScatter,
-				Name: ls.Name,
-				X:    ls.Labels,
-				Y:    ls.Values,
-				Mode: "markers",
-				Marker: &grob.ScatterMarker{
-					Symbol: MarkerTypeCircle,
-				},
-				Visible: visible,
-				Yaxis:   ls.SeriesDef.Yaxis,
-			}
+		}
 
-			if ls.SeriesDef.Fill == FillTypeToZero {
-				trace.Fill = "tozeroy"
+		if ls.SeriesDef.Trendline != "" {
+			spec, err := parseTrendline(ls.SeriesDef.Trendline)
+			if err != nil {
+				return nil, err
+			}
+			trace, err := trendlineTrace(ls, spec)
+			if err != nil {
+				return nil, fmt.Errorf("trendline for series %q: %w", ls.Name, err)
 			}
-
 			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker.Color = c
+				trace.Line.Color = c
 			}
-
+			pd.export.AddOverlay(trace, ls)
 			traces = append(traces, trace)
-		case SeriesTypeBox:
-			trace := &grob.Box{
-				Type:    grob.TraceTypeBox,
-				Name:    ls.Name,
-				Y:       ls.Values,
-				Visible: visible,
-				Yaxis:   ls.SeriesDef.Yaxis,
-			}
+		}
 
-			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker = &grob.BoxMarker{
-					Color: c,
+		if ls.SeriesDef.previous != nil {
+			for _, trace := range traces[first:] {
+				if !setTraceOpacity(trace, ls.SeriesDef.previous.opacity) {
+					return nil, fmt.Errorf("series %q: %s series cannot be compared with an earlier period", ls.Name, ls.SeriesDef.Type)
 				}
 			}
-			traces = append(traces, trace)
-		case SeriesTypeHBox:
-			trace := &grob.Box{
-				Type:    grob.TraceTypeBox,
-				Name:    ls.Name,
-				X:       ls.Values,
-				Visible: visible,
-				Yaxis:   ls.SeriesDef.Yaxis,
+		}
+
+		if pd.Facet != nil {
+			for _, trace := range traces[first:] {
+				if !setTraceFacet(trace, ls.facet, ls.Name, !inLegend[ls.Name]) {
+					return nil, fmt.Errorf("series %q: %s series cannot be faceted", ls.Name, ls.SeriesDef.Type)
+				}
 			}
+			inLegend[ls.Name] = true
+		}
 
-			if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
-				trace.Marker = &grob.BoxMarker{
-					Color: c,
+		if ls.SeriesDef.LegendGroup != "" {
+			for _, trace := range traces[first:] {
+				if group := traceLegendGroup(trace); group != nil {
+					*group = grob.String(ls.SeriesDef.LegendGroup)
 				}
 			}
-			traces = append(traces, trace)
-		default:
-			return nil, fmt.Errorf("unsupported series type: %s", ls.SeriesDef.Type)
 		}
 	}
 
 	return traces, nil
 }
 
+// pieTrace is a pie trace that can pull out individual slices, which grob
+// does not support.
+type pieTrace struct {
+	*grob.Pie
+	Pull []float64 `json:"pull,omitempty"`
+}
+
+// errorBars returns the data of the error bars of a series in the given
+// direction, reporting false if it has none.
+func errorBars(ls *LabeledSeries, dir string) (array, arrayminus any, symmetric, visible grob.Bool, ok bool) {
+	def := ls.SeriesDef.ErrorY
+	if dir == "x" {
+		def = ls.SeriesDef.ErrorX
+	}
+	if def == nil {
+		return nil, nil, nil, nil, false
+	}
+
+	array, symmetric, visible = ls.Columns["error_"+dir], grob.True, grob.True
+	if minus, ok := ls.Columns["error_"+dir+"_minus"]; ok {
+		arrayminus, symmetric = minus, grob.False
+	}
+	if def.Visible != nil && !*def.Visible {
+		visible = grob.False
+	}
+	return array, arrayminus, symmetric, visible, true
+}
+
+func barErrorBars(ls *LabeledSeries) (*grob.BarErrorX, *grob.BarErrorY) {
+	var ex *grob.BarErrorX
+	var ey *grob.BarErrorY
+	if array, minus, sym, vis, ok := errorBars(ls, "x"); ok {
+		ex = &grob.BarErrorX{Type: grob.BarErrorXTypeData, Array: array, Arrayminus: minus, Symmetric: sym, Visible: vis}
+	}
+	if array, minus, sym, vis, ok := errorBars(ls, "y"); ok {
+		ey = &grob.BarErrorY{Type: grob.BarErrorYTypeData, Array: array, Arrayminus: minus, Symmetric: sym, Visible: vis}
+	}
+	return ex, ey
+}
+
+func scatterErrorBars(ls *LabeledSeries) (*grob.ScatterErrorX, *grob.ScatterErrorY) {
+	var ex *grob.ScatterErrorX
+	var ey *grob.ScatterErrorY
+	if array, minus, sym, vis, ok := errorBars(ls, "x"); ok {
+		ex = &grob.ScatterErrorX{Type: grob.ScatterErrorXTypeData, Array: array, Arrayminus: minus, Symmetric: sym, Visible: vis}
+	}
+	if array, minus, sym, vis, ok := errorBars(ls, "y"); ok {
+		ey = &grob.ScatterErrorY{Type: grob.ScatterErrorYTypeData, Array: array, Arrayminus: minus, Symmetric: sym, Visible: vis}
+	}
+	return ex, ey
+}
+
+// usesSecondaryYaxis reports whether any series or table of the plot is
+// plotted against the secondary y axis.
+func (pd *PlotDef) usesSecondaryYaxis() bool {
+	for _, s := range pd.Series {
+		if s.Yaxis == "y2" {
+			return true
+		}
+	}
+	for _, t := range pd.Tables {
+		if t.Yaxis == "y2" {
+			return true
+		}
+	}
+	return false
+}
+
+// applySize sets the width and height of the layout from the plot
+// definition. A responsive plot has no fixed dimensions and is given the
+// plotly config that resizes it with its container, while its images keep the
+// dimensions it would otherwise have had.
+func applySize(fig *grob.Fig, pd *PlotDef) {
+	if pd.Width > 0 {
+		fig.Layout.Width = float64(pd.Width)
+	}
+	if pd.Height > 0 {
+		fig.Layout.Height = float64(pd.Height)
+	}
+	pd.imageWidth, pd.imageHeight = 0, 0
+	if !pd.Responsive {
+		return
+	}
+
+	pd.imageWidth, pd.imageHeight = int(fig.Layout.Width), int(fig.Layout.Height)
+	fig.Layout.Width, fig.Layout.Height = 0, 0
+	fig.Layout.Autosize = grob.True
+	config := make(map[string]any, len(pd.Config)+1)
+	for k, v := range pd.Config {
+		config[k] = v
+	}
+	config["responsive"] = true
+	pd.Config = config
+}
+
+// setLegendGroup assigns a trace to a legend group named after its y axis,
+// unless its series names a legend group.
+func setLegendGroup(trace grob.Trace) {
+	var yaxis grob.String
+	switch t := trace.(type) {
+	case *grob.Bar:
+		yaxis = t.Yaxis
+	case *grob.Scatter:
+		yaxis = t.Yaxis
+	case *grob.Box:
+		yaxis = t.Yaxis
+	case *grob.Violin:
+		yaxis = t.Yaxis
+	case *grob.Candlestick:
+		yaxis = t.Yaxis
+	case *grob.Heatmap:
+		yaxis = t.Yaxis
+	}
+	group := traceLegendGroup(trace)
+	if group == nil || *group != nil && *group != "" {
+		return
+	}
+	if yaxis == nil || yaxis == "" {
+		yaxis = "y"
+	}
+	*group = yaxis
+}
+
+// traceLegendGroup returns the legend group of the trace, or nil if the type
+// of trace cannot be grouped.
+func traceLegendGroup(trace grob.Trace) *grob.String {
+	switch t := trace.(type) {
+	case *grob.Bar:
+		return &t.Legendgroup
+	case *grob.Scatter:
+		return &t.Legendgroup
+	case *grob.Box:
+		return &t.Legendgroup
+	case *grob.Violin:
+		return &t.Legendgroup
+	case *grob.Candlestick:
+		return &t.Legendgroup
+	case *grob.Heatmap:
+		return &t.Legendgroup
+	default:
+		return nil
+	}
+}
+
+// pointsMode converts the points option of a box or violin series to the
+// value plotly expects, where none is represented by false.
+func pointsMode(points string) any {
+	switch points {
+	case "":
+		return nil
+	case "none":
+		return false
+	default:
+		return points
+	}
+}
+
 func scalarTraces(dataSets map[string]DataSet, scalarDefs []ScalarDef, cfg *PlotConfig, logger *slog.Logger) ([]grob.Trace, error) {
 	// work out which dataset fields need to be read
 	datasetFieldsUsed := make(map[string][]string)
@@ -541,14 +1058,25 @@ func (lt LabeledTable) Annotations() []Annotation {
 	return annotations
 }
 
-func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotConfig) ([]grob.Trace, []Annotation, error) {
+func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotConfig, export *DataExport, logger *slog.Logger) ([]grob.Trace, []Annotation, error) {
 	var traces []grob.Trace
 	var annotations []Annotation
 
 	tablesByDataSet := make(map[string][]TableDef)
 	for i, t := range tablesDefs {
+		t := t
 		if _, ok := dataSets[t.DataSet]; !ok {
-			slog.Error(fmt.Sprintf("unknown dataset name %q in table %d", t.DataSet, i))
+			logger.Error(fmt.Sprintf("unknown dataset name %q in table %d", t.DataSet, i))
+			continue
+		}
+		// binned heatmaps make their own pass over the dataset
+		if t.Type == TableTypeHeatmap && t.Bins != nil {
+			trace, err := binnedHeatmapTrace(dataSets[t.DataSet], &t)
+			if err != nil {
+				return nil, nil, fmt.Errorf("heatmap %q: %w", t.Name, err)
+			}
+			export.AddBinnedHeatmap(trace, &t)
+			traces = append(traces, trace)
 			continue
 		}
 		tablesByDataSet[t.DataSet] = append(tablesByDataSet[t.DataSet], t)
@@ -560,7 +1088,7 @@ func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotCo
 		data := make([]*LabeledTable, 0)
 		dataIndex := make(map[string]*LabeledTable)
 
-		slog.Info("reading dataset", "name", dsname)
+		logger.Info("reading dataset", "name", dsname)
 		ds.ResetIterator()
 		for ds.Next() {
 			for _, table := range tables {
@@ -569,7 +1097,7 @@ func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotCo
 
 				lt, ok := dataIndex[name]
 				if !ok {
-					slog.Debug("creating table", "table", name)
+					logger.Debug("creating table", "table", name)
 					lt = &LabeledTable{
 						Name:         name,
 						TableDef:     &table,
@@ -597,14 +1125,14 @@ func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotCo
 				}
 
 				if _, found := lt.Values[labelX][labelY]; found {
-					return nil, nil, fmt.Errorf("found two values for %s/%s", labelX, labelY)
+					return nil, nil, fmt.Errorf("table %q: found two values for %s/%s in dataset %q", name, labelX, labelY, dsname)
 				}
 
 				lt.Values[labelX][labelY] = valueZ
 			}
 		}
 		if ds.Err() != nil {
-			return nil, nil, fmt.Errorf("dataset iteration ended with an error: %w", ds.Err())
+			return nil, nil, fmt.Errorf("dataset %q: iteration ended with an error: %w", dsname, ds.Err())
 		}
 
 		sort.Slice(data, func(i, j int) bool {
@@ -616,17 +1144,22 @@ func tableTraces(dataSets map[string]DataSet, tablesDefs []TableDef, cfg *PlotCo
 
 		for _, lt := range data {
 			lt := lt
+			export.AddTable(lt)
 
 			reverseScale := true
 			switch lt.TableDef.Type {
 			case TableTypeHeatmap:
+				colorscale := lt.TableDef.Colorscale
+				if colorscale == "" {
+					colorscale = "Viridis"
+				}
 				trace := &grob.Heatmap{
 					Type:         grob.TraceTypeHeatmap,
 					Name:         lt.Name,
 					X:            lt.LabelsX,
 					Y:            lt.LabelsY,
 					Z:            lt.ValueZ(),
-					Colorscale:   "Viridis",
+					Colorscale:   colorscale,
 					Colorbar:     lt.TableDef.Colorbar,
 					Reversescale: grob.Bool(&reverseScale),
 					Yaxis:        lt.TableDef.Yaxis,
@@ -0,0 +1,57 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestBarModeLayout(t *testing.T) {
+	for _, mode := range []BarMode{BarModeGroup, BarModeStack, BarModeRelative} {
+		t.Run(string(mode), func(t *testing.T) {
+			pd, err := parsePlotDef("bars", []byte(fmt.Sprintf(`
+name: bars
+barmode: %s
+datasets:
+  - name: d
+    source: static
+    query: '{"x": ["a", "b"], "y": [1, -2], "z": [3, 4]}'
+series:
+  - type: bar
+    dataset: d
+    labels: x
+    values: y
+  - type: bar
+    dataset: d
+    labels: x
+    values: z
+`, mode)), nil)
+			if err != nil {
+				t.Fatalf("parse plot definition: %v", err)
+			}
+
+			cfg := &PlotConfig{Sources: map[string]DataSource{"static": &StaticDataSource{}}}
+			fig, err := generateFig(context.Background(), pd, cfg)
+			if err != nil {
+				t.Fatalf("generate figure: %v", err)
+			}
+			data, err := json.Marshal(fig)
+			if err != nil {
+				t.Fatalf("marshal figure: %v", err)
+			}
+
+			var out struct {
+				Layout struct {
+					Barmode string `json:"barmode"`
+				} `json:"layout"`
+			}
+			if err := json.Unmarshal(data, &out); err != nil {
+				t.Fatalf("unmarshal figure: %v", err)
+			}
+			if out.Layout.Barmode != string(mode) {
+				t.Errorf("got layout.barmode %q, want %q", out.Layout.Barmode, mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// HeatmapBinsDef configures the binning of the x and y fields of a heatmap
+// table into a grid of counts. For each axis either a number of equal width
+// bins spanning the range of the data or explicit bin edges may be given.
+type HeatmapBinsDef struct {
+	X      int       `yaml:"x"`      // number of bins along the x axis, defaults to 20
+	Y      int       `yaml:"y"`      // number of bins along the y axis, defaults to 20
+	XEdges []float64 `yaml:"xEdges"` // optional ascending edges of the x bins, overrides x
+	YEdges []float64 `yaml:"yEdges"` // optional ascending edges of the y bins, overrides y
+}
+
+// binnedHeatmapTrace counts the x and y fields of the rows of ds into a grid
+// of bins, so that the emitted trace is bounded by the number of bins rather
+// than the number of rows. Rows are not retained: when bin edges are not
+// given the range of the data is found in a separate pass.
+func binnedHeatmapTrace(ds DataSet, table *TableDef) (*grob.Heatmap, error) {
+	point := func() (float64, float64, bool) {
+		x, xok := numericValue(ds.Field(table.LabelsX))
+		y, yok := numericValue(ds.Field(table.LabelsY))
+		return x, y, xok && yok && !math.IsNaN(x) && !math.IsNaN(y)
+	}
+
+	xr, yr := newValueRange(), newValueRange()
+	if len(table.Bins.XEdges) == 0 || len(table.Bins.YEdges) == 0 {
+		ds.ResetIterator()
+		for ds.Next() {
+			if x, y, ok := point(); ok {
+				xr.Add(x)
+				yr.Add(y)
+			}
+		}
+		if ds.Err() != nil {
+			return nil, fmt.Errorf("dataset iteration ended with an error: %w", ds.Err())
+		}
+	}
+
+	xEdges, err := binEdges(xr, table.Bins.X, table.Bins.XEdges)
+	if err != nil {
+		return nil, fmt.Errorf("x bins: %w", err)
+	}
+	yEdges, err := binEdges(yr, table.Bins.Y, table.Bins.YEdges)
+	if err != nil {
+		return nil, fmt.Errorf("y bins: %w", err)
+	}
+
+	counts := make([][]any, len(yEdges)-1)
+	for i := range counts {
+		counts[i] = make([]any, len(xEdges)-1)
+		for j := range counts[i] {
+			counts[i][j] = 0
+		}
+	}
+	ds.ResetIterator()
+	for ds.Next() {
+		x, y, ok := point()
+		if !ok {
+			continue
+		}
+		xi, yi := binIndex(xEdges, x), binIndex(yEdges, y)
+		if xi < 0 || yi < 0 {
+			continue
+		}
+		counts[yi][xi] = counts[yi][xi].(int) + int(rowWeight(ds.Field(binCountField)))
+	}
+	if ds.Err() != nil {
+		return nil, fmt.Errorf("dataset iteration ended with an error: %w", ds.Err())
+	}
+
+	colorscale := table.Colorscale
+	if colorscale == "" {
+		colorscale = "Viridis"
+	}
+	return &grob.Heatmap{
+		Type:       grob.TraceTypeHeatmap,
+		Name:       table.Name,
+		X:          binCenters(xEdges),
+		Y:          binCenters(yEdges),
+		Z:          counts,
+		Colorscale: colorscale,
+		Colorbar:   table.Colorbar,
+		Yaxis:      table.Yaxis,
+	}, nil
+}
+
+// valueRange tracks the smallest and largest of a sequence of values.
+type valueRange struct {
+	Min, Max float64
+}
+
+func newValueRange() *valueRange {
+	return &valueRange{Min: math.Inf(1), Max: math.Inf(-1)}
+}
+
+func (r *valueRange) Add(v float64) {
+	r.Min = math.Min(r.Min, v)
+	r.Max = math.Max(r.Max, v)
+}
+
+// binEdges returns explicit edges if given, otherwise n equal width bins
+// spanning the range of values.
+func binEdges(vr *valueRange, n int, edges []float64) ([]float64, error) {
+	if len(edges) > 0 {
+		if len(edges) < 2 {
+			return nil, fmt.Errorf("at least two bin edges are required")
+		}
+		if !sort.Float64sAreSorted(edges) {
+			return nil, fmt.Errorf("bin edges must be in ascending order")
+		}
+		return edges, nil
+	}
+
+	if n <= 0 {
+		n = 20
+	}
+	min, max := vr.Min, vr.Max
+	if min > max {
+		// no values
+		min, max = 0, 1
+	}
+	if min == max {
+		min, max = min-0.5, max+0.5
+	}
+
+	edges = make([]float64, n+1)
+	width := (max - min) / float64(n)
+	for i := range edges {
+		edges[i] = min + float64(i)*width
+	}
+	edges[n] = max
+	return edges, nil
+}
+
+// binIndex returns the index of the bin containing v, or -1 if v is outside
+// all bins. Bins include their lower edge and the last bin also includes its
+// upper edge.
+func binIndex(edges []float64, v float64) int {
+	last := len(edges) - 1
+	if v < edges[0] || v > edges[last] {
+		return -1
+	}
+	if v == edges[last] {
+		return last - 1
+	}
+	return sort.Search(last, func(i int) bool { return edges[i+1] > v })
+}
+
+func binCenters(edges []float64) []any {
+	centers := make([]any, len(edges)-1)
+	for i := range centers {
+		centers[i] = (edges[i] + edges[i+1]) / 2
+	}
+	return centers
+}
@@ -0,0 +1,297 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// BinsDef configures the bins the values of a histogram series are counted
+// in. The bins are computed when the plot is generated rather than by plotly,
+// so that the figure holds only the counts and is the same wherever it is
+// shown.
+type BinsDef struct {
+	Count   int             `yaml:"nbins"`   // optional number of bins of equal width spanning the range, cannot be given with size
+	Start   *float64        `yaml:"start"`   // optional lower edge of the first bin, defaults to the smallest value
+	End     *float64        `yaml:"end"`     // optional upper edge of the range, defaults to the largest value
+	Size    float64         `yaml:"size"`    // optional width of each bin, cannot be given with nbins
+	Outside OutsideBinsMode `yaml:"outside"` // what happens to values outside the range: drop or overflow, defaults to drop
+}
+
+// OutsideBinsMode determines what happens to the values of a histogram
+// series that fall outside the range of its bins.
+type OutsideBinsMode string
+
+const (
+	OutsideBinsDrop     OutsideBinsMode = "drop"     // values outside the range are not counted (the default)
+	OutsideBinsOverflow OutsideBinsMode = "overflow" // values below the range are counted in an underflow bin and those above it in an overflow bin
+)
+
+func (m OutsideBinsMode) String() string { return string(m) }
+
+// gatherBins moves the nbins, binStart, binEnd and binSize given on a
+// histogram series into its bins, which may give the other settings of the
+// bins, such as outside, but not the same ones again.
+func (s *SeriesDef) gatherBins() error {
+	if s.NBins == 0 && s.BinStart == nil && s.BinEnd == nil && s.BinSize == 0 {
+		return nil
+	}
+	if s.Bins == nil {
+		s.Bins = &BinsDef{}
+	}
+	if s.NBins != 0 {
+		if s.Bins.Count != 0 {
+			return fmt.Errorf("histogram nbins may not be given on both the series and its bins")
+		}
+		s.Bins.Count, s.NBins = s.NBins, 0
+	}
+	if s.BinStart != nil {
+		if s.Bins.Start != nil {
+			return fmt.Errorf("histogram binStart may not be given with the start of its bins")
+		}
+		s.Bins.Start, s.BinStart = s.BinStart, nil
+	}
+	if s.BinEnd != nil {
+		if s.Bins.End != nil {
+			return fmt.Errorf("histogram binEnd may not be given with the end of its bins")
+		}
+		s.Bins.End, s.BinEnd = s.BinEnd, nil
+	}
+	if s.BinSize != 0 {
+		if s.Bins.Size != 0 {
+			return fmt.Errorf("histogram binSize may not be given with the size of its bins")
+		}
+		s.Bins.Size, s.BinSize = s.BinSize, 0
+	}
+	return nil
+}
+
+func (d *BinsDef) validate() error {
+	if d.Count < 0 {
+		return fmt.Errorf("histogram nbins must not be negative: %d", d.Count)
+	}
+	if d.Size < 0 {
+		return fmt.Errorf("histogram bin size must not be negative: %v", d.Size)
+	}
+	if d.Count > 0 && d.Size > 0 {
+		return fmt.Errorf("histogram bins may give nbins or size but not both")
+	}
+	if d.Start != nil && d.End != nil && *d.End <= *d.Start {
+		return fmt.Errorf("histogram bins end must be greater than start: %v <= %v", *d.End, *d.Start)
+	}
+	switch d.Outside {
+	case "", OutsideBinsDrop, OutsideBinsOverflow:
+	default:
+		return fmt.Errorf("unknown histogram outside bins mode: %q", d.Outside)
+	}
+	return nil
+}
+
+// maxHistogramBins is the most bins a histogram series may have, which guards
+// against a bin size that is tiny compared with the range of the values.
+const maxHistogramBins = 10000
+
+// histogramBins are the counts of the values of a histogram series.
+type histogramBins struct {
+	Centers []float64 // middle of each bin, where its bar is drawn
+	Counts  []float64 // number of values in each bin
+	Ranges  []string  // description of the values in each bin, shown when hovering over its bar
+	Size    float64   // width of each bin
+}
+
+// histogramLayout is the placement of the bins of a histogram series.
+type histogramLayout struct {
+	lo, hi float64 // range of the values counted in the bins
+	size   float64 // width of each bin
+	n      int     // number of bins
+}
+
+// newHistogramLayout places the bins of def across the range from lo to hi
+// of count values, unless def gives the edges of the range itself.
+func newHistogramLayout(def *BinsDef, lo, hi float64, count float64) (histogramLayout, error) {
+	if def.Start != nil {
+		lo = *def.Start
+	}
+	if def.End != nil {
+		hi = *def.End
+	}
+	if hi <= lo {
+		// a single value, or a range given only on one side that excludes
+		// all the values, is counted in a bin one unit wide
+		if def.Start != nil {
+			hi = lo + 1
+		} else if def.End != nil {
+			lo = hi - 1
+		} else {
+			lo, hi = lo-0.5, hi+0.5
+		}
+	}
+
+	size := def.Size
+	n := def.Count
+	switch {
+	case size > 0:
+		// the tolerance keeps a range that is a whole number of bins from
+		// gaining an empty bin through rounding
+		n = int(math.Ceil((hi-lo)/size - 1e-9))
+	case n > 0:
+		size = (hi - lo) / float64(n)
+	default:
+		n = 1
+		if count > 1 {
+			n = int(math.Ceil(math.Log2(count))) + 1
+		}
+		size = (hi - lo) / float64(n)
+	}
+	if n > maxHistogramBins {
+		return histogramLayout{}, fmt.Errorf("histogram would have %d bins, more than the maximum of %d", n, maxHistogramBins)
+	}
+	return histogramLayout{lo: lo, hi: hi, size: size, n: n}, nil
+}
+
+// bin returns the index of the bin holding f, which is -1 for a value below
+// the range and n for a value above it.
+func (l histogramLayout) bin(f float64) int {
+	switch {
+	case f < l.lo:
+		return -1
+	case f > l.hi:
+		return l.n
+	}
+	k := int((f - l.lo) / l.size)
+	if k >= l.n {
+		k = l.n - 1
+	}
+	return k
+}
+
+// middle returns the value in the middle of bin k, where k may also be -1 or
+// n as returned by bin. Counting the value again places it in the same bin.
+func (l histogramLayout) middle(k int) float64 {
+	switch {
+	case k < 0:
+		return l.lo - l.size/2
+	case k >= l.n:
+		return l.hi + l.size/2
+	}
+	start := l.lo + float64(k)*l.size
+	return (start + math.Min(start+l.size, l.hi)) / 2
+}
+
+// binValues counts the numeric values in the bins of def, or in bins chosen
+// with Sturges' rule across the range of the values if def is nil. Each bin
+// holds the values from its lower edge up to but excluding its upper edge,
+// except the last bin which also holds the values equal to the end of the
+// range. Values that are not numbers or are not finite are ignored. Each
+// value is counted as many times as the weight in the same position, or once
+// if weights is nil, which lets the bins of a streamed dataset be counted
+// again from their middles.
+func binValues(values []any, weights []any, def *BinsDef) (histogramBins, error) {
+	if def == nil {
+		def = &BinsDef{}
+	}
+
+	var nums, counted []float64
+	var total float64
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i, v := range values {
+		f, ok := numericValue(v)
+		if !ok || nonFinite(f) {
+			continue
+		}
+		w := 1.0
+		if i < len(weights) {
+			w = rowWeight(weights[i])
+		}
+		nums = append(nums, f)
+		counted = append(counted, w)
+		total += w
+		lo = math.Min(lo, f)
+		hi = math.Max(hi, f)
+	}
+	if len(nums) == 0 && (def.Start == nil || def.End == nil) {
+		return histogramBins{}, nil
+	}
+	l, err := newHistogramLayout(def, lo, hi, total)
+	if err != nil {
+		return histogramBins{}, err
+	}
+
+	counts := make([]float64, l.n)
+	var under, over float64
+	for i, f := range nums {
+		switch k := l.bin(f); {
+		case k < 0:
+			under += counted[i]
+		case k >= l.n:
+			over += counted[i]
+		default:
+			counts[k] += counted[i]
+		}
+	}
+
+	lo, hi, size, n := l.lo, l.hi, l.size, l.n
+	bins := histogramBins{Size: size}
+	if def.Outside == OutsideBinsOverflow {
+		bins.Centers = append(bins.Centers, lo-size/2)
+		bins.Counts = append(bins.Counts, under)
+		bins.Ranges = append(bins.Ranges, "< "+formatEdge(lo))
+	}
+	for k, c := range counts {
+		start, end := lo+float64(k)*size, lo+float64(k+1)*size
+		bins.Centers = append(bins.Centers, start+size/2)
+		bins.Counts = append(bins.Counts, c)
+		if k == n-1 {
+			bins.Ranges = append(bins.Ranges, "["+formatEdge(start)+", "+formatEdge(math.Min(end, hi))+"]")
+		} else {
+			bins.Ranges = append(bins.Ranges, "["+formatEdge(start)+", "+formatEdge(end)+")")
+		}
+	}
+	if def.Outside == OutsideBinsOverflow {
+		bins.Centers = append(bins.Centers, lo+float64(n)*size+size/2)
+		bins.Counts = append(bins.Counts, over)
+		bins.Ranges = append(bins.Ranges, "> "+formatEdge(hi))
+	}
+	return bins, nil
+}
+
+// formatEdge formats the edge of a bin without the rounding errors of adding
+// up bin widths.
+func formatEdge(f float64) string {
+	return strconv.FormatFloat(f, 'g', 10, 64)
+}
+
+// histogramTraces plots the counts of the values of the series in bins as
+// bars. The labels of the series are not used.
+func histogramTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	bins, err := binValues(ls.Values, ls.Columns[binCountField], ls.SeriesDef.Bins)
+	if err != nil {
+		return nil, err
+	}
+	trace := &grob.Bar{
+		Type:          grob.TraceTypeBar,
+		Name:          ls.Name,
+		Orientation:   grob.BarOrientationV,
+		X:             bins.Centers,
+		Y:             bins.Counts,
+		Width:         bins.Size,
+		Hovertext:     bins.Ranges,
+		Hovertemplate: "%{hovertext}: %{y}",
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+	}
+	if ls.SeriesDef.HoverTemplate != "" {
+		// the bars are bins rather than rows, so parsePlotDef rejects
+		// templates that refer to the fields of a row
+		trace.Hovertemplate = ls.SeriesDef.HoverTemplate
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.BarMarker{
+			Color: c,
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
@@ -0,0 +1,199 @@
+package ashby
+
+import (
+	"fmt"
+	"testing"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+
+func TestBinValues(t *testing.T) {
+	testCases := []struct {
+		name       string
+		values     []any
+		weights    []any
+		def        *BinsDef
+		wantCounts []float64
+		wantRanges []string
+	}{
+		{
+			name:       "last bin holds the end",
+			values:     []any{0.0, 1.0, 1.999, 2.0, 3.0, 4.0},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(4), Count: 2},
+			wantCounts: []float64{3, 3},
+			wantRanges: []string{"[0, 2)", "[2, 4]"},
+		},
+		{
+			name:       "size not dividing the range",
+			values:     []any{0.0, 2.9, 3.0, 8.5, 9.0, 10.0},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(10), Size: 3},
+			wantCounts: []float64{2, 1, 1, 2},
+			wantRanges: []string{"[0, 3)", "[3, 6)", "[6, 9)", "[9, 10]"},
+		},
+		{
+			name:       "size dividing the range",
+			values:     []any{0.0, 5.0, 10.0},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(10), Size: 5},
+			wantCounts: []float64{1, 2},
+			wantRanges: []string{"[0, 5)", "[5, 10]"},
+		},
+		{
+			name:       "outside dropped",
+			values:     []any{-1.0, 0.0, 5.0, 10.0, 11.0},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(10), Count: 2},
+			wantCounts: []float64{1, 2},
+			wantRanges: []string{"[0, 5)", "[5, 10]"},
+		},
+		{
+			name:       "outside overflow",
+			values:     []any{-2.0, -1.0, 0.0, 5.0, 10.0, 11.0},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(10), Count: 2, Outside: OutsideBinsOverflow},
+			wantCounts: []float64{2, 1, 2, 1},
+			wantRanges: []string{"< 0", "[0, 5)", "[5, 10]", "> 10"},
+		},
+		{
+			name:       "single value",
+			values:     []any{3.0},
+			wantCounts: []float64{1},
+			wantRanges: []string{"[2.5, 3.5]"},
+		},
+		{
+			name:       "start greater than the largest value",
+			values:     []any{1.0, 2.0},
+			def:        &BinsDef{Start: floatPtr(5), Outside: OutsideBinsOverflow},
+			wantCounts: []float64{2, 0, 0, 0},
+			wantRanges: []string{"< 5", "[5, 5.5)", "[5.5, 6]", "> 6"},
+		},
+		{
+			name:       "end less than the smallest value",
+			values:     []any{7.0},
+			def:        &BinsDef{End: floatPtr(5)},
+			wantCounts: []float64{0},
+			wantRanges: []string{"[4, 5]"},
+		},
+		{
+			name:       "weighted and ignoring values that are not numbers",
+			values:     []any{0.0, "a", nil, 3.0, 4.0},
+			weights:    []any{2.0, 1.0, 1.0, int64(3), nil},
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(4), Count: 2},
+			wantCounts: []float64{2, 4},
+			wantRanges: []string{"[0, 2)", "[2, 4]"},
+		},
+		{
+			name: "no values",
+			def:  &BinsDef{Count: 3},
+		},
+		{
+			name:       "no values with a range",
+			def:        &BinsDef{Start: floatPtr(0), End: floatPtr(2), Count: 2},
+			wantCounts: []float64{0, 0},
+			wantRanges: []string{"[0, 1)", "[1, 2]"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bins, err := binValues(tc.values, tc.weights, tc.def)
+			if err != nil {
+				t.Fatalf("bin values: %v", err)
+			}
+			if fmt.Sprint(bins.Counts) != fmt.Sprint(tc.wantCounts) {
+				t.Errorf("got counts %v, want %v", bins.Counts, tc.wantCounts)
+			}
+			if fmt.Sprint(bins.Ranges) != fmt.Sprint(tc.wantRanges) {
+				t.Errorf("got ranges %q, want %q", bins.Ranges, tc.wantRanges)
+			}
+			if len(bins.Centers) != len(bins.Counts) {
+				t.Errorf("got %d centers for %d counts", len(bins.Centers), len(bins.Counts))
+			}
+		})
+	}
+}
+
+func TestNewHistogramLayout(t *testing.T) {
+	testCases := []struct {
+		name   string
+		def    *BinsDef
+		lo, hi float64
+		count  float64
+		want   histogramLayout
+	}{
+		{name: "sturges", def: &BinsDef{}, lo: 0, hi: 10, count: 100, want: histogramLayout{lo: 0, hi: 10, size: 10.0 / 8, n: 8}},
+		{name: "nbins", def: &BinsDef{Count: 4}, lo: 0, hi: 10, count: 100, want: histogramLayout{lo: 0, hi: 10, size: 2.5, n: 4}},
+		{name: "size dividing", def: &BinsDef{Size: 0.1}, lo: 0, hi: 1, want: histogramLayout{lo: 0, hi: 1, size: 0.1, n: 10}},
+		{name: "size not dividing", def: &BinsDef{Size: 3}, lo: 0, hi: 10, want: histogramLayout{lo: 0, hi: 10, size: 3, n: 4}},
+		{name: "range given", def: &BinsDef{Start: floatPtr(-5), End: floatPtr(5), Count: 2}, lo: 0, hi: 1, want: histogramLayout{lo: -5, hi: 5, size: 5, n: 2}},
+		{name: "single value", def: &BinsDef{}, lo: 3, hi: 3, count: 1, want: histogramLayout{lo: 2.5, hi: 3.5, size: 1, n: 1}},
+		{name: "start above values", def: &BinsDef{Start: floatPtr(5), Count: 1}, lo: 1, hi: 2, want: histogramLayout{lo: 5, hi: 6, size: 1, n: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newHistogramLayout(tc.def, tc.lo, tc.hi, tc.count)
+			if err != nil {
+				t.Fatalf("new histogram layout: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got layout %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := newHistogramLayout(&BinsDef{Size: 1e-6}, 0, 1, 0); err == nil {
+		t.Errorf("got no error for a layout with more than %d bins", maxHistogramBins)
+	}
+}
+
+func TestHistogramLayoutBinAndMiddle(t *testing.T) {
+	l, err := newHistogramLayout(&BinsDef{Start: floatPtr(0), End: floatPtr(10), Size: 3}, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("new histogram layout: %v", err)
+	}
+	for f, want := range map[float64]int{-0.1: -1, 0: 0, 2.99: 0, 3: 1, 9: 3, 10: 3, 10.1: 4} {
+		if got := l.bin(f); got != want {
+			t.Errorf("bin of %v: got %d, want %d", f, got, want)
+		}
+	}
+	for k := -1; k <= l.n; k++ {
+		if got := l.bin(l.middle(k)); got != k {
+			t.Errorf("bin of the middle %v of bin %d: got %d", l.middle(k), k, got)
+		}
+	}
+	if got := l.middle(3); got != 9.5 {
+		t.Errorf("got middle %v of the last, narrower bin, want 9.5", got)
+	}
+}
+
+// Binning the dataset of a streamed histogram again from the middles of its
+// bins gives the same counts as binning the values themselves.
+func TestStreamedHistogramRebinned(t *testing.T) {
+	values := []any{-3.0, 0.0, 0.5, 2.9, 3.0, 4.5, 6.0, 9.0, 9.99, 10.0, 12.0, "x", nil}
+	for name, def := range map[string]*BinsDef{
+		"size dropped":   {Start: floatPtr(0), End: floatPtr(10), Size: 3},
+		"size overflow":  {Start: floatPtr(0), End: floatPtr(10), Size: 3, Outside: OutsideBinsOverflow},
+		"nbins overflow": {Start: floatPtr(0), End: floatPtr(10), Count: 4, Outside: OutsideBinsOverflow},
+	} {
+		t.Run(name, func(t *testing.T) {
+			agg, err := (&RowAggregation{Fields: []string{"v"}, Histogram: def}).aggregator()
+			if err != nil {
+				t.Fatalf("aggregator: %v", err)
+			}
+			for _, v := range values {
+				agg.Add([]string{"v"}, []any{v})
+			}
+			ds := agg.DataSet()
+
+			want, err := binValues(values, nil, def)
+			if err != nil {
+				t.Fatalf("bin values: %v", err)
+			}
+			got, err := binValues(ds.Data["v"], ds.Data[binCountField], def)
+			if err != nil {
+				t.Fatalf("bin streamed values: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got bins %+v from the streamed dataset, want %+v", got, want)
+			}
+		})
+	}
+}
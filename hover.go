@@ -0,0 +1,88 @@
+package ashby
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// The hover template of a series is passed to plotly, which replaces
+// directives such as %{y:.2f} with the values of the point being hovered.
+// It may also reference the fields of the row each point was read from
+// using Go template actions delimited by [[ and ]], as in
+// '%{y:.1f} ms<br>[[ .region ]]'. These are executed for every point before
+// the plot is written, so the hover text of each point is given by its own
+// template. Different delimiters are used since the plot definition as a
+// whole is executed as a template before it is parsed. Text values read from
+// the row are escaped so that they are shown as written rather than being
+// interpreted by plotly as directives or markup, and null values are empty.
+
+const (
+	hoverLeftDelim  = "[["
+	hoverRightDelim = "]]"
+
+	// hoverColumn is the role of the column of a series holding the hover
+	// template of each point.
+	hoverColumn = "hovertemplate"
+)
+
+// hoverEscaper escapes the text that plotly interprets in hover templates.
+var hoverEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "%{", "%&#123;")
+
+// rowHoverTemplate parses the hover template of the series, returning nil if
+// it has no actions that reference the fields of the row.
+func (s *SeriesDef) rowHoverTemplate() (*template.Template, error) {
+	if !strings.Contains(s.HoverTemplate, hoverLeftDelim) {
+		return nil, nil
+	}
+	tmpl, err := template.New("hovertemplate").Delims(hoverLeftDelim, hoverRightDelim).Funcs(templateFuncs()).Option("missingkey=error").Parse(s.HoverTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parse hover template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// executeHoverTemplate returns the hover template of the point read from the
+// current row of the dataset.
+func executeHoverTemplate(tmpl *template.Template, ds DataSet, fields []string) (string, error) {
+	row := make(map[string]any, len(fields))
+	for _, f := range fields {
+		switch v := normalizeValue(ds.Field(f)).(type) {
+		case nil:
+			row[f] = ""
+		case string:
+			row[f] = hoverEscaper.Replace(v)
+		default:
+			row[f] = v
+		}
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, row); err != nil {
+		return "", fmt.Errorf("execute hover template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// hoverTemplate returns the hover template of the trace plotting the series,
+// which is either the template of the series or, if it references the fields
+// of the rows, the template of each point. Points without a row, such as
+// those filling gaps, use the default hover text.
+func (ls *LabeledSeries) hoverTemplate() grob.String {
+	col, ok := ls.Columns[hoverColumn]
+	if !ok {
+		if ls.SeriesDef.HoverTemplate == "" {
+			return nil
+		}
+		return ls.SeriesDef.HoverTemplate
+	}
+	texts := make([]string, len(col))
+	for i, v := range col {
+		if s, ok := v.(string); ok {
+			texts[i] = s
+		}
+	}
+	return texts
+}
@@ -0,0 +1,95 @@
+package ashby
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+// PlotlyCDN is the url plotly.js is loaded from by HTML pages that do not
+// inline it.
+const PlotlyCDN = "https://cdn.plot.ly/plotly-2.18.2.min.js"
+
+// HTMLOptions control the HTML pages written alongside plots. Each page is a
+// single self-contained document that draws the plot when opened.
+type HTMLOptions struct {
+	PlotlyURL string // url of plotly.js when it is not inlined, defaults to the plotly CDN
+	PlotlyJS  string // source of plotly.js to inline into each page, empty to load it from PlotlyURL
+}
+
+// NewHTMLOptions returns options for HTML pages that inline the plotly.js
+// source read from the file at path, or load it from url if path is empty.
+func NewHTMLOptions(url string, path string) (*HTMLOptions, error) {
+	opts := &HTMLOptions{PlotlyURL: url}
+	if opts.PlotlyURL == "" {
+		opts.PlotlyURL = PlotlyCDN
+	}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read plotly.js: %w", err)
+		}
+		opts.PlotlyJS = string(content)
+	}
+	return opts, nil
+}
+
+// Render returns an HTML page that draws the plot. The title of the page is
+// the title of the plot's layout, or its name if it has none.
+func (h *HTMLOptions) Render(plot []byte, pd *PlotDef, basisTime time.Time) ([]byte, error) {
+	title := pd.Name
+	if pd.Layout.Title != nil {
+		if text, ok := pd.Layout.Title.Text.(string); ok && text != "" {
+			title = text
+		}
+	}
+
+	tmpl, err := template.New("page").Parse(htmlPage)
+	if err != nil {
+		return nil, fmt.Errorf("parse html template: %w", err)
+	}
+
+	data := map[string]any{
+		"Title":     title,
+		"PlotlyURL": h.PlotlyURL,
+		"PlotlyJS":  template.JS(h.PlotlyJS),
+		"Figure":    template.JS(string(plot)), // json.Marshal escapes <, > and & so the plot cannot close the script
+		"BasisTime": basisTime.UTC().Format(time.RFC3339),
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("execute html template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+var htmlPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{ .Title }}</title>
+    {{- if .PlotlyJS }}
+    <script>{{ .PlotlyJS }}</script>
+    {{- else }}
+    <script src="{{ .PlotlyURL }}"></script>
+    {{- end }}
+    <style>
+      body { margin: 0; font-family: sans-serif; }
+      #plot { width: 100%; height: 90vh; }
+      footer { padding: 0.5em 1em; color: #888; font-size: small; }
+    </style>
+  </head>
+  <body>
+    <div id="plot"></div>
+    <footer>Data as of {{ .BasisTime }}</footer>
+    <script>
+      const fig = {{ .Figure }};
+      Plotly.newPlot("plot", fig.data, fig.layout, Object.assign({ responsive: true }, fig.config));
+    </script>
+  </body>
+</html>
+`
@@ -0,0 +1,209 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPQuery is the query of a dataset read from an HTTPDataSource. It is
+// written as YAML in the query field of the dataset definition, which is
+// templated along with the rest of the plot definition so the url may be
+// derived from the basis time and headers from environment variables using
+// the env function.
+type HTTPQuery struct {
+	URL      string            `yaml:"url"`      // url to fetch, resolved against the datasource url
+	Headers  map[string]string `yaml:"headers"`  // headers to add to each request, e.g. Authorization
+	Rows     string            `yaml:"rows"`     // jsonpath selecting the rows of the dataset, defaults to $[*]
+	Columns  map[string]string `yaml:"columns"`  // maps dataset field names to jsonpaths evaluated against each row
+	Next     string            `yaml:"next"`     // optional jsonpath selecting the url of the next page
+	MaxPages int               `yaml:"maxPages"` // maximum number of pages to fetch, defaults to 100
+	Timeout  time.Duration     `yaml:"timeout"`  // timeout of each request, defaults to 30s
+}
+
+// HTTPDataSource is a DataSource that fetches JSON documents over HTTP and
+// extracts rows from them using JSONPath expressions. Pages are followed
+// using the next jsonpath of the query or a Link header with rel="next".
+type HTTPDataSource struct {
+	base   *url.URL
+	client *http.Client
+}
+
+func init() {
+	for _, scheme := range []string{"http", "https"} {
+		RegisterDataSource(scheme, func(cfg DataSourceConfig) (DataSource, error) {
+			return NewHTTPDataSource(cfg.URL)
+		})
+	}
+}
+
+func NewHTTPDataSource(rawurl string) (*HTTPDataSource, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("parse http url: %w", err)
+	}
+	return &HTTPDataSource{
+		base:   u,
+		client: http.DefaultClient,
+	}, nil
+}
+
+func (h *HTTPDataSource) GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error) {
+	var q HTTPQuery
+	if err := yaml.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("failed to decode http query: %w", err)
+	}
+	if q.Rows == "" {
+		q.Rows = "$[*]"
+	}
+	if q.MaxPages == 0 {
+		q.MaxPages = 100
+	}
+	if q.Timeout == 0 {
+		q.Timeout = 30 * time.Second
+	}
+
+	rowsPath, err := compileJSONPath(q.Rows)
+	if err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	var nextPath jsonPath
+	if q.Next != "" {
+		nextPath, err = compileJSONPath(q.Next)
+		if err != nil {
+			return nil, fmt.Errorf("next: %w", err)
+		}
+	}
+
+	names := make([]string, 0, len(q.Columns))
+	for name := range q.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	colPaths := make(map[string]jsonPath, len(q.Columns))
+	data := make(map[string][]any, len(q.Columns))
+	for _, name := range names {
+		colPaths[name], err = compileJSONPath(q.Columns[name])
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", name, err)
+		}
+		data[name] = []any{}
+	}
+
+	next, err := h.base.Parse(q.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse query url: %w", err)
+	}
+
+	for page := 0; next != nil && page < q.MaxPages; page++ {
+		doc, link, err := h.fetch(ctx, next.String(), q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rowsPath.Eval(doc) {
+			for _, name := range names {
+				data[name] = append(data[name], colPaths[name].First(row))
+			}
+		}
+
+		var nextURL string
+		if nextPath != nil {
+			nextURL, _ = nextPath.First(doc).(string)
+		} else {
+			nextURL = link
+		}
+
+		next = nil
+		if nextURL != "" {
+			next, err = h.base.Parse(nextURL)
+			if err != nil {
+				return nil, fmt.Errorf("parse next url: %w", err)
+			}
+		}
+	}
+
+	return NewStaticDataSet(data), nil
+}
+
+// fetch gets and decodes a single JSON document. It also returns the url of
+// the next page given by the Link header, if any. A request that fails with a
+// transient status such as 503 is not retried here but by the retry policy
+// of the run, which runs the whole query again.
+func (h *HTTPDataSource) fetch(ctx context.Context, u string, q HTTPQuery) (any, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("new request: %w", redactURLError(err))
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("execute request: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, "", &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("decode response: %w", err)
+	}
+
+	return doc, nextLink(resp.Header.Values("Link")), nil
+}
+
+var reLinkNext = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?next"?`)
+
+// nextLink returns the target of a Link header with rel="next".
+func nextLink(headers []string) string {
+	for _, h := range headers {
+		if m := reLinkNext.FindStringSubmatch(h); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	return ""
+}
+
+// redactURL removes the parts of a url that may hold credentials, so that it
+// can be logged.
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
+
+// redactURLError redacts the url held by a *url.Error, which the http client
+// returns with the full url of the request including its query.
+func redactURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = redactURL(ue.URL)
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package ashby
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchErrorRedactsURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	u := srv.URL + "/peers?api_key=hunter2"
+	srv.Close()
+
+	h := &HTTPDataSource{client: http.DefaultClient}
+	_, _, err := h.fetch(context.Background(), u, HTTPQuery{Timeout: time.Second})
+	if err == nil {
+		t.Fatalf("fetched from a closed server, want an error")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("got error %q, want the query of the url redacted", err)
+	}
+}
@@ -0,0 +1,189 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// IndexPlot is a plot listed by the latest index page.
+type IndexPlot struct {
+	Name      string
+	Title     string   // title of the plot's layout, or its name if it has none
+	Tags      []string // tags of the plot definition
+	Href      string   // path of the latest plot relative to the latest directory, or of its HTML page if one was written
+	Thumbnail string   // path of the latest PNG image relative to the latest directory, empty if none was written
+
+	latest string // path of the latest plot
+}
+
+// IndexGroup is the plots of the latest index page that have a tag.
+type IndexGroup struct {
+	Tag   string // empty for the plots without tags
+	Plots []IndexPlot
+}
+
+// indexPlot returns the entry of the latest index page for the plot.
+func (o *Organizer) indexPlot(ctx context.Context, pd *PlotDef) (IndexPlot, error) {
+	latest, err := o.LatestFilepath(pd)
+	if err != nil {
+		return IndexPlot{}, err
+	}
+	title := pd.Name
+	if pd.Layout.Title != nil {
+		if text, ok := pd.Layout.Title.Text.(string); ok && text != "" {
+			title = text
+		}
+	}
+	return IndexPlot{Name: pd.Name, Title: title, Tags: pd.Tags, latest: latest}, nil
+}
+
+// LoadIndexTemplate parses the html template of the latest index page from
+// the file at path, or returns the built-in template if path is empty. The
+// template is executed with the time the index was written as .Generated and
+// the groups of plots, ordered by tag with the untagged plots last, as
+// .Groups.
+func LoadIndexTemplate(path string) (*template.Template, error) {
+	page := indexPage
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read index template: %w", err)
+		}
+		page = string(content)
+	}
+	tmpl, err := template.New("index").Parse(page)
+	if err != nil {
+		return nil, fmt.Errorf("parse index template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// WriteLatestIndex writes an index.html page to the latest directory that
+// links to the latest copy of each of the plots, grouped by tag. A plot with
+// several tags is listed in each of their groups. Plots whose latest copy
+// does not exist, such as those that have never been generated successfully,
+// are left out. The HTML page and PNG image of a plot are used for its link
+// and thumbnail if they exist alongside its latest copy.
+func (o *Organizer) WriteLatestIndex(ctx context.Context, plots []IndexPlot, tmpl *template.Template, generated time.Time) error {
+	latestDir := filepath.Join(o.Base, "latest")
+
+	seen := make(map[string]bool, len(plots))
+	byTag := make(map[string][]IndexPlot)
+	for _, p := range plots {
+		if seen[p.latest] {
+			continue
+		}
+		seen[p.latest] = true
+		if _, err := o.backend().Stat(ctx, p.latest); err != nil {
+			slog.Debug("leaving plot out of latest index, no latest copy exists", "name", p.Name, "filename", p.latest)
+			continue
+		}
+		p.Href = o.relLatest(latestDir, p.latest)
+		if html := siblingPath(p.latest, "html"); o.exists(ctx, html) {
+			p.Href = o.relLatest(latestDir, html)
+		}
+		if png := siblingPath(p.latest, "png"); o.exists(ctx, png) {
+			p.Thumbnail = o.relLatest(latestDir, png)
+		}
+		if len(p.Tags) == 0 {
+			byTag[""] = append(byTag[""], p)
+		}
+		for _, tag := range p.Tags {
+			byTag[tag] = append(byTag[tag], p)
+		}
+	}
+
+	var groups []IndexGroup
+	for _, tag := range sortedKeys(byTag) {
+		if tag != "" {
+			groups = append(groups, IndexGroup{Tag: tag, Plots: byTag[tag]})
+		}
+	}
+	if untagged, ok := byTag[""]; ok {
+		groups = append(groups, IndexGroup{Plots: untagged})
+	}
+	for _, g := range groups {
+		sort.SliceStable(g.Plots, func(i, j int) bool { return g.Plots[i].Title < g.Plots[j].Title })
+	}
+
+	buf := new(bytes.Buffer)
+	data := map[string]any{
+		"Generated": generated.UTC().Format(time.RFC3339),
+		"Groups":    groups,
+	}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return fmt.Errorf("execute index template: %w", err)
+	}
+
+	path := filepath.Join(latestDir, "index.html")
+	if o.outputUnchanged(ctx, path, buf.Bytes()) {
+		return nil
+	}
+	if o.DryRun {
+		slog.Info("dry run: would write latest index", "filename", path, "plots", len(seen))
+		return nil
+	}
+	if err := o.backend().Write(ctx, path, buf.Bytes()); err != nil {
+		return fmt.Errorf("write latest index: %w", err)
+	}
+	return nil
+}
+
+func (o *Organizer) exists(ctx context.Context, path string) bool {
+	_, err := o.backend().Stat(ctx, path)
+	return err == nil
+}
+
+// relLatest returns the path relative to the latest directory, with forward
+// slashes for use in links.
+func (o *Organizer) relLatest(latestDir string, path string) string {
+	rel, err := filepath.Rel(latestDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+var indexPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Latest plots</title>
+    <style>
+      body { margin: 0 1em; font-family: sans-serif; }
+      ul { list-style: none; padding: 0; display: flex; flex-wrap: wrap; gap: 1em; }
+      li { width: 240px; }
+      img { width: 100%; border: 1px solid #ddd; }
+      footer { padding: 0.5em 0; color: #888; font-size: small; }
+    </style>
+  </head>
+  <body>
+    <h1>Latest plots</h1>
+    {{- range .Groups }}
+    <h2>{{ if .Tag }}{{ .Tag }}{{ else }}Untagged{{ end }}</h2>
+    <ul>
+      {{- range .Plots }}
+      <li>
+        <a href="{{ .Href }}">
+          {{- if .Thumbnail }}
+          <img src="{{ .Thumbnail }}" alt="{{ .Title }}">
+          {{- end }}
+          <div>{{ .Title }}</div>
+        </a>
+      </li>
+      {{- end }}
+    </ul>
+    {{- end }}
+    <footer>Generated at {{ .Generated }}</footer>
+  </body>
+</html>
+`
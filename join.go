@@ -0,0 +1,134 @@
+package ashby
+
+import "fmt"
+
+// JoinDef defines a dataset made by joining the rows of two other datasets,
+// which may come from different sources, on the values of a key field.
+// Keys are compared by their string form so that, for example, a time read
+// from one source matches the same time formatted as text by another.
+//
+// Every pair of matching rows produces a row of the joined dataset, so a key
+// that appears more than once in either dataset produces a row for each
+// combination, as in SQL. The joined dataset has the fields of the left
+// dataset followed by those of the right. A field of the right dataset whose
+// name is already used by the left dataset is prefixed with the name of the
+// right dataset and a dot, as in 'visits.count'.
+type JoinDef struct {
+	Name    string       `yaml:"name"`    // the name of the joined dataset
+	Type    JoinType     `yaml:"type"`    // the kind of join, defaults to inner
+	Left    JoinInputDef `yaml:"left"`    // the dataset whose rows are kept by a left join
+	Right   JoinInputDef `yaml:"right"`   // the dataset joined to the left one
+	Columns []ColumnDef  `yaml:"columns"` // optional columns computed from the fields of each joined row
+}
+
+type JoinInputDef struct {
+	DataSet string `yaml:"dataset"` // the name of the dataset
+	Key     string `yaml:"key"`     // the name of the field holding the key
+}
+
+type JoinType string
+
+const (
+	JoinTypeDefault JoinType = ""      // same as inner
+	JoinTypeInner   JoinType = "inner" // only rows with a key in both datasets are kept
+	JoinTypeLeft    JoinType = "left"  // all rows of the left dataset are kept, with null right fields when the key is not matched
+)
+
+func (t JoinType) String() string { return string(t) }
+
+// A FieldLister is a dataset that can list the names of its fields.
+type FieldLister interface {
+	Fields() []string
+}
+
+// joinDataSets returns the dataset joining the rows of left and right
+// according to def.
+func joinDataSets(def JoinDef, left, right DataSet) (DataSet, error) {
+	leftFields, ok := fieldNames(left)
+	if !ok {
+		return nil, fmt.Errorf("dataset %q does not list its fields", def.Left.DataSet)
+	}
+	rightFields, ok := fieldNames(right)
+	if !ok {
+		return nil, fmt.Errorf("dataset %q does not list its fields", def.Right.DataSet)
+	}
+
+	// the fields of the joined dataset and the right fields they are read from
+	names := append([]string{}, leftFields...)
+	used := make(map[string]bool, len(leftFields))
+	for _, f := range leftFields {
+		used[f] = true
+	}
+	renamed := make(map[string]string, len(rightFields))
+	for _, f := range rightFields {
+		name := f
+		if used[name] {
+			name = def.Right.DataSet + "." + f
+		}
+		used[name] = true
+		renamed[f] = name
+		names = append(names, name)
+	}
+
+	rightRows := make(map[string][]map[string]any)
+	right.ResetIterator()
+	for right.Next() {
+		key := right.Field(def.Right.Key)
+		if err, ok := key.(error); ok {
+			return nil, fmt.Errorf("did not get key field %q from dataset %q: %w", def.Right.Key, def.Right.DataSet, err)
+		}
+		row := make(map[string]any, len(rightFields))
+		for _, f := range rightFields {
+			row[renamed[f]] = right.Field(f)
+		}
+		k := stringify(key)
+		rightRows[k] = append(rightRows[k], row)
+	}
+	if right.Err() != nil {
+		return nil, fmt.Errorf("dataset %q: iteration ended with an error: %w", def.Right.DataSet, right.Err())
+	}
+
+	data := make(map[string][]any, len(names))
+	for _, name := range names {
+		data[name] = []any{}
+	}
+	left.ResetIterator()
+	for left.Next() {
+		key := left.Field(def.Left.Key)
+		if err, ok := key.(error); ok {
+			return nil, fmt.Errorf("did not get key field %q from dataset %q: %w", def.Left.Key, def.Left.DataSet, err)
+		}
+
+		matches := rightRows[stringify(key)]
+		if len(matches) == 0 {
+			if def.Type != JoinTypeLeft {
+				continue
+			}
+			matches = []map[string]any{nil}
+		}
+		for _, row := range matches {
+			for _, f := range leftFields {
+				data[f] = append(data[f], left.Field(f))
+			}
+			for _, f := range rightFields {
+				data[renamed[f]] = append(data[renamed[f]], row[renamed[f]])
+			}
+		}
+	}
+	if left.Err() != nil {
+		return nil, fmt.Errorf("dataset %q: iteration ended with an error: %w", def.Left.DataSet, left.Err())
+	}
+
+	ds := NewStaticDataSet(data)
+	ds.fields = names
+	return ds, nil
+}
+
+// fieldNames returns the names of the fields of the dataset.
+func fieldNames(ds DataSet) ([]string, bool) {
+	fl, ok := ds.(FieldLister)
+	if !ok {
+		return nil, false
+	}
+	return fl.Fields(), true
+}
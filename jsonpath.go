@@ -0,0 +1,116 @@
+package ashby
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A jsonPath is a compiled JSONPath expression. Only a subset of JSONPath is
+// supported: the root ($) or current (@) node followed by any number of
+// child selectors (.name or ['name']), array indexes ([0]) and wildcards
+// (.* or [*]).
+type jsonPath []jsonPathStep
+
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func compileJSONPath(expr string) (jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") && !strings.HasPrefix(s, "@") {
+		return nil, fmt.Errorf("jsonpath must start with $ or @: %q", expr)
+	}
+	s = s[1:]
+
+	var path jsonPath
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if name == "" {
+				return nil, fmt.Errorf("empty name in jsonpath: %q", expr)
+			}
+			if name == "*" {
+				path = append(path, jsonPathStep{wildcard: true})
+			} else {
+				path = append(path, jsonPathStep{name: name})
+			}
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in jsonpath: %q", expr)
+			}
+			sel := s[1:end]
+			s = s[end+1:]
+			switch {
+			case sel == "*":
+				path = append(path, jsonPathStep{wildcard: true})
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				path = append(path, jsonPathStep{name: sel[1 : len(sel)-1]})
+			default:
+				n, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("unsupported selector %q in jsonpath: %q", sel, expr)
+				}
+				path = append(path, jsonPathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q in jsonpath: %q", s[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// Eval returns all the values in v selected by the path.
+func (p jsonPath) Eval(v any) []any {
+	nodes := []any{v}
+	for _, step := range p {
+		var next []any
+		for _, n := range nodes {
+			switch tn := n.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, c := range tn {
+						next = append(next, c)
+					}
+				} else if c, ok := tn[step.name]; ok && !step.isIndex {
+					next = append(next, c)
+				}
+			case []any:
+				switch {
+				case step.wildcard:
+					next = append(next, tn...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(tn)
+					}
+					if i >= 0 && i < len(tn) {
+						next = append(next, tn[i])
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// First returns the first value selected by the path, or nil if there is none.
+func (p jsonPath) First(v any) any {
+	vals := p.Eval(v)
+	if len(vals) == 0 {
+		return nil
+	}
+	return vals[0]
+}
@@ -0,0 +1,255 @@
+package ashby
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImageFormat is a static image format that plots may be rendered to in
+// addition to their JSON.
+type ImageFormat string
+
+const (
+	ImageFormatPNG ImageFormat = "png"
+	ImageFormatSVG ImageFormat = "svg"
+)
+
+func (f ImageFormat) String() string { return string(f) }
+
+// ParseImageFormats parses a list of image format names.
+func ParseImageFormats(names []string) ([]ImageFormat, error) {
+	var formats []ImageFormat
+	for _, name := range names {
+		switch f := ImageFormat(strings.ToLower(strings.TrimSpace(name))); f {
+		case ImageFormatPNG, ImageFormatSVG:
+			formats = append(formats, f)
+		default:
+			return nil, fmt.Errorf("unsupported image format: %q", name)
+		}
+	}
+	return formats, nil
+}
+
+// imagePath returns the path of an image rendered from the plot written to
+// path, which has the same name with the extension of the image format.
+func imagePath(path string, format ImageFormat) string {
+	return siblingPath(path, string(format))
+}
+
+// siblingPath returns the path of a file written alongside the plot written
+// to path, which has the same name with a different extension.
+func siblingPath(path string, ext string) string {
+	path = strings.TrimSuffix(path, ".gz")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + ext
+}
+
+// An ImageRenderer renders the JSON of a plot to a static image.
+type ImageRenderer interface {
+	Render(ctx context.Context, plot []byte, format ImageFormat) ([]byte, error)
+}
+
+// ImageSize is the size in pixels of an image rendered from a plot whose
+// layout does not give it, such as a responsive plot. A zero dimension is
+// left to the renderer.
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+type imageSizeKey struct{}
+
+// WithImageSize returns a context whose images are rendered at the size,
+// unless the renderer is configured with a size of its own.
+func WithImageSize(ctx context.Context, size ImageSize) context.Context {
+	return context.WithValue(ctx, imageSizeKey{}, size)
+}
+
+// ImageSizeFromContext returns the size of images given by WithImageSize.
+func ImageSizeFromContext(ctx context.Context) (ImageSize, bool) {
+	size, ok := ctx.Value(imageSizeKey{}).(ImageSize)
+	return size, ok
+}
+
+// ErrKaleidoNotFound is returned when the Kaleido executable cannot be found.
+var ErrKaleidoNotFound = errors.New("kaleido executable not found: install it with 'pip install kaleido==0.2.1' and add its executable to the PATH, or set --kaleido-path")
+
+// KaleidoRenderer is an ImageRenderer that renders plots using the Kaleido
+// executable, which bundles a headless browser and plotly.js. A new Kaleido
+// process is started for each image.
+type KaleidoRenderer struct {
+	Path    string        // path or name of the kaleido executable, defaults to kaleido
+	Width   int           // width of images in pixels, zero uses the width of the layout or the Kaleido default
+	Height  int           // height of images in pixels, zero uses the height of the layout or the Kaleido default
+	Scale   float64       // factor the image dimensions are multiplied by, defaults to 1
+	Timeout time.Duration // limit on the time taken to render each image, defaults to one minute
+}
+
+// executable returns the path of the Kaleido executable.
+func (k *KaleidoRenderer) executable() (string, error) {
+	name := k.Path
+	if name == "" {
+		name = "kaleido"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrKaleidoNotFound, err)
+	}
+	return path, nil
+}
+
+// Check reports whether the Kaleido executable can be found so that a
+// missing installation is reported before any plots are generated.
+func (k *KaleidoRenderer) Check() error {
+	_, err := k.executable()
+	return err
+}
+
+// kaleidoRequest is a request to render a figure, written as a line of JSON to
+// the stdin of the Kaleido process.
+type kaleidoRequest struct {
+	Data   kaleidoFigure `json:"data"`
+	Format ImageFormat   `json:"format"`
+	Width  int           `json:"width,omitempty"`
+	Height int           `json:"height,omitempty"`
+	Scale  float64       `json:"scale,omitempty"`
+}
+
+type kaleidoFigure struct {
+	Data   json.RawMessage `json:"data"`
+	Layout json.RawMessage `json:"layout,omitempty"`
+}
+
+// kaleidoResponse is a line of JSON written to stdout by the Kaleido process,
+// both when it starts and in response to each request.
+type kaleidoResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+func (k *KaleidoRenderer) Render(ctx context.Context, plot []byte, format ImageFormat) ([]byte, error) {
+	path, err := k.executable()
+	if err != nil {
+		return nil, err
+	}
+
+	req := kaleidoRequest{
+		Format: format,
+		Width:  k.Width,
+		Height: k.Height,
+		Scale:  k.Scale,
+	}
+	if size, ok := ImageSizeFromContext(ctx); ok {
+		if req.Width == 0 {
+			req.Width = size.Width
+		}
+		if req.Height == 0 {
+			req.Height = size.Height
+		}
+	}
+	if err := json.Unmarshal(plot, &req.Data); err != nil {
+		return nil, fmt.Errorf("decode plot: %w", err)
+	}
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal kaleido request: %w", err)
+	}
+
+	timeout := k.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, "plotly", "--disable-gpu", "--no-sandbox", "--disable-dev-shm-usage")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("kaleido stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("kaleido stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start kaleido: %w", err)
+	}
+
+	// stop waits for kaleido to exit, after which its stderr may be read
+	stop := func() {
+		stdin.Close()
+		cancel()
+		cmd.Wait()
+	}
+
+	r := bufio.NewReader(stdout)
+	if _, err := readKaleidoResponse(r); err != nil {
+		stop()
+		return nil, fmt.Errorf("start kaleido: %w%s", err, stderrDetail(stderr))
+	}
+
+	if _, err := stdin.Write(append(reqData, '\n')); err != nil {
+		stop()
+		return nil, fmt.Errorf("write kaleido request: %w%s", err, stderrDetail(stderr))
+	}
+	resp, err := readKaleidoResponse(r)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w%s", format, err, stderrDetail(stderr))
+	}
+
+	if format == ImageFormatSVG {
+		return []byte(resp.Result), nil
+	}
+	img, err := base64.StdEncoding.DecodeString(resp.Result)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", format, err)
+	}
+	return img, nil
+}
+
+// readKaleidoResponse reads the next response written by Kaleido, skipping
+// any lines that are not JSON.
+func readKaleidoResponse(r *bufio.Reader) (*kaleidoResponse, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 && line[0] == '{' {
+			var resp kaleidoResponse
+			if err := json.Unmarshal(line, &resp); err != nil {
+				return nil, fmt.Errorf("decode kaleido response: %w", err)
+			}
+			if resp.Code != 0 {
+				return nil, fmt.Errorf("kaleido error %d: %s", resp.Code, resp.Message)
+			}
+			return &resp, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("kaleido exited without a response")
+			}
+			return nil, fmt.Errorf("read kaleido response: %w", err)
+		}
+	}
+}
+
+// stderrDetail formats the last line written to stderr by Kaleido, if any,
+// for inclusion in an error.
+func stderrDetail(stderr *bytes.Buffer) string {
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return ": " + last
+	}
+	return ""
+}
@@ -1,64 +1,76 @@
-package main
+package ashby
 
 import (
-	"os"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync/atomic"
 
-	"github.com/iand/pontium/hlog"
-	"github.com/urfave/cli/v2"
 	"golang.org/x/exp/slog"
 )
 
-var loggingFlags = []cli.Flag{
-	&cli.BoolFlag{
-		Name:        "verbose",
-		Aliases:     []string{"v"},
-		EnvVars:     []string{envPrefix + "VERBOSE"},
-		Usage:       "Set logging level more verbose to include info level logs",
-		Value:       true,
-		Destination: &loggingOpts.Verbose,
-	},
+// secretKey matches the names of parameters and headers whose values are
+// credentials.
+const secretKey = `(?i)(\b(?:password|passwd|pwd|secret|token|api_?key|access_?key|authorization)["']?\s*[=:]\s*`
 
-	&cli.BoolFlag{
-		Name:        "veryverbose",
-		EnvVars:     []string{envPrefix + "VERYVERBOSE"},
-		Aliases:     []string{"vv"},
-		Usage:       "Set logging level more verbose to include debug level logs",
-		Destination: &loggingOpts.VeryVerbose,
-	},
-	&cli.BoolFlag{
-		Name:        "hlog",
-		EnvVars:     []string{envPrefix + "HLOG"},
-		Usage:       "Use human friendly log output",
-		Value:       true,
-		Destination: &loggingOpts.Hlog,
-	},
+// secretPatterns match credentials that may be written in the text of a
+// query, such as the password of a url or the value of a token parameter.
+// Quoted values are redacted up to their closing quote, and unquoted values
+// along with any authorization scheme, such as Bearer, that precedes them.
+// The groups of each are kept and the remainder of the match is redacted.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+	regexp.MustCompile(secretKey + `")[^"]*(")`),
+	regexp.MustCompile(secretKey + `')[^']*(')`),
+	regexp.MustCompile(secretKey + `)(?:(?:bearer|basic|digest|token)\s+)?[^\s&"',;)]+`),
 }
 
+// redactSecrets returns the text of a query with any credentials it appears
+// to contain replaced so that it can be logged.
+func redactSecrets(s string) string {
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}REDACTED${2}")
+	}
+	return s
+}
 
+type loggerKey struct{}
 
-var loggingOpts struct {
-	Verbose     bool
-	VeryVerbose bool
-	Hlog        bool
+// WithLogger returns a context carrying the logger to be used for the logs
+// emitted while a plot is generated, including those of datasources, so that
+// they can be attributed to the plot.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
-func setupLogging() {
-	logLevel := new(slog.LevelVar)
-	logLevel.Set(slog.LevelWarn)
-	if loggingOpts.Verbose {
-		logLevel.Set(slog.LevelInfo)
-	}
-	if loggingOpts.VeryVerbose {
-		logLevel.Set(slog.LevelDebug)
+// LoggerFromContext returns the logger carried by ctx, or the default logger
+// if there is none.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
 	}
+	return slog.Default()
+}
 
-	var h slog.Handler
-	if loggingOpts.Hlog {
-		h = new(hlog.Handler).WithLevel(logLevel.Level())
-	} else {
-		h = (slog.HandlerOptions{
-			Level: logLevel,
-		}).NewJSONHandler(os.Stdout)
+// requestIDs issues the ids that identify the generation of each plot in the
+// logs of a run. Each id is a random prefix that is shared by the run,
+// followed by a sequence number.
+type requestIDs struct {
+	run string
+	n   atomic.Int64
+}
+
+func newRequestIDs() *requestIDs {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		// ids are only used to correlate logs so a fixed prefix will do
+		return &requestIDs{run: "000000"}
 	}
-	slog.SetDefault(slog.New(h))
+	return &requestIDs{run: hex.EncodeToString(b)}
+}
+
+func (r *requestIDs) next() string {
+	return fmt.Sprintf("%s-%d", r.run, r.n.Add(1))
 }
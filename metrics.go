@@ -0,0 +1,199 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// queryDurationBuckets are the upper bounds, in seconds, of the buckets of
+// the histogram of query durations.
+var queryDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// runMetrics collects the metrics of the plots generated by the process.
+var runMetrics = newMetrics()
+
+// metrics counts the plots generated and the queries run by the process so
+// that they can be served to Prometheus.
+type metrics struct {
+	mu            sync.Mutex
+	plots         map[string]float64      // number of plots by outcome
+	queryFailures map[string]float64      // number of failed queries by source
+	queryDuration map[string]*histogram   // duration of queries by source
+	lastSuccess   map[[2]string]time.Time // time of the last successful run by plot and variant
+}
+
+type histogram struct {
+	counts []float64 // number of observations in each bucket, not cumulative
+	count  float64
+	sum    float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		plots:         make(map[string]float64),
+		queryFailures: make(map[string]float64),
+		queryDuration: make(map[string]*histogram),
+		lastSuccess:   make(map[[2]string]time.Time),
+	}
+}
+
+// observePlot records the outcome of processing a plot at time now.
+func (m *metrics) observePlot(pr PlotResult, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plots[string(pr.Outcome)]++
+	if pr.Outcome != PlotOutcomeFailed && pr.Outcome != PlotOutcomeExcluded && pr.Name != "" {
+		m.lastSuccess[[2]string{pr.Name, pr.Variant}] = now
+	}
+}
+
+// observeQuery records the duration of a query of a source and whether it
+// failed.
+func (m *metrics) observeQuery(source string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.queryFailures[source]++
+	}
+	h, ok := m.queryDuration[source]
+	if !ok {
+		h = &histogram{counts: make([]float64, len(queryDurationBuckets))}
+		m.queryDuration[source] = h
+	}
+	secs := d.Seconds()
+	for i, le := range queryDurationBuckets {
+		if secs <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += secs
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP ashby_plots_total Number of plots processed, by outcome.\n")
+	b.WriteString("# TYPE ashby_plots_total counter\n")
+	for _, outcome := range sortedKeys(m.plots) {
+		fmt.Fprintf(&b, "ashby_plots_total{outcome=%s} %v\n", promLabel(outcome), m.plots[outcome])
+	}
+
+	b.WriteString("# HELP ashby_query_failures_total Number of dataset queries that failed, by datasource.\n")
+	b.WriteString("# TYPE ashby_query_failures_total counter\n")
+	for _, source := range sortedKeys(m.queryFailures) {
+		fmt.Fprintf(&b, "ashby_query_failures_total{source=%s} %v\n", promLabel(source), m.queryFailures[source])
+	}
+
+	b.WriteString("# HELP ashby_query_duration_seconds Duration of dataset queries, by datasource.\n")
+	b.WriteString("# TYPE ashby_query_duration_seconds histogram\n")
+	for _, source := range sortedKeys(m.queryDuration) {
+		h := m.queryDuration[source]
+		var cumulative float64
+		for i, le := range queryDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "ashby_query_duration_seconds_bucket{source=%s,le=\"%v\"} %v\n", promLabel(source), le, cumulative)
+		}
+		fmt.Fprintf(&b, "ashby_query_duration_seconds_bucket{source=%s,le=\"+Inf\"} %v\n", promLabel(source), h.count)
+		fmt.Fprintf(&b, "ashby_query_duration_seconds_sum{source=%s} %v\n", promLabel(source), h.sum)
+		fmt.Fprintf(&b, "ashby_query_duration_seconds_count{source=%s} %v\n", promLabel(source), h.count)
+	}
+
+	b.WriteString("# HELP ashby_plot_last_success_timestamp_seconds Time of the last successful generation of a plot, as seconds since the epoch.\n")
+	b.WriteString("# TYPE ashby_plot_last_success_timestamp_seconds gauge\n")
+	keys := make([][2]string, 0, len(m.lastSuccess))
+	for k := range m.lastSuccess {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "ashby_plot_last_success_timestamp_seconds{plot=%s,variant=%s} %d\n", promLabel(k[0]), promLabel(k[1]), m.lastSuccess[k].Unix())
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// promLabel returns the quoted form of a Prometheus label value.
+func promLabel(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// WriteMetrics writes the metrics of the batch runs of the process to fname in
+// the Prometheus text exposition format. The file is replaced atomically so
+// that it can be read at any time by the textfile collector of the node
+// exporter, which serves the metrics of runs that have finished.
+func WriteMetrics(fname string) error {
+	buf := new(bytes.Buffer)
+	if _, err := runMetrics.WriteTo(buf); err != nil {
+		return fmt.Errorf("format metrics: %w", err)
+	}
+	return writeOutput(fname, buf.Bytes())
+}
+
+// ServeMetrics serves the metrics of the batch runs of the process at
+// /metrics on addr until the returned function is called.
+func ServeMetrics(addr string) (func(), error) {
+	return serveMetrics(addr, runMetrics)
+}
+
+func serveMetrics(addr string, m *metrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := m.WriteTo(w); err != nil {
+			slog.Warn("failed to write metrics", "error", err)
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	slog.Info("serving metrics", "addr", ln.Addr().String())
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "error", err)
+		}
+	}()
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("failed to shut down metrics server", "error", err)
+		}
+	}, nil
+}
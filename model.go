@@ -1,9 +1,13 @@
-package main
+package ashby
 
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
 	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
@@ -16,6 +20,10 @@ type PlotConfig struct {
 	// Generally it is the current time but can be set to a time in the past
 	BasisTime time.Time
 
+	// Clock, if not nil, tells the current time, which may be fixed so that
+	// runs can be reproduced. Defaults to the system clock.
+	Clock Clock
+
 	// Sources is a mapping of names to datasources. The names can be
 	// referenced in a dataset definition
 	Sources map[string]DataSource
@@ -29,10 +37,48 @@ type PlotConfig struct {
 	// Colors is a mapping of friendly names to hex values of colors
 	Colors map[string]string
 
+	// Themes is a mapping of names to themes that plots may use
+	Themes map[string]*Theme
+
+	// Defaults, if not nil, fills the fields that plot definitions leave empty
+	Defaults *PlotDefaults
+
 	// Profiles contains information about different variants of plot defs
 	Profiles []*ProcessingProfile
 
+	// MatchGlob, if not empty, selects the plot definitions whose names match
+	// the glob, and MatchName, if not nil, those whose names match the regular
+	// expression. Tags selects plot definitions that have all of the tags, or
+	// any of them if AnyTag is true.
 	MatchGlob string
+	MatchName *regexp.Regexp
+	Tags      []string
+	AnyTag    bool
+
+	// QueryConcurrency is the maximum number of dataset queries of a single
+	// plot that may run at once. Defaults to GOMAXPROCS when zero.
+	QueryConcurrency int
+
+	// QueryTimeout bounds the time each dataset query may take. Zero means
+	// no timeout.
+	QueryTimeout time.Duration
+
+	// MaxRows is the maximum number of rows a single dataset query may
+	// return before it is aborted. Zero means no limit.
+	MaxRows int
+
+	// Retry is the policy used to retry dataset queries that fail with a
+	// transient error.
+	Retry RetryPolicy
+
+	// Timing records the time taken by each dataset query and by building the
+	// figure of each plot in its layout meta and logs a breakdown of it.
+	Timing bool
+
+	// SourceMap remaps the names of the datasources referenced by datasets,
+	// so that the same plot definitions can query another backend, such as
+	// a staging database.
+	SourceMap map[string]string
 }
 
 func (c *PlotConfig) MaybeLookupColor(name string, seriesName string) string {
@@ -49,30 +95,145 @@ func (c *PlotConfig) MaybeLookupColor(name string, seriesName string) string {
 type PlotFrequency string
 
 const (
-	PlotFrequencyWeekly PlotFrequency = "weekly"
-	PlotFrequencyDaily  PlotFrequency = "daily"
-	PlotFrequencyHourly PlotFrequency = "hourly"
+	PlotFrequencyWeekly  PlotFrequency = "weekly"
+	PlotFrequencyDaily   PlotFrequency = "daily"
+	PlotFrequencyHourly  PlotFrequency = "hourly"
+	PlotFrequencyMonthly PlotFrequency = "monthly"
+	PlotFrequencyYearly  PlotFrequency = "yearly"
 )
 
+// PlotFrequencyInterval returns a frequency for plots generated every d,
+// written in its canonical form without zero units, such as "15m" or "1h30m".
+// The duration must be at least a minute and divide evenly into a day.
+func PlotFrequencyInterval(d time.Duration) PlotFrequency {
+	if d <= 0 || d%time.Second != 0 {
+		// not a valid interval, but still written as a duration
+		return PlotFrequency(d.String())
+	}
+	var b strings.Builder
+	for _, u := range []struct {
+		unit   time.Duration
+		suffix string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / u.unit; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, u.suffix)
+			d -= n * u.unit
+		}
+	}
+	return PlotFrequency(b.String())
+}
+
 func (f PlotFrequency) String() string { return string(f) }
 
-func (f PlotFrequency) Truncate(t time.Time) time.Time {
+// Interval returns the duration of an interval frequency such as "15m". It
+// returns false for the named frequencies and for intervals that are shorter
+// than a minute or do not divide evenly into a day.
+func (f PlotFrequency) Interval() (time.Duration, bool) {
+	d, err := f.parseInterval()
+	return d, err == nil && d > 0
+}
+
+// parseInterval returns the duration of an interval frequency, zero for the
+// named frequencies and frequencies that are not durations, or an error if
+// the interval is not one that plots can be generated at.
+func (f PlotFrequency) parseInterval() (time.Duration, error) {
+	switch f {
+	case PlotFrequencyWeekly, PlotFrequencyDaily, PlotFrequencyHourly, PlotFrequencyMonthly, PlotFrequencyYearly:
+		return 0, nil
+	}
+	d, err := time.ParseDuration(string(f))
+	if err != nil {
+		return 0, nil
+	}
+	switch {
+	case d < time.Minute:
+		return 0, fmt.Errorf("interval frequency %q must be at least 1m", f)
+	case (24*time.Hour)%d != 0:
+		return 0, fmt.Errorf("interval frequency %q must divide evenly into a day", f)
+	}
+	return d, nil
+}
+
+// Truncate returns the start of the period containing t. If loc is non-nil
+// then t is converted to that location first so that period boundaries are
+// computed in local time, otherwise t is truncated as-is. Weekly periods begin
+// on weekStart.
+func (f PlotFrequency) Truncate(t time.Time, loc *time.Location, weekStart time.Weekday) time.Time {
+	if loc == nil {
+		switch f {
+		case PlotFrequencyWeekly:
+			if weekStart != time.Monday {
+				return f.Truncate(t, t.Location(), weekStart)
+			}
+			return t.Truncate(7 * 24 * time.Hour)
+		case PlotFrequencyDaily:
+			return t.Truncate(24 * time.Hour)
+		case PlotFrequencyHourly:
+			return t.Truncate(time.Hour)
+		case PlotFrequencyMonthly:
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		case PlotFrequencyYearly:
+			return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+		default:
+			if d, ok := f.Interval(); ok {
+				return alignInterval(t, d, time.UTC).In(t.Location())
+			}
+			panic(fmt.Sprintf("unsupported plot frequency: %q", f))
+		}
+	}
+
+	t = t.In(loc)
 	switch f {
 	case PlotFrequencyWeekly:
-		return t.Truncate(7 * 24 * time.Hour)
+		// number of days since the most recent start of week, zero when t is on weekStart
+		offset := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
 	case PlotFrequencyDaily:
-		return t.Truncate(24 * time.Hour)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
 	case PlotFrequencyHourly:
-		return t.Truncate(time.Hour)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case PlotFrequencyMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case PlotFrequencyYearly:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, loc)
 	default:
+		if d, ok := f.Interval(); ok {
+			return alignInterval(t, d, loc)
+		}
 		panic(fmt.Sprintf("unsupported plot frequency: %q", f))
 	}
 }
 
+// alignInterval returns the start of the interval of length d containing t,
+// where intervals are aligned to the start of the day in loc. Plots without a
+// time zone have their intervals aligned to the start of the day in UTC.
+func alignInterval(t time.Time, d time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return midnight.Add(t.Sub(midnight).Truncate(d))
+}
+
+// parseWeekday parses the English name of a day of the week, ignoring case.
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday: %q", s)
+}
+
 type ProcessingProfile struct {
-	Source   string           `yaml:"source"`
+	Source   string           `yaml:"source"` // directory, file pattern or remote source of the plot definitions
 	OutTpl   string           `yaml:"output"`
 	Variants []map[string]any `yaml:"variants"`
+	FS       fs.FS            `yaml:"-"` // optional filesystem holding the plot definitions, in which Source names a directory
+
+	fsys    fs.FS              // opened source of the plot definitions, nil until first used
+	dir     string             // name of the directory fsys is rooted at
+	pattern string             // pattern matching the plot definition files within fsys
+	cleanup func() error       // removes files fetched for a remote source, if any
+	renames map[plotRef]string // new names of plots whose output filenames collide with others, if suffixed
 }
 
 func (p *ProcessingProfile) SourceIsDir() bool {
@@ -81,41 +242,231 @@ func (p *ProcessingProfile) SourceIsDir() bool {
 }
 
 type PlotDef struct {
-	Name       string         `yaml:"name"`
-	Frequency  PlotFrequency  `yaml:"frequency"`
-	Datasets   []DataSetDef   `yaml:"datasets"`
-	Computed   []ComputedDef  `yaml:"computed"`
-	Series     []SeriesDef    `yaml:"series"`
-	Scalars    []ScalarDef    `yaml:"scalars"`
-	Tables     []TableDef     `yaml:"tables"`
-	Layout     grob.Layout    `yaml:"layout"`
-	Config     map[string]any `yaml:"config"`
-	Parameters map[string]any `yaml:"params"`
-	DynLayout  map[string]any `yaml:"dynamicLayout"`
+	Name          string                      `yaml:"name"`
+	Frequency     PlotFrequency               `yaml:"frequency"`
+	Datasets      []DataSetDef                `yaml:"datasets"`
+	Joins         []JoinDef                   `yaml:"joins"`
+	Computed      []ComputedDef               `yaml:"computed"`
+	Series        []SeriesDef                 `yaml:"series"`
+	Scalars       []ScalarDef                 `yaml:"scalars"`
+	Tables        []TableDef                  `yaml:"tables"`
+	Annotations   []AnnotationDef             `yaml:"annotations"`
+	Shapes        []ShapeDef                  `yaml:"shapes"`
+	Thresholds    []ThresholdDef              `yaml:"thresholds"` // optional target lines and bands of acceptable values
+	Layout        PlotLayout                  `yaml:"layout"`
+	Config        map[string]any              `yaml:"config"`
+	Parameters    map[string]any              `yaml:"params"`
+	DynLayout     map[string]any              `yaml:"dynamicLayout"`
+	Theme         string                      `yaml:"theme"`         // optional name of the theme used to style the plot
+	Tags          []string                    `yaml:"tags"`          // optional labels used to select the plot in batch mode
+	Timezone      string                      `yaml:"timezone"`      // optional IANA name of the location used to compute period boundaries
+	WeekStart     string                      `yaml:"weekStart"`     // optional name of the day weekly periods start on, defaults to monday
+	BarMode       BarMode                     `yaml:"barmode"`       // optional arrangement of bars from multiple series, overrides the layout
+	NonPositive   NonPositiveMode             `yaml:"nonPositive"`   // optional handling of zero and negative values plotted on a log axis
+	ClampValue    float64                     `yaml:"clampValue"`    // value that non-positive values are clamped to, defaults to the smallest positive value of the series
+	QueryTimeout  time.Duration               `yaml:"queryTimeout"`  // optional limit on the time each dataset query may take, overrides the global query timeout
+	ExportData    bool                        `yaml:"exportData"`    // write the plotted data as CSV alongside the plot
+	Variants      []PlotVariant               `yaml:"variants"`      // optional family of plots generated from the definition in batch mode
+	Outputs       []OutputFormat              `yaml:"outputs"`       // optional formats written in batch mode, replacing those configured for the run
+	Bind          []string                    `yaml:"bind"`          // optional names of template params passed to queries as bound parameters
+	XRange        *XRangeDef                  `yaml:"xrange"`        // optional visible range of a time x axis, absolute or relative to the basis time
+	CategoryOrder map[string]CategoryOrderDef `yaml:"categoryOrder"` // optional order of the categories of the x or y axis, keyed by axis
+	Facet         *FacetDef                   `yaml:"facet"`         // optional split of the series into a grid of subplots by the values of a field
+	AxisFormat    map[string]AxisFormatDef    `yaml:"axisFormat"`    // optional formats of the ticks of the x, y or y2 axis, keyed by axis
+	OnEmpty       EmptyAction                 `yaml:"onEmpty"`       // what happens when all datasets are empty: placeholder, skip or error
+	Width         int                         `yaml:"width"`         // optional width of the plot in pixels, overrides the layout
+	Height        int                         `yaml:"height"`        // optional height of the plot in pixels, overrides the layout
+	Responsive    bool                        `yaml:"responsive"`    // omit the width and height from the layout so the plot fills its container, using them only for images
+	location      *time.Location              // resolved from Timezone, nil if not specified
+	weekStart     *time.Weekday               // resolved from WeekStart, nil if not specified
+	path          string                      // path of the file the plot definition was read from
+	source        string                      // untemplated source of the plot definition, templated again for earlier periods of compared series
+	queryFS       fs.FS                       // filesystem rooted at the directory of the plot definition, which its query files are read from
+	variant       string                      // name of the template variant the plot definition was generated for, if any
+	unthemed      *PlotLayout                 // layout of the generated figure before its theme was applied
+	config        *PlotConfig                 // configuration the plot definition was loaded with, which it is generated with
+	fig           *grob.Fig                   // the generated figure
+	export        *DataExport                 // data plotted by the generated figure, nil unless ExportData is set
+	plotted       []plottedSeries             // series plotted by the generated figure
+	facets        []string                    // values of the facet field of the generated figure, in the order of their subplots
+	timing        *PlotTiming                 // time taken to generate the figure, nil unless timing is recorded
+	empty         bool                        // if all datasets of the generated figure were empty
+	imageWidth    int                         // width of the images of the generated figure, zero for the width of its layout
+	imageHeight   int                         // height of the images of the generated figure, zero for the height of its layout
+}
+
+// A PlotVariant is a member of a family of plots generated from a single plot
+// definition. Batch mode executes the templates of the plot definition once
+// for each variant with its params added to the template params, and appends
+// its name to the output filename.
+type PlotVariant struct {
+	Name   string         `yaml:"name"`
+	Params map[string]any `yaml:"params"`
+}
+
+// config returns a copy of the config whose template params include the
+// params of the variant, which take precedence.
+func (v *PlotVariant) config(cfg *PlotConfig) *PlotConfig {
+	vcfg := *cfg
+	vcfg.TemplateParams = make(map[string]any, len(cfg.TemplateParams)+len(v.Params))
+	for k, val := range cfg.TemplateParams {
+		vcfg.TemplateParams[k] = val
+	}
+	for k, val := range v.Params {
+		vcfg.TemplateParams[k] = val
+	}
+	return &vcfg
+}
+
+// Selected reports whether the plot definition is selected by the name and
+// tag filters of the config.
+func (c *PlotConfig) Selected(pd *PlotDef) bool {
+	if c.MatchGlob != "" {
+		if ok, _ := path.Match(c.MatchGlob, pd.Name); !ok {
+			return false
+		}
+	}
+	if c.MatchName != nil && !c.MatchName.MatchString(pd.Name) {
+		return false
+	}
+	if len(c.Tags) == 0 {
+		return true
+	}
+
+	has := make(map[string]bool, len(pd.Tags))
+	for _, t := range pd.Tags {
+		has[t] = true
+	}
+	matched := 0
+	for _, t := range c.Tags {
+		if has[t] {
+			matched++
+		}
+	}
+	if c.AnyTag {
+		return matched > 0
+	}
+	return matched == len(c.Tags)
+}
+
+// SourceNames returns the distinct names of the datasources used by the plot's datasets.
+func (pd *PlotDef) SourceNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, ds := range pd.Datasets {
+		if !seen[ds.Source] {
+			seen[ds.Source] = true
+			names = append(names, ds.Source)
+		}
+	}
+	return names
+}
+
+// StartOfWeek returns the day that weekly periods of the plot start on.
+func (pd *PlotDef) StartOfWeek() time.Weekday {
+	if pd.weekStart == nil {
+		return time.Monday
+	}
+	return *pd.weekStart
 }
 
 type DataSetDef struct {
-	Name   string `yaml:"name"`
-	Source string `yaml:"source"`
-	Query  string `yaml:"query"`
+	Name      string      `yaml:"name"`
+	Source    string      `yaml:"source"`
+	Query     string      `yaml:"query"`
+	QueryFile string      `yaml:"queryFile"` // optional path of a file holding the query, relative to the plot definition, used instead of query
+	Types     []TypeDef   `yaml:"types"`     // optional types the values of fields are converted to, before computing columns
+	Columns   []ColumnDef `yaml:"columns"`   // optional columns computed from the fields of each row
+	OrderBy   []OrderDef  `yaml:"orderBy"`   // optional fields to sort the rows by, after computing columns
+	Limit     int         `yaml:"limit"`     // optional maximum number of rows kept, after sorting
+	Setup     []string    `yaml:"setup"`     // optional statements run before the query in the same session, such as SET statements
+	Stream    bool        `yaml:"stream"`    // optional, count the rows into the bins of the histogram series or heatmap table reading the dataset as they are read instead of holding them
 }
 
 type SeriesDef struct {
-	Type          SeriesType `yaml:"type"`
-	Name          string     `yaml:"name"` // name of the series
-	Color         string     `yaml:"color"`
-	Marker        MarkerType `yaml:"marker"`
-	Fill          FillType   `yaml:"fill"`
-	DataSet       string     `yaml:"dataset"`
-	Labels        string     `yaml:"labels"`     // the name of the field the series should use for labels
-	Values        string     `yaml:"values"`     // the name of the field the series should use for values
-	GroupField    string     `yaml:"groupfield"` // optional name of a field the series should use for grouping into related series
-	GroupValue    string     `yaml:"groupvalue"` // optional value of a field the series should use for grouping into related series
-	Percent       bool       `yaml:"percent"`
-	order         int        // used for retaining ordering of series
-	HoverTemplate string     `yaml:"hovertemplate,omitempty"`
-	Visible       *bool      `yaml:"visible"`
-	Yaxis         string     `yaml:"yaxis"`
+	Type           SeriesType        `yaml:"type"`
+	Name           string            `yaml:"name"` // name of the series
+	Color          string            `yaml:"color"`
+	Marker         MarkerType        `yaml:"marker"`
+	Fill           FillType          `yaml:"fill"`
+	DataSet        string            `yaml:"dataset"`
+	Labels         string            `yaml:"labels"`     // the name of the field the series should use for labels
+	Values         string            `yaml:"values"`     // the name of the field the series should use for values
+	GroupField     string            `yaml:"groupfield"` // optional name of a field the series should use for grouping into related series
+	GroupValue     string            `yaml:"groupvalue"` // optional value of a field the series should use for grouping into related series
+	Percent        bool              `yaml:"percent"`
+	order          int               // used for retaining ordering of series
+	HoverTemplate  string            `yaml:"hovertemplate,omitempty"` // optional plotly hover template, which may reference the fields of each row in [[ ]] actions
+	Visible        SeriesVisibility  `yaml:"visible"`                 // whether the series is shown: true, false or legendonly, defaults to true
+	LegendGroup    string            `yaml:"legendgroup"`             // optional name of a group of series that are shown and hidden together from the legend
+	Yaxis          string            `yaml:"yaxis"`
+	Open           string            `yaml:"open"`           // the name of the field a candlestick series should use for opening values
+	High           string            `yaml:"high"`           // the name of the field a candlestick series should use for high values
+	Low            string            `yaml:"low"`            // the name of the field a candlestick series should use for low values
+	Close          string            `yaml:"close"`          // the name of the field a candlestick series should use for closing values
+	IncreaseColor  string            `yaml:"increaseColor"`  // the color a candlestick series should use for increasing values
+	DecreaseColor  string            `yaml:"decreaseColor"`  // the color a candlestick series should use for decreasing values
+	Points         string            `yaml:"points"`         // the sample points a box or violin series should show: all, outliers, suspectedoutliers or none
+	QuartileMethod string            `yaml:"quartileMethod"` // the method a box series should use to compute quartiles: linear, exclusive or inclusive
+	ShowBox        bool              `yaml:"showBox"`        // if a violin series should show a box plot inside the violin
+	MeanLine       bool              `yaml:"meanLine"`       // if a violin series should show a line at the mean
+	Trendline      string            `yaml:"trendline"`      // optional trendline to add alongside the series: linear, poly:N or rolling-mean:N
+	MovingAverage  *MovingAverageDef `yaml:"movingAverage"`  // optional smoothed copy of the series to add alongside it
+	Cumulative     *CumulativeDef    `yaml:"cumulative"`     // optional running total that replaces the values of the series, accumulated in the order of the labels
+	Normalize      NormalizeMode     `yaml:"normalize"`      // optional rescaling of the values relative to the other normalized series on the same axes: percent
+	Downsample     *DownsampleDef    `yaml:"downsample"`     // optional reduction of a dense series to fewer points before it is plotted
+	Gaps           GapMode           `yaml:"gaps"`           // how missing intervals between time labels are plotted: connect, break or zero
+	Interval       string            `yaml:"interval"`       // optional expected duration between points used to detect gaps, defaults to the plot frequency
+	ErrorX         *ErrorBarDef      `yaml:"error_x"`        // optional horizontal error bars of a bar, line or scatter series
+	ErrorY         *ErrorBarDef      `yaml:"error_y"`        // optional vertical error bars of a bar, line or scatter series
+	Hole           float64           `yaml:"hole"`           // fraction of the radius of a pie series cut out of the middle to make a donut
+	Pull           string            `yaml:"pull"`           // optional label of the slice of a pie series to pull out from the center
+	TextInfo       string            `yaml:"textInfo"`       // the information shown on the slices of a pie series: percent, value, label or a combination such as label+percent
+	Stack          string            `yaml:"stack"`          // optional name of a stack of area series, each stacked on the series before it
+	Bins           *BinsDef          `yaml:"bins"`           // optional bins a histogram series counts its values in, defaults to bins chosen from the number of values
+	NBins          int               `yaml:"nbins"`          // optional number of bins of a histogram series, the same as nbins of its bins
+	BinStart       *float64          `yaml:"binStart"`       // optional lower edge of the first bin of a histogram series, the same as start of its bins
+	BinEnd         *float64          `yaml:"binEnd"`         // optional upper edge of the range of a histogram series, the same as end of its bins
+	BinSize        float64           `yaml:"binSize"`        // optional width of each bin of a histogram series, the same as size of its bins
+	Compare        *CompareDef       `yaml:"compare"`        // optional comparison with the series for an earlier period, drawn over it
+	Options        map[string]any    `yaml:"options"`        // optional settings read by the builder of a registered series type
+	previous       *previousSeries   // set if the series is the copy of a compared series for an earlier period
+}
+
+// ErrorBarDef configures error bars read from dataset fields.
+type ErrorBarDef struct {
+	Field      string `yaml:"field"`      // the name of the field holding the error, or the upper error if minusField is set
+	MinusField string `yaml:"minusField"` // optional name of the field holding the lower error, making the error bars asymmetric
+	Visible    *bool  `yaml:"visible"`    // if the error bars should be shown, defaults to true
+}
+
+// columnFields returns the names of the fields, other than labels and values,
+// that the series reads from its dataset, keyed by their role in the series.
+func (s *SeriesDef) columnFields() map[string]string {
+	cols := make(map[string]string)
+	for role, field := range map[string]string{
+		"open":  s.Open,
+		"high":  s.High,
+		"low":   s.Low,
+		"close": s.Close,
+	} {
+		if field != "" {
+			cols[role] = field
+		}
+	}
+	if s.Cumulative != nil && s.Cumulative.Reset != "" {
+		cols[cumulativeResetColumn] = s.Cumulative.Reset
+	}
+	for role, eb := range map[string]*ErrorBarDef{"error_x": s.ErrorX, "error_y": s.ErrorY} {
+		if eb == nil {
+			continue
+		}
+		cols[role] = eb.Field
+		if eb.MinusField != "" {
+			cols[role+"_minus"] = eb.MinusField
+		}
+	}
+	return cols
 }
 
 type SeriesType string
@@ -127,19 +478,79 @@ const (
 	SeriesTypeScatter SeriesType = "scatter" // scatter
 	SeriesTypeBox     SeriesType = "box"     // vertical box plot
 	SeriesTypeHBox    SeriesType = "hbox"    // horizontal box plot
+	SeriesTypeViolin  SeriesType = "violin"  // vertical violin plot
+	SeriesTypeHViolin SeriesType = "hviolin" // horizontal violin plot
+
+	SeriesTypeCandlestick SeriesType = "candlestick" // candlestick chart of open, high, low and close fields, labels may be categories or times
+	SeriesTypePie         SeriesType = "pie"         // pie chart of values by label, a donut if hole is set
+	SeriesTypeArea        SeriesType = "area"        // lines filled down to zero, or stacked on the series before them if stack is set
+	SeriesTypeHistogram   SeriesType = "histogram"   // bars counting the values in bins, computed when the plot is generated
 )
 
+// Other types of series may be added with RegisterPlotType.
+
 func (t SeriesType) String() string { return string(t) }
 
+// BarMode determines how bars at the same location from multiple series are
+// arranged, matching plotly's layout.barmode.
+type BarMode string
+
+const (
+	BarModeDefault  BarMode = ""
+	BarModeGroup    BarMode = "group"    // bars are placed beside each other
+	BarModeStack    BarMode = "stack"    // bars are stacked on top of each other
+	BarModeRelative BarMode = "relative" // bars are stacked with negative values below the axis
+	BarModeOverlay  BarMode = "overlay"  // bars are plotted over each other
+)
+
+func (m BarMode) String() string { return string(m) }
+
+// NonPositiveMode determines how zero and negative values plotted on a log
+// axis are handled.
+type NonPositiveMode string
+
+const (
+	NonPositiveModeKeep  NonPositiveMode = ""      // values are plotted as-is and omitted by plotly
+	NonPositiveModeDrop  NonPositiveMode = "drop"  // points with non-positive values are removed from the series
+	NonPositiveModeClamp NonPositiveMode = "clamp" // non-positive values are replaced by the clamp value
+)
+
+func (m NonPositiveMode) String() string { return string(m) }
+
 type FillType string
 
 const (
 	FillTypeNone   FillType = ""
-	FillTypeToZero FillType = "tozero"
+	FillTypeToZero FillType = "tozero" // fill down to zero
+	FillTypeToNext FillType = "tonext" // fill down to the series before
 )
 
 func (t FillType) String() string { return string(t) }
 
+// SeriesVisibility is whether a series is shown when the plot is first drawn.
+type SeriesVisibility string
+
+const (
+	SeriesVisibilityDefault    SeriesVisibility = ""           // same as true
+	SeriesVisibilityTrue       SeriesVisibility = "true"       // the series is shown
+	SeriesVisibilityFalse      SeriesVisibility = "false"      // the series is neither drawn nor listed in the legend
+	SeriesVisibilityLegendOnly SeriesVisibility = "legendonly" // the series is listed in the legend, from which it can be shown
+)
+
+func (v SeriesVisibility) String() string { return string(v) }
+
+// traceValue returns the visibility as the value plotly expects.
+func (v SeriesVisibility) traceValue() any {
+	switch v {
+	case SeriesVisibilityFalse:
+		return false
+	case SeriesVisibilityLegendOnly:
+		return "legendonly"
+	default:
+		return true
+	}
+}
+
 type MarkerType string
 
 const (
@@ -192,6 +603,17 @@ const (
 
 func (t DeltaType) String() string { return string(t) }
 
+// A DataSource runs the queries of datasets. The query is the text given in
+// the plot definition after templating, and params are the values of any
+// bound params that its placeholders refer to, which are only passed to
+// sources that implement ParamBinder. The context carries the basis of the
+// query and may carry a row limit, which a source should respect.
+//
+// A datasource may implement io.Closer to release connections when a run
+// ends. Types of datasource are made available for source urls with
+// RegisterDataSource. The names of DataSource, DataSet and GetDataSet
+// predate the registry and are kept so that existing datasources still
+// satisfy the interface.
 type DataSource interface {
 	GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error)
 }
@@ -201,6 +623,14 @@ type DataSeries struct {
 	Values []float64
 }
 
+// A DataSet is the tabular result of a query, read one row at a time. Next
+// advances to the following row, returning false once the rows are exhausted
+// or an error has occurred, which is then reported by Err. Field returns the
+// value of the named field of the current row, or an error value if the
+// dataset has no such field. Values should be nil, a string, a bool, a
+// numeric type or a time.Time, and every row should have the same fields.
+// ResetIterator starts reading from the first row again. A dataset may
+// implement FieldLister so that it can be joined with others.
 type DataSet interface {
 	Next() bool
 	Err() error
@@ -240,24 +670,36 @@ const (
 
 func (t ComputeType) String() string { return string(t) }
 
+// PlotLayout is the layout of a plot. It extends the plotly layout supported
+// by grob with a secondary y axis and the axes of subplots.
+type PlotLayout struct {
+	grob.Layout `yaml:",inline"`
+	Yaxis2      *grob.LayoutYaxis   `json:"yaxis2,omitempty" yaml:"yaxis2"`
+	facetXaxes  []*grob.LayoutXaxis // x axes of the subplots of a faceted plot after the first
+	facetYaxes  []*grob.LayoutYaxis // y axes of the subplots of a faceted plot after the first
+}
+
 type FigureData struct {
 	*grob.Fig
+	Layout    *PlotLayout    `json:"layout,omitempty"` // replaces the layout of the fig
 	Params    map[string]any `json:"params"`
 	DynLayout map[string]any `json:"dynamicLayout"`
 	Config    map[string]any `json:"config"`
 }
 
 type TableDef struct {
-	Type     TableType             `yaml:"type"`
-	Name     string                `yaml:"name"`
-	DataSet  string                `yaml:"dataset"`
-	LabelsX  string                `yaml:"xLabels"`
-	LabelsY  string                `yaml:"yLabels"`
-	Values   string                `yaml:"values"`
-	Color    string                `yaml:"color"`
-	Colorbar *grob.HeatmapColorbar `yaml:"colorbar"`
-	Yaxis    string                `yaml:"yaxis"`
-	order    int                   // used for retaining ordering of series
+	Type       TableType             `yaml:"type"`
+	Name       string                `yaml:"name"`
+	DataSet    string                `yaml:"dataset"`
+	LabelsX    string                `yaml:"xLabels"`
+	LabelsY    string                `yaml:"yLabels"`
+	Values     string                `yaml:"values"`
+	Color      string                `yaml:"color"`
+	Colorbar   *grob.HeatmapColorbar `yaml:"colorbar"`
+	Yaxis      string                `yaml:"yaxis"`
+	Bins       *HeatmapBinsDef       `yaml:"bins"`       // optional binning of the x and y fields of a heatmap into counts, used instead of values
+	Colorscale string                `yaml:"colorscale"` // optional name of the plotly colorscale of a heatmap, defaults to Viridis
+	order      int                   // used for retaining ordering of series
 }
 
 type TableType string
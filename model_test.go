@@ -0,0 +1,96 @@
+package ashby
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPlotFrequencyInterval(t *testing.T) {
+	for d, want := range map[time.Duration]PlotFrequency{
+		15 * time.Minute:             "15m",
+		time.Hour:                    "1h",
+		90 * time.Minute:             "1h30m",
+		90 * time.Second:             "1m30s",
+		24 * time.Hour:               "24h",
+		1500 * time.Millisecond:      "1.5s",
+		6*time.Hour + 20*time.Minute: "6h20m",
+		2*time.Hour + 30*time.Second: "2h30s",
+		-5 * time.Minute:             "-5m0s",
+	} {
+		if got := PlotFrequencyInterval(d); got != want {
+			t.Errorf("frequency of %s: got %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestPlotFrequencyParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		freq    PlotFrequency
+		want    time.Duration
+		wantErr bool
+	}{
+		{freq: PlotFrequencyDaily},
+		{freq: "fortnightly"},
+		{freq: "15m", want: 15 * time.Minute},
+		{freq: "90s", want: 90 * time.Second},
+		{freq: "24h", want: 24 * time.Hour},
+		{freq: "30s", wantErr: true},
+		{freq: "7m", wantErr: true},
+		{freq: "48h", wantErr: true},
+		{freq: "-1h", wantErr: true},
+	} {
+		d, err := tc.freq.parseInterval()
+		if (err != nil) != tc.wantErr || d != tc.want {
+			t.Errorf("parse interval %q: got %s and error %v, want %s and error %v", tc.freq, d, err, tc.want, tc.wantErr)
+		}
+		if _, ok := tc.freq.Interval(); ok != (tc.want > 0) {
+			t.Errorf("interval %q: got ok %v, want %v", tc.freq, ok, tc.want > 0)
+		}
+	}
+}
+
+func TestPlotFrequencyTruncateInterval(t *testing.T) {
+	freq := PlotFrequency("90m")
+	basis := time.Date(2023, 5, 8, 13, 0, 0, 0, time.UTC)
+
+	// without a time zone the intervals are aligned to midnight UTC, the
+	// same as with the UTC time zone
+	want := time.Date(2023, 5, 8, 12, 0, 0, 0, time.UTC)
+	if got := freq.Truncate(basis, nil, time.Monday); !got.Equal(want) {
+		t.Errorf("truncate without a time zone: got %s, want %s", got, want)
+	}
+	if got := freq.Truncate(basis, time.UTC, time.Monday); !got.Equal(want) {
+		t.Errorf("truncate in UTC: got %s, want %s", got, want)
+	}
+
+	// in a time zone the intervals are aligned to local midnight
+	loc := time.FixedZone("UTC+1", 60*60)
+	want = time.Date(2023, 5, 8, 13, 30, 0, 0, loc)
+	if got := freq.Truncate(basis, loc, time.Monday); !got.Equal(want) {
+		t.Errorf("truncate in %s: got %s, want %s", loc, got, want)
+	}
+}
+
+func TestPlotConfigSelected(t *testing.T) {
+	pd := &PlotDef{Name: "peers-eu", Tags: []string{"network", "dht"}}
+	for name, tc := range map[string]struct {
+		cfg  *PlotConfig
+		want bool
+	}{
+		"no filters":          {cfg: &PlotConfig{}, want: true},
+		"glob matching name":  {cfg: &PlotConfig{MatchGlob: "peers-*"}, want: true},
+		"glob of filename":    {cfg: &PlotConfig{MatchGlob: "peers-*.yaml"}, want: false},
+		"glob not matching":   {cfg: &PlotConfig{MatchGlob: "crawls*"}, want: false},
+		"regexp matching":     {cfg: &PlotConfig{MatchName: regexp.MustCompile(`-eu$`)}, want: true},
+		"regexp not matching": {cfg: &PlotConfig{MatchName: regexp.MustCompile(`^eu`)}, want: false},
+		"all tags":            {cfg: &PlotConfig{Tags: []string{"network", "dht"}}, want: true},
+		"missing tag":         {cfg: &PlotConfig{Tags: []string{"network", "web"}}, want: false},
+		"any tag":             {cfg: &PlotConfig{Tags: []string{"network", "web"}, AnyTag: true}, want: true},
+		"glob and tags":       {cfg: &PlotConfig{MatchGlob: "peers-*", Tags: []string{"web"}}, want: false},
+	} {
+		if got := tc.cfg.Selected(pd); got != tc.want {
+			t.Errorf("%s: got selected %v, want %v", name, got, tc.want)
+		}
+	}
+}
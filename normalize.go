@@ -0,0 +1,70 @@
+package ashby
+
+// NormalizeMode determines how the values of a series are rescaled relative
+// to the other series plotted alongside it.
+type NormalizeMode string
+
+const (
+	NormalizeModeNone    NormalizeMode = ""        // values are plotted as they are
+	NormalizeModePercent NormalizeMode = "percent" // values are a percentage of the total of their label across the normalized series
+)
+
+func (m NormalizeMode) String() string { return string(m) }
+
+// normalizeGroup identifies the series that are normalized together, which
+// are those plotted against the same axes of the same subplot and, for area
+// series, in the same stack.
+type normalizeGroup struct {
+	labelAxis string
+	valueAxis string
+	facet     int
+	stack     string
+}
+
+// normalizePercent replaces the values of the series that are normalized to
+// percentages with their share of the total of the values with the same
+// label across the series of their group, so that the series of each label
+// sum to 100. Values that are not numeric are left null, as are all the
+// values of a label whose total is zero.
+func normalizePercent(data []*LabeledSeries) {
+	totals := make(map[normalizeGroup]map[string]float64)
+	groupOf := func(ls *LabeledSeries) normalizeGroup {
+		return normalizeGroup{
+			labelAxis: ls.SeriesDef.labelAxis(),
+			valueAxis: ls.SeriesDef.valueAxis(),
+			facet:     ls.facet,
+			stack:     ls.SeriesDef.Stack,
+		}
+	}
+
+	for _, ls := range data {
+		if ls.SeriesDef.Normalize != NormalizeModePercent || len(ls.Labels) != len(ls.Values) {
+			continue
+		}
+		g := groupOf(ls)
+		if totals[g] == nil {
+			totals[g] = make(map[string]float64)
+		}
+		for i, v := range ls.Values {
+			if f, ok := numericValue(v); ok {
+				totals[g][stringify(ls.Labels[i])] += f
+			}
+		}
+	}
+
+	for _, ls := range data {
+		if ls.SeriesDef.Normalize != NormalizeModePercent || len(ls.Labels) != len(ls.Values) {
+			continue
+		}
+		byLabel := totals[groupOf(ls)]
+		for i, v := range ls.Values {
+			f, ok := numericValue(v)
+			total := byLabel[stringify(ls.Labels[i])]
+			if !ok || total == 0 {
+				ls.Values[i] = nil
+				continue
+			}
+			ls.Values[i] = f / total * 100
+		}
+	}
+}
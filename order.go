@@ -0,0 +1,144 @@
+package ashby
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OrderDef orders the rows of a dataset by the values of a field. Numbers
+// and times are compared by value and other values by their string form.
+// Null values are placed last whatever the direction.
+type OrderDef struct {
+	Field     string        `yaml:"field"`     // the name of the field to order by
+	Direction SortDirection `yaml:"direction"` // asc or desc, defaults to asc
+}
+
+type SortDirection string
+
+const (
+	SortDirectionDefault SortDirection = ""     // same as asc
+	SortDirectionAsc     SortDirection = "asc"  // smallest values first
+	SortDirectionDesc    SortDirection = "desc" // largest values first
+)
+
+func (d SortDirection) String() string { return string(d) }
+
+// orderDataSet returns the rows of ds sorted by the fields given by order
+// and limited to the first limit rows, if limit is positive. Without an order
+// the rows are kept in the order the source returned them. Rows that are
+// equal in all the fields of order are sorted by the remaining fields of the
+// dataset, so that the rows kept by a limit do not depend on the order in
+// which the source returned them.
+func orderDataSet(ds DataSet, order []OrderDef, limit int) (DataSet, error) {
+	fields, ok := fieldNames(ds)
+	if !ok {
+		return nil, fmt.Errorf("dataset does not list its fields")
+	}
+
+	var rows [][]any
+	ds.ResetIterator()
+	for ds.Next() {
+		row := make([]any, len(fields))
+		for i, f := range fields {
+			v := ds.Field(f)
+			if err, ok := v.(error); ok {
+				return nil, fmt.Errorf("field %q: %w", f, err)
+			}
+			row[i] = v
+		}
+		rows = append(rows, row)
+	}
+	if ds.Err() != nil {
+		return nil, fmt.Errorf("iteration ended with an error: %w", ds.Err())
+	}
+
+	// the fields compared, in order, and whether each is descending
+	type sortKey struct {
+		field int
+		desc  bool
+	}
+	index := make(map[string]int, len(fields))
+	for i, f := range fields {
+		index[f] = i
+	}
+	var keys []sortKey
+	used := make(map[int]bool, len(fields))
+	for _, o := range order {
+		i, ok := index[o.Field]
+		if !ok {
+			return nil, fmt.Errorf("unknown field to order by: %q", o.Field)
+		}
+		used[i] = true
+		keys = append(keys, sortKey{field: i, desc: o.Direction == SortDirectionDesc})
+	}
+	for i := range fields {
+		if !used[i] && len(order) > 0 {
+			keys = append(keys, sortKey{field: i})
+		}
+	}
+
+	sort.SliceStable(rows, func(a, b int) bool {
+		for _, k := range keys {
+			va, vb := rows[a][k.field], rows[b][k.field]
+			c := compareOrderValues(va, vb)
+			if c == 0 {
+				continue
+			}
+			if k.desc && va != nil && vb != nil {
+				c = -c
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	data := make(map[string][]any, len(fields))
+	for i, f := range fields {
+		vals := make([]any, len(rows))
+		for r, row := range rows {
+			vals[r] = row[i]
+		}
+		data[f] = vals
+	}
+	sds := NewStaticDataSet(data)
+	sds.fields = fields
+	return sds, nil
+}
+
+// compareOrderValues returns -1, 0 or 1 as v1 sorts before, with or after
+// v2, placing nulls after all other values.
+func compareOrderValues(v1, v2 any) int {
+	switch {
+	case v1 == nil && v2 == nil:
+		return 0
+	case v1 == nil:
+		return 1
+	case v2 == nil:
+		return -1
+	}
+
+	if f1, ok := numericValue(v1); ok {
+		if f2, ok := numericValue(v2); ok {
+			switch {
+			case f1 < f2:
+				return -1
+			case f1 > f2:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	if t1, ok := v1.(time.Time); ok {
+		if t2, ok := v2.(time.Time); ok {
+			return t1.Compare(t2)
+		}
+	}
+	return strings.Compare(stringify(v1), stringify(v2))
+}
@@ -1,13 +1,20 @@
-package main
+package ashby
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -18,50 +25,229 @@ import (
 // Plots will be placed into a folder named as base/{year}/{month}/{day}
 // Hourly plots will be placed in a subfolder named {hour}
 // If the plot is determined to be the latest version then it will be
-// copied to a directory called "latest"
+// copied to a directory called "latest" (or symlinked, depending on LatestMode)
 // So a plot called demo.json dated 2023-05-08 will be placed in:
 //
 //	base/2023/05/08/demo.json
 //	latest/demo.json
+//
+// An Organizer with a Variant places the plot in the same directories with
+// the variant added to its filename, such as demo.dark.json.
+//
+// An Organizer is safe for concurrent use: writes to the same path are
+// serialized. An Organizer must not be copied after first use.
 type Organizer struct {
-	Base     string
-	Template string
-	Params   map[string]any
+	Base        string
+	Template    string
+	Params      map[string]any
+	Retention   RetentionPolicy
+	LatestMode  LatestMode
+	Backend     Backend       // where plots are stored, defaults to the local filesystem
+	DryRun      bool          // log the plots that would be written without modifying any files
+	Compression Compression   // compression applied to written plots
+	WriteMeta   bool          // write a .meta sidecar recording the provenance of each dated plot
+	Clock       Clock         // tells the generation time recorded in .meta sidecars, defaults to the system clock
+	Variant     string        // optional suffix added to filenames before their extension, such as demo.dark.json
+	Renderer    ImageRenderer // renders the static images requested when writing plots
+	HTML        *HTMLOptions  // options of the HTML pages written alongside plots, nil to use the defaults
+
+	// StalenessSource controls which time IsStaleOrMissing compares against
+	// the expected time.
+	StalenessSource StalenessSource
+
+	locks sync.Map // maps output paths to a *sync.Mutex guarding writes to them
+}
+
+// lock acquires the lock for writing to path and returns a function that releases it.
+func (o *Organizer) lock(path string) func() {
+	v, _ := o.locks.LoadOrStore(path, new(sync.Mutex))
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// StalenessSource is the source of the time used to decide whether an
+// existing plot is stale.
+type StalenessSource string
+
+const (
+	StalenessSourceMtime     StalenessSource = "mtime"     // the modification time of the plot file (the default)
+	StalenessSourceBasisTime StalenessSource = "basistime" // the basis time recorded in the .meta sidecar or the plot's layout meta
+)
+
+func (s StalenessSource) String() string { return string(s) }
+
+// Compression is the type of compression applied to written plots.
+type Compression string
+
+const (
+	CompressionNone Compression = "none" // write plain JSON (the default)
+	CompressionGzip Compression = "gzip" // gzip plots and add a .gz suffix to their filenames
+)
+
+func (c Compression) String() string { return string(c) }
+
+// WithVariant returns a new Organizer with the same configuration that
+// writes the named variant of plots.
+func (o *Organizer) WithVariant(variant string) *Organizer {
+	return &Organizer{
+		Base:            o.Base,
+		Template:        o.Template,
+		Params:          o.Params,
+		Retention:       o.Retention,
+		LatestMode:      o.LatestMode,
+		Backend:         o.Backend,
+		DryRun:          o.DryRun,
+		Compression:     o.Compression,
+		WriteMeta:       o.WriteMeta,
+		Clock:           o.Clock,
+		Variant:         variant,
+		Renderer:        o.Renderer,
+		HTML:            o.HTML,
+		StalenessSource: o.StalenessSource,
+	}
 }
 
-func (o *Organizer) Filename(name string) (string, error) {
-	t, err := template.New("").Parse(o.Template)
+func (o *Organizer) backend() Backend {
+	if o.Backend == nil {
+		return FSBackend{}
+	}
+	return o.Backend
+}
+
+// LatestMode controls how the latest version of a plot is placed in the
+// "latest" directory.
+type LatestMode string
+
+const (
+	LatestModeCopy    LatestMode = "copy"    // write a copy of the plot (the default)
+	LatestModeSymlink LatestMode = "symlink" // create a relative symlink to the dated plot
+)
+
+func (m LatestMode) String() string { return string(m) }
+
+// A RetentionPolicy controls which historical dated plots are removed by Prune.
+// A zero RetentionPolicy retains everything.
+type RetentionPolicy struct {
+	MaxAge   time.Duration // remove plots whose period started longer than this ago, zero means no limit
+	MaxCount int           // retain at most this many of the newest plots, zero means no limit
+	DryRun   bool          // report the plots that would be removed without deleting them
+}
+
+func (r RetentionPolicy) IsZero() bool {
+	return r.MaxAge == 0 && r.MaxCount == 0
+}
+
+// Filename returns the filename of the named plot. The name of the template
+// variant of the plot, if any, is appended to the name with a hyphen before
+// executing the filename template, which may also refer to it as .Variant.
+// The template may use the same functions as plot definition templates. The
+// filename may contain directories but must stay within the directory it is
+// joined to, so that plots cannot be written outside the output directory.
+func (o *Organizer) Filename(name string, variant string) (string, error) {
+	t, err := template.New("").Funcs(templateFuncs()).Parse(o.Template)
 	if err != nil {
 		return "", fmt.Errorf("parsing filename template: %w", err)
 	}
 
+	if variant != "" {
+		name += "-" + variant
+	}
 	data := map[string]any{
 		"Params":          o.Params,
 		"PlotDefFilename": name,
+		"Variant":         variant,
 	}
 
 	buf := new(bytes.Buffer)
 	if err := t.Execute(buf, data); err != nil {
 		return "", fmt.Errorf("execute filename template: %w", err)
 	}
+	if err := checkRelativeFilename(buf.String()); err != nil {
+		return "", err
+	}
+
+	if o.Variant != "" {
+		filename := buf.String()
+		ext := filepath.Ext(filename)
+		buf.Reset()
+		buf.WriteString(strings.TrimSuffix(filename, ext) + "." + o.Variant + ext)
+	}
+
+	if o.Compression == CompressionGzip {
+		buf.WriteString(".gz")
+	}
 
 	return buf.String(), nil
 }
 
-func (o *Organizer) Filepath(pd *PlotDef, basisTime time.Time) (string, error) {
-	var dated string
-	switch pd.Frequency {
+// checkRelativeFilename returns an error if the filename is empty or, once
+// cleaned, refers to a parent of the directory it is joined to. A leading
+// separator is allowed since joining the filename to the directory keeps it
+// within the directory.
+func checkRelativeFilename(filename string) error {
+	sep := string(filepath.Separator)
+	cleaned := filepath.Clean(strings.TrimLeft(filepath.FromSlash(filename), sep))
+	switch {
+	case cleaned == ".":
+		return fmt.Errorf("filename template produced an empty filename")
+	case cleaned == ".." || strings.HasPrefix(cleaned, ".."+sep):
+		return fmt.Errorf("filename template produced a path outside the output directory: %q", filename)
+	}
+	return nil
+}
+
+// datedLayout returns the time layout used for the dated directory of plots
+// with the given frequency.
+func datedLayout(f PlotFrequency) (string, bool) {
+	switch f {
 	case PlotFrequencyWeekly:
-		dated = pd.Frequency.Truncate(basisTime).Format("2006/01/02")
+		return "2006/01/02", true
 	case PlotFrequencyDaily:
-		dated = pd.Frequency.Truncate(basisTime).Format("2006/01/02")
+		return "2006/01/02", true
 	case PlotFrequencyHourly:
-		dated = pd.Frequency.Truncate(basisTime).Format("2006/01/02/15")
+		return "2006/01/02/15", true
+	case PlotFrequencyMonthly:
+		return "2006/01", true
+	case PlotFrequencyYearly:
+		return "2006", true
 	default:
+		d, ok := f.Interval()
+		if !ok {
+			return "", false
+		}
+		switch {
+		case d < time.Hour:
+			return "2006/01/02/15/04", true
+		case d < 24*time.Hour:
+			return "2006/01/02/15", true
+		default:
+			return "2006/01/02", true
+		}
+	}
+}
+
+// datedGlob converts a layout returned by datedLayout into a glob pattern
+// that matches the directories it formats.
+func datedGlob(layout string) string {
+	return strings.NewReplacer(
+		"2006", "20[0-9][0-9]",
+		"01", "[0-9][0-9]",
+		"02", "[0-9][0-9]",
+		"15", "[0-9][0-9]",
+		"04", "[0-9][0-9]",
+	).Replace(layout)
+}
+
+func (o *Organizer) Filepath(pd *PlotDef, basisTime time.Time) (string, error) {
+	var dated string
+	if layout, ok := datedLayout(pd.Frequency); ok {
+		dated = pd.Frequency.Truncate(basisTime, pd.location, pd.StartOfWeek()).Format(layout)
+	} else {
 		slog.Warn(fmt.Sprintf("unsupported plot frequency: %q", pd.Frequency))
 	}
 
-	filename, err := o.Filename(pd.Name)
+	filename, err := o.Filename(pd.Name, pd.variant)
 	if err != nil {
 		return "", err
 	}
@@ -69,25 +255,68 @@ func (o *Organizer) Filepath(pd *PlotDef, basisTime time.Time) (string, error) {
 	return filepath.Join(o.Base, dated, filename), nil
 }
 
-func (o *Organizer) Glob(pd *PlotDef, basisTime time.Time) ([]string, error) {
+// globEscaper escapes the characters that are special in patterns matched by
+// filepath.Match and path.Match.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// escapeGlob returns a pattern that matches s literally.
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
+
+func (o *Organizer) Glob(ctx context.Context, pd *PlotDef, basisTime time.Time) ([]string, error) {
 	var pattern string
-	switch pd.Frequency {
-	case PlotFrequencyWeekly:
-		pattern = "20[0-9][0-9]/[0-9][0-9]/[0-9][0-9]"
-	case PlotFrequencyDaily:
-		pattern = "20[0-9][0-9]/[0-9][0-9]/[0-9][0-9]"
-	case PlotFrequencyHourly:
-		pattern = "20[0-9][0-9]/[0-9][0-9]/[0-9][0-9]/[0-9][0-9]"
-	default:
+	if layout, ok := datedLayout(pd.Frequency); ok {
+		pattern = datedGlob(layout)
+	} else {
 		slog.Warn(fmt.Sprintf("unsupported plot frequency: %q", pd.Frequency))
 	}
-	pattern = filepath.Join(o.Base, pattern, pd.Name+".json")
 
-	return filepath.Glob(pattern)
+	// use the same filename as Filepath so that IsLatest compares like with like
+	filename, err := o.Filename(pd.Name, pd.variant)
+	if err != nil {
+		return nil, err
+	}
+	// the base and filename are matched literally, even if they contain
+	// characters that have a special meaning in patterns
+	pattern = filepath.Join(escapeGlob(o.Base), pattern, escapeGlob(filename))
+
+	return o.backend().List(ctx, pattern)
+}
+
+// PathTime parses the start of the period of a dated plot from its path.
+func (o *Organizer) PathTime(pd *PlotDef, path string) (time.Time, error) {
+	layout, ok := datedLayout(pd.Frequency)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unsupported plot frequency: %q", pd.Frequency)
+	}
+
+	rel, err := filepath.Rel(o.Base, path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("relative path: %w", err)
+	}
+
+	// the dated part of the path has one element per component of the layout
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	n := strings.Count(layout, "/") + 1
+	if len(parts) <= n {
+		return time.Time{}, fmt.Errorf("path is not dated: %q", path)
+	}
+
+	loc := pd.location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t, err := time.ParseInLocation(layout, strings.Join(parts[:n], "/"), loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse dated path: %w", err)
+	}
+	return t, nil
 }
 
 func (o *Organizer) LatestFilepath(pd *PlotDef) (string, error) {
-	filename, err := o.Filename(pd.Name)
+	filename, err := o.Filename(pd.Name, pd.variant)
 	if err != nil {
 		return "", err
 	}
@@ -95,13 +324,13 @@ func (o *Organizer) LatestFilepath(pd *PlotDef) (string, error) {
 	return filepath.Join(o.Base, "latest", filename), nil
 }
 
-func (o *Organizer) IsStaleOrMissing(pd *PlotDef, basisTime time.Time, expectedTime time.Time) (bool, error) {
+func (o *Organizer) IsStaleOrMissing(ctx context.Context, pd *PlotDef, basisTime time.Time, expectedTime time.Time) (bool, error) {
 	fname, err := o.Filepath(pd, basisTime)
 	if err != nil {
 		return false, fmt.Errorf("filepath: %w", err)
 	}
 
-	info, err := os.Lstat(fname)
+	info, err := o.backend().Stat(ctx, fname)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return true, nil
@@ -109,51 +338,617 @@ func (o *Organizer) IsStaleOrMissing(pd *PlotDef, basisTime time.Time, expectedT
 		return false, fmt.Errorf("stat file: %w", err)
 	}
 
+	if o.StalenessSource == StalenessSourceBasisTime {
+		if recorded, ok := o.recordedBasisTime(ctx, pd, basisTime, fname); ok {
+			return recorded.Before(expectedTime), nil
+		}
+		slog.Debug("no recorded basis time for plot, falling back to modification time", "filename", fname)
+	}
+
 	return info.ModTime().Before(expectedTime), nil
 }
 
-func (o *Organizer) IsLatest(pd *PlotDef, basisTime time.Time) (bool, error) {
-	existing, err := o.Glob(pd, basisTime)
+// recordedBasisTime returns the basis time recorded for an existing plot,
+// either in its .meta sidecar or in a basisTime field of its layout meta.
+func (o *Organizer) recordedBasisTime(ctx context.Context, pd *PlotDef, basisTime time.Time, fname string) (time.Time, bool) {
+	if meta, err := o.ReadMeta(ctx, pd, basisTime); err == nil && !meta.BasisTime.IsZero() {
+		return meta.BasisTime, true
+	}
+
+	data, err := o.backend().Read(ctx, fname)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if o.Compression == CompressionGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return time.Time{}, false
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	var plot struct {
+		Layout struct {
+			Meta struct {
+				BasisTime time.Time `json:"basisTime"`
+			} `json:"meta"`
+		} `json:"layout"`
+	}
+	if err := json.Unmarshal(data, &plot); err != nil || plot.Layout.Meta.BasisTime.IsZero() {
+		return time.Time{}, false
+	}
+	return plot.Layout.Meta.BasisTime, true
+}
+
+func (o *Organizer) IsLatest(ctx context.Context, pd *PlotDef, basisTime time.Time) (bool, error) {
+	existing, err := o.Glob(ctx, pd, basisTime)
 	if err != nil {
 		return false, fmt.Errorf("glob: %w", err)
 	}
 
-	// add the current filename to the existing ones, sort and see if current
-	// filename is the last entry
-	fname, _ := o.Filepath(pd, basisTime)
-	existing = append(existing, fname)
-	sort.Strings(existing)
-	if existing[len(existing)-1] == fname {
-		return true, nil
+	fname, err := o.Filepath(pd, basisTime)
+	if err != nil {
+		return false, fmt.Errorf("filepath: %w", err)
 	}
-	return false, nil
+
+	current, err := o.PathTime(pd, fname)
+	if err != nil {
+		return false, fmt.Errorf("path time: %w", err)
+	}
+
+	// compare the dates parsed from the paths rather than the paths themselves
+	// so the result does not depend on how the base directory sorts
+	for _, path := range existing {
+		ts, err := o.PathTime(pd, path)
+		if err != nil {
+			slog.Warn("skipping unrecognized plot path", "path", path, "error", err)
+			continue
+		}
+		if ts.After(current) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// A ManifestEntry records the details of a plot written by an Organizer.
+// Paths are relative to the Organizer's base directory.
+type ManifestEntry struct {
+	Name           string        `json:"name"`
+	Filepath       string        `json:"filepath"`
+	LatestFilepath string        `json:"latestFilepath,omitempty"` // empty if the plot was not the latest version
+	BasisTime      time.Time     `json:"basisTime"`
+	Frequency      PlotFrequency `json:"frequency"`
+	Hash           string        `json:"sha256"` // hash of the uncompressed plot
+	Compression    Compression   `json:"compression,omitempty"`
+	Variant        string        `json:"variant,omitempty"`     // empty for the primary version of the plot
+	PlotVariant    string        `json:"plotVariant,omitempty"` // name of the template variant of the plot definition, if any
+	Images         []string      `json:"images,omitempty"`      // paths of the static images rendered from the dated plot
+	HTMLFilepath   string        `json:"html,omitempty"`        // path of the HTML page of the dated plot
+	DataFilepath   string        `json:"data,omitempty"`        // path of the CSV export of the data of the dated plot
+	VegaLitePath   string        `json:"vegaLite,omitempty"`    // path of the Vega-Lite specification of the dated plot
+	Timing         *PlotTiming   `json:"timing,omitempty"`      // time taken to generate the plot, if recorded
+	Written        bool          `json:"-"`                     // false if the dated plot was unchanged and did not need writing, or in a dry run
+	WouldWrite     bool          `json:"-"`                     // true if the dated plot was changed and would have been written but for a dry run
 }
 
-func (o *Organizer) WritePlot(data []byte, pd *PlotDef, basisTime time.Time) error {
+// ProvenanceMeta records how a plot was generated. It is written as a sidecar
+// file with a .meta suffix alongside the dated plot.
+type ProvenanceMeta struct {
+	GeneratedAt time.Time   `json:"generatedAt"`
+	Version     string      `json:"version"` // version of ashby that generated the plot
+	BasisTime   time.Time   `json:"basisTime"`
+	Sources     []string    `json:"sources"` // names of the datasources queried
+	PlotDefPath string      `json:"plotdef"`
+	Timing      *PlotTiming `json:"timing,omitempty"` // time taken to generate the plot, if recorded
+}
+
+// MetaFilepath returns the path of the provenance sidecar for the dated plot.
+func (o *Organizer) MetaFilepath(pd *PlotDef, basisTime time.Time) (string, error) {
 	path, err := o.Filepath(pd, basisTime)
+	if err != nil {
+		return "", err
+	}
+	return path + ".meta", nil
+}
+
+// ReadMeta reads the provenance sidecar for the dated plot.
+func (o *Organizer) ReadMeta(ctx context.Context, pd *PlotDef, basisTime time.Time) (*ProvenanceMeta, error) {
+	path, err := o.MetaFilepath(pd, basisTime)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := o.backend().Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta ProvenanceMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("unmarshal meta: %w", err)
+	}
+	return &meta, nil
+}
+
+func (o *Organizer) writeMeta(ctx context.Context, pd *PlotDef, basisTime time.Time) error {
+	path, err := o.MetaFilepath(pd, basisTime)
 	if err != nil {
 		return err
 	}
 
-	if err := writeOutput(path, data); err != nil {
-		return fmt.Errorf("write plot: %w", err)
+	meta := ProvenanceMeta{
+		GeneratedAt: clockOrSystem(o.Clock).Now().UTC(),
+		Version:     appVersion(),
+		BasisTime:   basisTime,
+		Sources:     pd.SourceNames(),
+		PlotDefPath: pd.path,
+		Timing:      pd.timing,
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal meta: %w", err)
+	}
+	data = append(data, '\n')
+
+	return o.backend().Write(ctx, path, data)
+}
+
+// WritePlot writes the plot data to its dated path and, if it is the latest
+// version, to the latest directory. Files that already hold identical content
+// are not rewritten, but the dated plot has its modification time and meta
+// updated so that it is no longer stale. The other outputs of the plot, such as static images,
+// are written alongside it with the extension of their format. It returns a
+// manifest entry describing what was written.
+//
+// An output that cannot be written does not prevent the others from being
+// written. WritePlot then returns the manifest entry together with an error
+// joining the failures. Once the dated plot has been written the entry is
+// returned whatever fails afterwards, so that the plot is still listed in the
+// manifest.
+func (o *Organizer) WritePlot(ctx context.Context, data []byte, pd *PlotDef, basisTime time.Time, outputs PlotOutputs) (*ManifestEntry, error) {
+	path, err := o.Filepath(pd, basisTime)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	entry := &ManifestEntry{
+		Name:      pd.Name,
+		Filepath:  o.relPath(path),
+		BasisTime: basisTime,
+		Frequency: pd.Frequency,
+		Hash:      hex.EncodeToString(sum[:]),
+		Variant:   o.Variant,
+
+		PlotVariant: pd.variant,
+		Timing:      pd.timing,
+	}
+	if o.Compression == CompressionGzip {
+		entry.Compression = o.Compression
+	}
+
+	plot := data
+	data, err = o.encode(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode plot: %w", err)
+	}
+
+	unlock := o.lock(path)
+	if !o.outputUnchanged(ctx, path, data) {
+		if o.DryRun {
+			slog.Info("dry run: would write plot", "name", pd.Name, "filename", path, "size", len(data))
+			entry.WouldWrite = true
+		} else if err := o.backend().Write(ctx, path, data); err != nil {
+			unlock()
+			return nil, fmt.Errorf("write plot: %w", err)
+		} else {
+			entry.Written = true
+		}
+	}
+
+	// failures of the other outputs are collected so that one failing format,
+	// such as an image when Kaleido is missing, does not block the rest
+	var errs []error
+	if !entry.Written && !o.DryRun {
+		if err := o.backend().Touch(ctx, path); err != nil {
+			errs = append(errs, fmt.Errorf("touch plot: %w", err))
+		}
+	}
+	if o.WriteMeta && !o.DryRun {
+		if err := o.writeMeta(ctx, pd, basisTime); err != nil {
+			errs = append(errs, fmt.Errorf("write meta: %w", err))
+		}
+	}
+	var images []ImageFormat
+	for _, format := range outputs.Images {
+		imgPath := imagePath(path, format)
+		if err := o.writeImage(ctx, plot, pd, imgPath, format, entry.Written || entry.WouldWrite); err != nil {
+			errs = append(errs, fmt.Errorf("write %s: %w", format, err))
+			continue
+		}
+		images = append(images, format)
+		entry.Images = append(entry.Images, o.relPath(imgPath))
+	}
+
+	var page []byte
+	if outputs.HTML {
+		page, err = o.writeHTML(ctx, plot, pd, basisTime, siblingPath(path, "html"))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			entry.HTMLFilepath = o.relPath(siblingPath(path, "html"))
+		}
+	}
+
+	// variants restyle the same data so it is only exported with the primary plot
+	var csvData []byte
+	if outputs.Data && pd.export != nil && o.Variant == "" {
+		csvData, err = o.writeData(ctx, pd, siblingPath(path, "csv"))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			entry.DataFilepath = o.relPath(siblingPath(path, "csv"))
+		}
+	}
+
+	var vl []byte
+	if outputs.VegaLite && o.Variant == "" {
+		vl, err = o.writeVegaLite(ctx, pd, siblingPath(path, vegaLiteExt))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			entry.VegaLitePath = o.relPath(siblingPath(path, vegaLiteExt))
+		}
 	}
+	unlock()
+
+	latestPath, err := o.LatestFilepath(pd)
+	if err != nil {
+		return entry, errors.Join(append(errs, err)...)
+	}
+
+	// hold the latest lock while deciding whether to replace the latest plot
+	// so that concurrent writers for the same destination cannot interleave
+	defer o.lock(latestPath)()
 
-	isLatest, err := o.IsLatest(pd, basisTime)
+	isLatest, err := o.IsLatest(ctx, pd, basisTime)
 	if err != nil {
-		return fmt.Errorf("is latest: %w", err)
+		return entry, errors.Join(append(errs, fmt.Errorf("is latest: %w", err))...)
 	}
 	if !isLatest {
+		return entry, errors.Join(errs...)
+	}
+	entry.LatestFilepath = o.relPath(latestPath)
+
+	if o.DryRun {
+		slog.Info("dry run: would write latest plot", "name", pd.Name, "filename", latestPath, "size", len(data), "mode", o.LatestMode)
+		return entry, errors.Join(errs...)
+	}
+
+	if err := o.writeLatest(ctx, latestPath, path, data); err != nil {
+		entry.LatestFilepath = ""
+		return entry, errors.Join(append(errs, fmt.Errorf("write latest: %w", err))...)
+	}
+
+	for _, format := range images {
+		imgPath := imagePath(path, format)
+		img, err := o.backend().Read(ctx, imgPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read %s: %w", format, err))
+			continue
+		}
+		if err := o.writeLatest(ctx, imagePath(latestPath, format), imgPath, img); err != nil {
+			errs = append(errs, fmt.Errorf("write latest %s: %w", format, err))
+		}
+	}
+
+	if page != nil {
+		if err := o.writeLatest(ctx, siblingPath(latestPath, "html"), siblingPath(path, "html"), page); err != nil {
+			errs = append(errs, fmt.Errorf("write latest html: %w", err))
+		}
+	}
+
+	if csvData != nil {
+		if err := o.writeLatest(ctx, siblingPath(latestPath, "csv"), siblingPath(path, "csv"), csvData); err != nil {
+			errs = append(errs, fmt.Errorf("write latest data: %w", err))
+		}
+	}
+
+	if vl != nil {
+		if err := o.writeLatest(ctx, siblingPath(latestPath, vegaLiteExt), siblingPath(path, vegaLiteExt), vl); err != nil {
+			errs = append(errs, fmt.Errorf("write latest vega-lite: %w", err))
+		}
+	}
+	return entry, errors.Join(errs...)
+}
+
+// writeHTML renders the HTML page of the plot and writes it to path,
+// returning the page.
+func (o *Organizer) writeHTML(ctx context.Context, plot []byte, pd *PlotDef, basisTime time.Time, path string) ([]byte, error) {
+	opts := o.HTML
+	if opts == nil {
+		opts = &HTMLOptions{PlotlyURL: PlotlyCDN}
+	}
+	page, err := opts.Render(plot, pd, basisTime)
+	if err != nil {
+		return nil, fmt.Errorf("render html: %w", err)
+	}
+	if o.outputUnchanged(ctx, path, page) {
+		return page, nil
+	}
+	if o.DryRun {
+		slog.Info("dry run: would write html", "name", pd.Name, "filename", path, "size", len(page))
+	} else if err := o.backend().Write(ctx, path, page); err != nil {
+		return nil, fmt.Errorf("write html: %w", err)
+	}
+	return page, nil
+}
+
+// writeData writes the data exported by the plot as CSV to path, returning
+// the CSV.
+func (o *Organizer) writeData(ctx context.Context, pd *PlotDef, path string) ([]byte, error) {
+	csvData, err := pd.export.CSV()
+	if err != nil {
+		return nil, fmt.Errorf("export data: %w", err)
+	}
+	if o.outputUnchanged(ctx, path, csvData) {
+		return csvData, nil
+	}
+	if o.DryRun {
+		slog.Info("dry run: would write data", "name", pd.Name, "filename", path, "size", len(csvData))
+	} else if err := o.backend().Write(ctx, path, csvData); err != nil {
+		return nil, fmt.Errorf("write data: %w", err)
+	}
+	return csvData, nil
+}
+
+// vegaLiteExt is the extension of the Vega-Lite specification of a plot.
+const vegaLiteExt = "vl.json"
+
+// writeVegaLite writes the Vega-Lite specification of the plot to path,
+// returning the specification.
+func (o *Organizer) writeVegaLite(ctx context.Context, pd *PlotDef, path string) ([]byte, error) {
+	spec, err := vegaLiteSpec(pd)
+	if err != nil {
+		return nil, fmt.Errorf("vega-lite: %w", err)
+	}
+	if o.outputUnchanged(ctx, path, spec) {
+		return spec, nil
+	}
+	if o.DryRun {
+		slog.Info("dry run: would write vega-lite", "name", pd.Name, "filename", path, "size", len(spec))
+	} else if err := o.backend().Write(ctx, path, spec); err != nil {
+		return nil, fmt.Errorf("write vega-lite: %w", err)
+	}
+	return spec, nil
+}
+
+// writeLatest places data at the latest path, either as a copy or as a
+// symlink to the dated path that holds the same data.
+func (o *Organizer) writeLatest(ctx context.Context, latestPath string, path string, data []byte) error {
+	if o.LatestMode == LatestModeSymlink {
+		if sb, ok := o.backend().(SymlinkBackend); ok {
+			if symlinkUnchanged(ctx, sb, latestPath, path) {
+				return nil
+			}
+			err := sb.Symlink(ctx, latestPath, path)
+			if err == nil {
+				return nil
+			}
+			slog.Warn("failed to symlink latest plot, falling back to copy", "filename", latestPath, "error", err)
+		} else {
+			slog.Warn("output backend does not support symlinks, falling back to copy", "filename", latestPath)
+		}
+	}
+
+	if o.outputUnchanged(ctx, latestPath, data) {
 		return nil
 	}
 
-	path, err = o.LatestFilepath(pd)
+	return o.backend().Write(ctx, latestPath, data)
+}
+
+// writeImage renders the plot in the format and writes it to path. An
+// existing image is only rendered again if the plot has changed.
+func (o *Organizer) writeImage(ctx context.Context, plot []byte, pd *PlotDef, path string, format ImageFormat, changed bool) error {
+	if !changed {
+		if _, err := o.backend().Stat(ctx, path); err == nil {
+			return nil
+		}
+	}
+	// rendering is skipped as well as writing, since it starts Kaleido
+	if o.DryRun {
+		slog.Info("dry run: would render and write image", "name", pd.Name, "filename", path)
+		return nil
+	}
+
+	if o.Renderer == nil {
+		return fmt.Errorf("no image renderer configured")
+	}
+	if pd.imageWidth > 0 || pd.imageHeight > 0 {
+		ctx = WithImageSize(ctx, ImageSize{Width: pd.imageWidth, Height: pd.imageHeight})
+	}
+	img, err := o.Renderer.Render(ctx, plot, format)
 	if err != nil {
 		return err
 	}
 
-	if err := writeOutput(path, data); err != nil {
-		return fmt.Errorf("write latest: %w", err)
+	if o.outputUnchanged(ctx, path, img) {
+		return nil
+	}
+	return o.backend().Write(ctx, path, img)
+}
+
+// WriteManifest writes the entries as a manifest.json file in the base directory.
+func (o *Organizer) WriteManifest(ctx context.Context, entries []ManifestEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Filepath < entries[j].Filepath
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	data = append(data, '\n')
+	if err := o.backend().Write(ctx, filepath.Join(o.Base, "manifest.json"), data); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
 	}
 	return nil
 }
+
+func (o *Organizer) relPath(path string) string {
+	rel, err := filepath.Rel(o.Base, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Prune removes historical dated plots that fall outside the organizer's
+// retention policy. The latest copy of the plot, the newest dated plot and
+// the dated plot that the latest copy links to are never removed, so a
+// maximum age shorter than the period of the plot cannot leave the latest
+// link dangling. It returns the paths of the plots that were removed, or
+// would have been removed if the policy is a dry run.
+func (o *Organizer) Prune(ctx context.Context, pd *PlotDef, now time.Time) ([]string, error) {
+	if o.Retention.IsZero() {
+		return nil, nil
+	}
+
+	existing, err := o.Glob(ctx, pd, now)
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	latest, err := o.LatestFilepath(pd)
+	if err != nil {
+		return nil, err
+	}
+
+	type datedPath struct {
+		path string
+		ts   time.Time
+	}
+
+	candidates := make([]datedPath, 0, len(existing))
+	for _, path := range existing {
+		if path == latest {
+			continue
+		}
+		ts, err := o.PathTime(pd, path)
+		if err != nil {
+			slog.Warn("skipping unrecognized plot path", "path", path, "error", err)
+			continue
+		}
+		candidates = append(candidates, datedPath{path: path, ts: ts})
+	}
+
+	// newest first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ts.After(candidates[j].ts)
+	})
+	linked := o.latestTarget(ctx, latest)
+
+	var removed []string
+	for i, c := range candidates {
+		if i == 0 || c.path == linked {
+			continue
+		}
+		tooMany := o.Retention.MaxCount > 0 && i >= o.Retention.MaxCount
+		tooOld := o.Retention.MaxAge > 0 && now.Sub(c.ts) > o.Retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if !o.Retention.DryRun {
+			if err := o.backend().Remove(ctx, c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, fmt.Errorf("remove plot: %w", err)
+			}
+			if err := o.backend().Remove(ctx, c.path+".meta"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, fmt.Errorf("remove meta: %w", err)
+			}
+			for _, ext := range []string{"png", "svg", "html", "csv", vegaLiteExt} {
+				if err := o.backend().Remove(ctx, siblingPath(c.path, ext)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return removed, fmt.Errorf("remove %s: %w", ext, err)
+				}
+			}
+		}
+		removed = append(removed, c.path)
+	}
+
+	return removed, nil
+}
+
+// latestTarget returns the path of the dated plot that the latest copy at
+// latest is a symlink to, or an empty string if it is not a symlink.
+func (o *Organizer) latestTarget(ctx context.Context, latest string) string {
+	sb, ok := o.backend().(SymlinkBackend)
+	if !ok {
+		return ""
+	}
+	rel, err := sb.Readlink(ctx, latest)
+	if err != nil {
+		return ""
+	}
+	if filepath.IsAbs(rel) {
+		return filepath.Clean(rel)
+	}
+	return filepath.Join(filepath.Dir(latest), rel)
+}
+
+// symlinkUnchanged reports whether fname is already a relative symlink to target.
+func symlinkUnchanged(ctx context.Context, sb SymlinkBackend, fname string, target string) bool {
+	rel, err := filepath.Rel(filepath.Dir(fname), target)
+	if err != nil {
+		return false
+	}
+	existing, err := sb.Readlink(ctx, fname)
+	return err == nil && existing == rel
+}
+
+// encode prepares plot data for writing by terminating it with a newline and
+// applying the organizer's compression.
+func (o *Organizer) encode(data []byte) ([]byte, error) {
+	if o.Compression != CompressionGzip {
+		return append(data[:len(data):len(data)], '\n'), nil
+	}
+
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if _, err := zw.Write([]byte{'\n'}); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// outputUnchanged reports whether fname already holds data. A regular file is
+// required so that an existing symlink is always replaced.
+func (o *Organizer) outputUnchanged(ctx context.Context, fname string, data []byte) bool {
+	info, err := o.backend().Stat(ctx, fname)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	existing, err := o.backend().Read(ctx, fname)
+	if err != nil {
+		return false
+	}
+
+	return sha256.Sum256(existing) == sha256.Sum256(data)
+}
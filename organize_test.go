@@ -0,0 +1,408 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrganizerFilename(t *testing.T) {
+	testCases := []struct {
+		name        string
+		template    string
+		params      map[string]any
+		plot        string
+		variant     string
+		orgVariant  string
+		compression Compression
+		want        string
+	}{
+		{
+			name:     "plain",
+			template: "{{ .PlotDefFilename }}.json",
+			plot:     "demo",
+			want:     "demo.json",
+		},
+		{
+			name:     "params and functions",
+			template: `{{ .Params.site | slugify }}/{{ .PlotDefFilename | upper }}.json`,
+			params:   map[string]any{"site": "My Web Site"},
+			plot:     "demo",
+			want:     "my-web-site/DEMO.json",
+		},
+		{
+			name:     "template variant",
+			template: `{{ .PlotDefFilename }}.json`,
+			plot:     "peers",
+			variant:  "eu",
+			want:     "peers-eu.json",
+		},
+		{
+			name:     "template variant as field",
+			template: `{{ with .Variant }}{{ . }}/{{ end }}{{ .PlotDefFilename | replace "-" "_" }}.json`,
+			plot:     "peer-count",
+			variant:  "eu",
+			want:     "eu/peer_count_eu.json",
+		},
+		{
+			name:       "organizer variant",
+			template:   `{{ .Params.site }}-{{ .PlotDefFilename }}.json`,
+			params:     map[string]any{"site": "probelab"},
+			plot:       "demo",
+			orgVariant: "dark",
+			want:       "probelab-demo.dark.json",
+		},
+		{
+			name:        "organizer variant and compression",
+			template:    `{{ .PlotDefFilename }}.json`,
+			plot:        "demo",
+			variant:     "eu",
+			orgVariant:  "dark",
+			compression: CompressionGzip,
+			want:        "demo-eu.dark.json.gz",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Organizer{Template: tc.template, Params: tc.params, Variant: tc.orgVariant, Compression: tc.compression}
+			got, err := o.Filename(tc.plot, tc.variant)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrganizerFilenameOutsideBase(t *testing.T) {
+	for _, template := range []string{"", "../{{ .PlotDefFilename }}.json", `{{ "" }}`} {
+		o := &Organizer{Template: template}
+		if got, err := o.Filename("demo", ""); err == nil {
+			t.Errorf("template %q: got %q, want error", template, got)
+		}
+	}
+}
+
+func TestOrganizerFilepath(t *testing.T) {
+	basis := time.Date(2023, 5, 10, 14, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		name      string
+		template  string
+		params    map[string]any
+		frequency PlotFrequency
+		variant   string
+		want      string
+	}{
+		{
+			name:      "daily",
+			template:  "{{ .PlotDefFilename }}.json",
+			frequency: PlotFrequencyDaily,
+			want:      "out/2023/05/10/demo.json",
+		},
+		{
+			name:      "hourly with params",
+			template:  "{{ .Params.site | lower }}/{{ .PlotDefFilename }}.json",
+			params:    map[string]any{"site": "IPFS"},
+			frequency: PlotFrequencyHourly,
+			want:      "out/2023/05/10/14/ipfs/demo.json",
+		},
+		{
+			name:      "weekly with template variant",
+			template:  "{{ .PlotDefFilename }}{{ if .Variant }}.v{{ end }}.json",
+			frequency: PlotFrequencyWeekly,
+			variant:   "eu",
+			want:      "out/2023/05/08/demo-eu.v.json",
+		},
+		{
+			name:      "monthly",
+			template:  "{{ .PlotDefFilename | upper }}.json",
+			frequency: PlotFrequencyMonthly,
+			want:      "out/2023/05/DEMO.json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Organizer{Base: "out", Template: tc.template, Params: tc.params}
+			pd := &PlotDef{Name: "demo", Frequency: tc.frequency, variant: tc.variant}
+			got, err := o.Filepath(pd, basis)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != filepath.FromSlash(tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrganizerIsStaleOrMissing(t *testing.T) {
+	clock := FixedClock(time.Date(2023, 5, 10, 14, 30, 0, 0, time.UTC))
+	basis := clock.Now().Truncate(time.Hour)
+	expected := clock.Now().Add(-time.Hour)
+	before, after := expected.Add(-time.Minute), expected.Add(time.Minute)
+
+	testCases := []struct {
+		name        string
+		source      StalenessSource
+		compression Compression
+		mtime       time.Time // zero if the plot is missing
+		meta        time.Time // basis time recorded in the .meta sidecar, zero if none is written
+		layoutMeta  time.Time // basis time recorded in the plot's layout meta, zero if none
+		want        bool
+	}{
+		{name: "missing", source: StalenessSourceMtime, want: true},
+		{name: "mtime before expected", source: StalenessSourceMtime, mtime: before, want: true},
+		{name: "mtime after expected", source: StalenessSourceMtime, mtime: after, want: false},
+		{name: "mtime at expected", source: StalenessSourceMtime, mtime: expected, want: false},
+		{name: "mtime ignores recorded basis time", source: StalenessSourceMtime, mtime: before, meta: after, want: true},
+		{name: "basistime missing", source: StalenessSourceBasisTime, want: true},
+		{name: "basistime from meta before expected", source: StalenessSourceBasisTime, mtime: after, meta: before, want: true},
+		{name: "basistime from meta after expected", source: StalenessSourceBasisTime, mtime: before, meta: after, want: false},
+		{name: "basistime from layout meta", source: StalenessSourceBasisTime, mtime: after, layoutMeta: before, want: true},
+		{name: "basistime from gzipped layout meta", source: StalenessSourceBasisTime, compression: CompressionGzip, mtime: before, layoutMeta: after, want: false},
+		{name: "basistime prefers meta", source: StalenessSourceBasisTime, mtime: before, meta: after, layoutMeta: before, want: false},
+		{name: "basistime falls back to mtime", source: StalenessSourceBasisTime, mtime: before, want: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			o := &Organizer{
+				Base:            t.TempDir(),
+				Template:        "{{ .PlotDefFilename }}.json",
+				Compression:     tc.compression,
+				Clock:           clock,
+				StalenessSource: tc.source,
+			}
+			pd := &PlotDef{Name: "peers", Frequency: PlotFrequencyHourly}
+
+			path, err := o.Filepath(pd, basis)
+			if err != nil {
+				t.Fatalf("filepath: %v", err)
+			}
+			wantPath := filepath.Join(o.Base, "2023", "05", "10", "14", "peers.json")
+			if tc.compression == CompressionGzip {
+				wantPath += ".gz"
+			}
+			if path != wantPath {
+				t.Fatalf("got path %q, want %q", path, wantPath)
+			}
+
+			if !tc.mtime.IsZero() {
+				data := []byte(`{}`)
+				if !tc.layoutMeta.IsZero() {
+					data = []byte(fmt.Sprintf(`{"layout": {"meta": {"basisTime": %q}}}`, tc.layoutMeta.Format(time.RFC3339)))
+				}
+				if _, err := o.WritePlot(ctx, data, pd, basis, PlotOutputs{}); err != nil {
+					t.Fatalf("write plot: %v", err)
+				}
+				if err := os.Chtimes(path, tc.mtime, tc.mtime); err != nil {
+					t.Fatalf("set mtime: %v", err)
+				}
+			}
+			if !tc.meta.IsZero() {
+				metaPath, err := o.MetaFilepath(pd, basis)
+				if err != nil {
+					t.Fatalf("meta filepath: %v", err)
+				}
+				meta, err := json.Marshal(ProvenanceMeta{BasisTime: tc.meta})
+				if err != nil {
+					t.Fatalf("marshal meta: %v", err)
+				}
+				if err := o.backend().Write(ctx, metaPath, meta); err != nil {
+					t.Fatalf("write meta: %v", err)
+				}
+			}
+
+			stale, err := o.IsStaleOrMissing(ctx, pd, basis, expected)
+			if err != nil {
+				t.Fatalf("is stale or missing: %v", err)
+			}
+			if stale != tc.want {
+				t.Errorf("got stale %v, want %v", stale, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrganizerIsLatestWithTemplate(t *testing.T) {
+	o := &Organizer{
+		Base:     t.TempDir(),
+		Template: `{{ .Params.site | slugify }}-{{ .PlotDefFilename }}.json`,
+		Params:   map[string]any{"site": "Web Site"},
+	}
+	pd := &PlotDef{Name: "demo", Frequency: PlotFrequencyDaily}
+	first := time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 1)
+
+	for _, basis := range []time.Time{first, second} {
+		if _, err := o.WritePlot(context.Background(), []byte(`{}`), pd, basis, PlotOutputs{}); err != nil {
+			t.Fatalf("write plot for %s: %v", basis, err)
+		}
+	}
+
+	existing, err := o.Glob(context.Background(), pd, second)
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(existing) != 2 {
+		t.Errorf("got %d dated plots, want 2: %v", len(existing), existing)
+	}
+
+	for basis, want := range map[time.Time]bool{first: false, second: true} {
+		latest, err := o.IsLatest(context.Background(), pd, basis)
+		if err != nil {
+			t.Fatalf("is latest: %v", err)
+		}
+		if latest != want {
+			t.Errorf("is latest for %s: got %v, want %v", basis.Format(time.DateOnly), latest, want)
+		}
+	}
+
+	latest, err := o.LatestFilepath(pd)
+	if err != nil {
+		t.Fatalf("latest filepath: %v", err)
+	}
+	if want := filepath.Join(o.Base, "latest", "web-site-demo.json"); latest != want {
+		t.Errorf("got latest path %q, want %q", latest, want)
+	}
+	if _, err := o.backend().Stat(context.Background(), latest); err != nil {
+		t.Errorf("latest copy was not written: %v", err)
+	}
+}
+
+func TestOrganizerGlobMetacharacters(t *testing.T) {
+	o := &Organizer{
+		Base:     filepath.Join(t.TempDir(), "out[1]"),
+		Template: "{{ .PlotDefFilename }}.json",
+	}
+	pd := &PlotDef{Name: "peers[eu]*?", Frequency: PlotFrequencyDaily}
+	// without escaping, the pattern for pd would also match the decoy
+	decoy := &PlotDef{Name: "peerse-all", Frequency: PlotFrequencyDaily}
+
+	basis := time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for day := 0; day < 3; day++ {
+		b := basis.AddDate(0, 0, day)
+		for _, def := range []*PlotDef{pd, decoy} {
+			if _, err := o.WritePlot(context.Background(), []byte(`{}`), def, b, PlotOutputs{}); err != nil {
+				t.Fatalf("write plot %q for %s: %v", def.Name, b, err)
+			}
+		}
+		path, err := o.Filepath(pd, b)
+		if err != nil {
+			t.Fatalf("filepath: %v", err)
+		}
+		want = append(want, path)
+	}
+
+	got, err := o.Glob(context.Background(), pd, basis)
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got dated plots %q, want %q", got, want)
+	}
+}
+
+func TestOrganizerUnchangedPlotNotStale(t *testing.T) {
+	o := &Organizer{
+		Base:     t.TempDir(),
+		Template: "{{ .PlotDefFilename }}.json",
+	}
+	pd := &PlotDef{Name: "peers", Frequency: PlotFrequencyDaily}
+	basis := time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)
+	if _, err := o.WritePlot(context.Background(), []byte(`{}`), pd, basis, PlotOutputs{}); err != nil {
+		t.Fatalf("write plot: %v", err)
+	}
+	path, err := o.Filepath(pd, basis)
+	if err != nil {
+		t.Fatalf("filepath: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("set mtime: %v", err)
+	}
+
+	// the plot definition was edited after the plot was written, but the
+	// plot it generates is the same
+	edited := time.Now().Add(-time.Minute)
+	if stale, err := o.IsStaleOrMissing(context.Background(), pd, basis, edited); err != nil || !stale {
+		t.Fatalf("got stale %v and error %v before regenerating, want a stale plot", stale, err)
+	}
+	entry, err := o.WritePlot(context.Background(), []byte(`{}`), pd, basis, PlotOutputs{})
+	if err != nil {
+		t.Fatalf("write unchanged plot: %v", err)
+	}
+	if entry.Written {
+		t.Errorf("got an unchanged plot written")
+	}
+	if stale, err := o.IsStaleOrMissing(context.Background(), pd, basis, edited); err != nil || stale {
+		t.Errorf("got stale %v and error %v after regenerating an unchanged plot, want it up to date", stale, err)
+	}
+}
+
+func TestOrganizerWritePlotLatestFails(t *testing.T) {
+	o := &Organizer{
+		Base:     t.TempDir(),
+		Template: "{{ .PlotDefFilename }}.json",
+	}
+	// a file in place of the latest directory makes writing the latest plot fail
+	if err := os.WriteFile(filepath.Join(o.Base, "latest"), nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	pd := &PlotDef{Name: "peers", Frequency: PlotFrequencyDaily}
+	entry, err := o.WritePlot(context.Background(), []byte(`{}`), pd, time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC), PlotOutputs{})
+	if err == nil {
+		t.Fatalf("wrote latest plot in place of a file, want an error")
+	}
+	if entry == nil || !entry.Written || entry.Filepath == "" {
+		t.Fatalf("got entry %+v, want the entry of the dated plot that was written", entry)
+	}
+	if entry.LatestFilepath != "" {
+		t.Errorf("got latest filepath %q, want none since it was not written", entry.LatestFilepath)
+	}
+}
+
+// failingRenderer is an ImageRenderer that fails the test if it is used.
+type failingRenderer struct{ t *testing.T }
+
+func (r failingRenderer) Render(context.Context, []byte, ImageFormat) ([]byte, error) {
+	r.t.Errorf("rendered an image in a dry run")
+	return nil, nil
+}
+
+func TestOrganizerWritePlotDryRun(t *testing.T) {
+	o := &Organizer{
+		Base:     t.TempDir(),
+		Template: "{{ .PlotDefFilename }}.json",
+		DryRun:   true,
+		Renderer: failingRenderer{t},
+	}
+	pd := &PlotDef{Name: "peers", Frequency: PlotFrequencyDaily}
+	entry, err := o.WritePlot(context.Background(), []byte(`{}`), pd, time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC), PlotOutputs{Images: []ImageFormat{ImageFormatPNG}})
+	if err != nil {
+		t.Fatalf("write plot: %v", err)
+	}
+	if entry.Written || !entry.WouldWrite {
+		t.Errorf("got written %v and would write %v, want only would write in a dry run", entry.Written, entry.WouldWrite)
+	}
+	files, err := os.ReadDir(o.Base)
+	if err != nil {
+		t.Fatalf("read output directory: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("got %d files written in a dry run, want none", len(files))
+	}
+}
@@ -0,0 +1,81 @@
+package ashby
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OutputFormat is a format that a plot may be written in by batch mode.
+type OutputFormat string
+
+const (
+	OutputFormatJSON OutputFormat = "json" // the plotly JSON of the plot, which is always written
+	OutputFormatPNG  OutputFormat = "png"  // a static PNG image rendered with Kaleido
+	OutputFormatSVG  OutputFormat = "svg"  // a static SVG image rendered with Kaleido
+	OutputFormatHTML OutputFormat = "html" // a self-contained HTML page that draws the plot
+	OutputFormatCSV  OutputFormat = "csv"  // the plotted data as CSV
+
+	OutputFormatVegaLite OutputFormat = "vegalite" // a Vega-Lite specification of the series of the plot
+)
+
+func (f OutputFormat) String() string { return string(f) }
+
+// PlotOutputs are the formats written alongside the JSON of a plot. The JSON
+// is always written since it is used to decide whether a plot is stale.
+type PlotOutputs struct {
+	Images []ImageFormat
+	HTML   bool
+	Data   bool // write the plotted data as CSV
+
+	VegaLite bool // write a Vega-Lite specification of the plot
+}
+
+// validateOutputs checks the output formats of the plot definition. Listing
+// csv enables the export of the plotted data.
+func (pd *PlotDef) validateOutputs() error {
+	seen := make(map[OutputFormat]bool, len(pd.Outputs))
+	for _, f := range pd.Outputs {
+		format := OutputFormat(strings.ToLower(string(f)))
+		if seen[format] {
+			return fmt.Errorf("duplicate output format: %q", f)
+		}
+		seen[format] = true
+
+		switch format {
+		case OutputFormatJSON, OutputFormatPNG, OutputFormatSVG, OutputFormatHTML, OutputFormatVegaLite:
+		case OutputFormatCSV:
+			pd.ExportData = true
+		default:
+			return fmt.Errorf("unsupported output format: %q", f)
+		}
+	}
+	return nil
+}
+
+// resolveOutputs returns the formats to write for the plot. A plot definition
+// that lists its outputs replaces the formats configured for the whole run,
+// otherwise they are used as given. The data is written whenever the plot
+// definition exports it.
+func (pd *PlotDef) resolveOutputs(run PlotOutputs) PlotOutputs {
+	outputs := PlotOutputs{Data: pd.ExportData}
+	if len(pd.Outputs) == 0 {
+		outputs.Images = run.Images
+		outputs.HTML = run.HTML
+		outputs.VegaLite = run.VegaLite
+		return outputs
+	}
+
+	for _, f := range pd.Outputs {
+		switch OutputFormat(strings.ToLower(string(f))) {
+		case OutputFormatPNG:
+			outputs.Images = append(outputs.Images, ImageFormatPNG)
+		case OutputFormatSVG:
+			outputs.Images = append(outputs.Images, ImageFormatSVG)
+		case OutputFormatHTML:
+			outputs.HTML = true
+		case OutputFormatVegaLite:
+			outputs.VegaLite = true
+		}
+	}
+	return outputs
+}
@@ -0,0 +1,303 @@
+package ashby
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// The source of the plot definitions of a profile may be a local directory
+// or file pattern, or a remote source that is fetched once per run:
+//
+//   - an http or https url of a single plot definition, or of a .zip, .tar.gz
+//     or .tgz archive of plot definitions
+//   - a git repository, written as 'git::' followed by the url of the
+//     repository and an optional '?ref=' naming the branch or tag to use
+//
+// Remote sources may name a directory within the archive or repository that
+// holds the plot definitions by appending it after a double slash, as in
+// 'git::https://example.com/dashboards.git//plots?ref=v1.2.0'.
+//
+// A profile built by a program calling Batch may also be given a filesystem,
+// such as an embed.FS, holding its plot definitions, in which case its source
+// names the directory within it.
+
+// maxPlotDefArchiveSize limits the size of a fetched archive of plot
+// definitions, and the total size of the files extracted from it, so that a
+// highly compressed archive cannot fill the disk.
+const maxPlotDefArchiveSize = 256 << 20
+
+// LoadProfiles reads the processing profiles of a batch run from
+// profiles.yaml in conffs. The local sources of the profiles are taken to be
+// relative to the configuration directory dir.
+func LoadProfiles(conffs fs.FS, dir string) ([]*ProcessingProfile, error) {
+	content, err := fs.ReadFile(conffs, "profiles.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var profiles []*ProcessingProfile
+	if err := yaml.Unmarshal(content, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal processing profiles: %w", err)
+	}
+	for _, profile := range profiles {
+		if !isRemotePlotSource(profile.Source) {
+			profile.Source = filepath.Join(dir, profile.Source)
+		}
+	}
+	return profiles, nil
+}
+
+// isRemotePlotSource reports whether the source of a profile is fetched.
+func isRemotePlotSource(source string) bool {
+	return strings.HasPrefix(source, "git::") || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// remotePlotSource is a parsed remote source of plot definitions.
+type remotePlotSource struct {
+	git    bool
+	url    string // url of the file, archive or repository
+	subdir string // optional directory within the archive or repository
+	ref    string // optional branch or tag of a git repository
+}
+
+func parseRemotePlotSource(source string) remotePlotSource {
+	var r remotePlotSource
+	s := source
+	if strings.HasPrefix(s, "git::") {
+		r.git = true
+		s = strings.TrimPrefix(s, "git::")
+	}
+
+	s, query, hasQuery := strings.Cut(s, "?")
+	scheme, rest, hasScheme := strings.Cut(s, "://")
+	if hasScheme {
+		if i := strings.Index(rest, "//"); i >= 0 {
+			r.subdir = strings.Trim(rest[i+2:], "/")
+			rest = rest[:i]
+		}
+		s = scheme + "://" + rest
+	}
+
+	if r.git {
+		// the ref is an option of the source rather than part of the repository url
+		var kept []string
+		for _, kv := range strings.Split(query, "&") {
+			if ref, ok := strings.CutPrefix(kv, "ref="); ok {
+				r.ref = ref
+			} else if kv != "" {
+				kept = append(kept, kv)
+			}
+		}
+		query, hasQuery = strings.Join(kept, "&"), len(kept) > 0
+	}
+	if hasQuery {
+		s += "?" + query
+	}
+	r.url = s
+	return r
+}
+
+// open returns the filesystem holding the plot definitions of the profile,
+// the name of the directory it is rooted at and the pattern matching the plot
+// definition files within it. Remote sources are fetched on first use and
+// the result is reused.
+func (p *ProcessingProfile) open(ctx context.Context) (fs.FS, string, string, error) {
+	if p.fsys != nil {
+		return p.fsys, p.dir, p.pattern, nil
+	}
+
+	switch {
+	case p.FS != nil:
+		dir := path.Clean(p.Source)
+		sub, err := fs.Sub(p.FS, dir)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("plot definition directory %q: %w", p.Source, err)
+		}
+		p.fsys, p.dir, p.pattern = sub, p.Source, "*.yaml"
+	case isRemotePlotSource(p.Source):
+		fsys, cleanup, err := fetchPlotDefs(ctx, parseRemotePlotSource(p.Source))
+		if err != nil {
+			return nil, "", "", fmt.Errorf("fetch plot definitions from %q: %w", p.Source, err)
+		}
+		p.fsys, p.dir, p.pattern, p.cleanup = fsys, p.Source, "*.yaml", cleanup
+	case p.SourceIsDir():
+		slog.Debug("using plot definitions in " + p.Source)
+		p.fsys, p.dir, p.pattern = os.DirFS(p.Source), p.Source, "*.yaml"
+	default:
+		p.fsys, p.dir, p.pattern = os.DirFS(filepath.Dir(p.Source)), filepath.Dir(p.Source), filepath.Base(p.Source)
+	}
+	return p.fsys, p.dir, p.pattern, nil
+}
+
+// Close removes any files fetched for a remote source.
+func (p *ProcessingProfile) Close() error {
+	if p.cleanup == nil {
+		return nil
+	}
+	err := p.cleanup()
+	p.cleanup = nil
+	return err
+}
+
+// fetchPlotDefs fetches a remote source of plot definitions, returning the
+// filesystem holding them and a function that removes any fetched files.
+func fetchPlotDefs(ctx context.Context, r remotePlotSource) (fs.FS, func() error, error) {
+	tmp, err := os.MkdirTemp("", "ashby-plotdefs-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create temporary directory: %w", err)
+	}
+	cleanup := func() error { return os.RemoveAll(tmp) }
+
+	if err := fetchInto(ctx, r, tmp); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	root := tmp
+	if r.subdir != "" {
+		if !fs.ValidPath(r.subdir) {
+			cleanup()
+			return nil, nil, fmt.Errorf("invalid directory: %q", r.subdir)
+		}
+		root = filepath.Join(tmp, filepath.FromSlash(r.subdir))
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		cleanup()
+		return nil, nil, fmt.Errorf("directory %q not found", r.subdir)
+	}
+	return os.DirFS(root), cleanup, nil
+}
+
+// fetchInto places the files of a remote source in dir.
+func fetchInto(ctx context.Context, r remotePlotSource, dir string) error {
+	if r.git {
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if r.ref != "" {
+			args = append(args, "--branch", r.ref)
+		}
+		args = append(args, "--", r.url, dir)
+		cmd := exec.CommandContext(ctx, "git", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git clone: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get: unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlotDefArchiveSize+1))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if len(data) > maxPlotDefArchiveSize {
+		return fmt.Errorf("response is larger than %d bytes", maxPlotDefArchiveSize)
+	}
+
+	name := path.Base(strings.SplitN(r.url, "?", 2)[0])
+	remaining := int64(maxPlotDefArchiveSize)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("read zip: %w", err)
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("read zip: %w", err)
+			}
+			err = extractFile(dir, f.Name, rc, &remaining)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("read tar: %w", err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read tar: %w", err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := extractFile(dir, hdr.Name, tr, &remaining); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := extractFile(dir, name, bytes.NewReader(data), &remaining); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the contents of a file read from an archive to the
+// named path within dir, refusing names that would be outside it. The size of
+// the file is deducted from the remaining bytes that may be extracted from
+// the archive, and it fails if there are not enough of them.
+func extractFile(dir string, name string, r io.Reader, remaining *int64) error {
+	name = strings.TrimPrefix(name, "./")
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("invalid file name in archive: %q", name)
+	}
+	fpath := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(r, *remaining+1))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("write file: %w", err)
+	}
+	if n > *remaining {
+		f.Close()
+		return fmt.Errorf("archive extracts to more than %d bytes", maxPlotDefArchiveSize)
+	}
+	*remaining -= n
+	return f.Close()
+}
@@ -0,0 +1,20 @@
+package ashby
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractFileLimit(t *testing.T) {
+	dir := t.TempDir()
+	remaining := int64(10)
+	if err := extractFile(dir, "a.yaml", strings.NewReader("name: a\n"), &remaining); err != nil {
+		t.Fatalf("extract file within the limit: %v", err)
+	}
+	if remaining != 2 {
+		t.Errorf("got %d bytes remaining, want 2", remaining)
+	}
+	if err := extractFile(dir, "b.yaml", strings.NewReader("name: b\n"), &remaining); err == nil {
+		t.Errorf("extracted file beyond the limit, want an error")
+	}
+}
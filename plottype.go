@@ -0,0 +1,369 @@
+package ashby
+
+import (
+	"sort"
+	"sync"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// PlotBuild is what a PlotBuilder is given alongside the data of a series.
+type PlotBuild struct {
+	Plot    *PlotDef    // the plot definition the series belongs to, whose layout the builder may adjust
+	Config  *PlotConfig // the configuration of the run, used to look up named colors
+	Visible any         // whether the series should be shown initially: true, false or "legendonly"
+}
+
+// A PlotBuilder turns the data read for a series into the traces that plot
+// it. The labels, values and other fields of the series have already had any
+// gaps filled and been downsampled. Options for the type of series may be
+// read from the Options of its definition. Overlays such as trendlines are
+// added after the traces returned by the builder.
+type PlotBuilder func(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error)
+
+var (
+	plotTypesMu sync.RWMutex
+	plotTypes   = make(map[SeriesType]PlotBuilder)
+)
+
+func init() {
+	RegisterPlotType(SeriesTypeBar, barTraces)
+	RegisterPlotType(SeriesTypeHBar, hbarTraces)
+	RegisterPlotType(SeriesTypeLine, lineTraces)
+	RegisterPlotType(SeriesTypeScatter, scatterTraces)
+	RegisterPlotType(SeriesTypeBox, boxTraces)
+	RegisterPlotType(SeriesTypeHBox, hboxTraces)
+	RegisterPlotType(SeriesTypeViolin, violinTraces)
+	RegisterPlotType(SeriesTypeHViolin, violinTraces)
+	RegisterPlotType(SeriesTypePie, pieTraces)
+	RegisterPlotType(SeriesTypeCandlestick, candlestickTraces)
+	RegisterPlotType(SeriesTypeArea, areaTraces)
+	RegisterPlotType(SeriesTypeHistogram, histogramTraces)
+}
+
+// RegisterPlotType makes a type of series available to plot definitions
+// under the name, which is used as the type of the series. It is intended to
+// be called from an init function, either of the file implementing a
+// built-in builder or of a program importing the package, and panics if the
+// name is already registered or the builder is nil.
+func RegisterPlotType(name SeriesType, builder PlotBuilder) {
+	plotTypesMu.Lock()
+	defer plotTypesMu.Unlock()
+	if builder == nil {
+		panic("plot builder is nil for type " + string(name))
+	}
+	if _, dup := plotTypes[name]; dup {
+		panic("plot type registered twice: " + string(name))
+	}
+	plotTypes[name] = builder
+}
+
+// PlotTypes returns the sorted names of the registered types of series.
+func PlotTypes() []SeriesType {
+	plotTypesMu.RLock()
+	defer plotTypesMu.RUnlock()
+	names := make([]SeriesType, 0, len(plotTypes))
+	for name := range plotTypes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// plotBuilder returns the builder registered for a type of series.
+func plotBuilder(name SeriesType) (PlotBuilder, bool) {
+	plotTypesMu.RLock()
+	defer plotTypesMu.RUnlock()
+	b, ok := plotTypes[name]
+	return b, ok
+}
+
+func barTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Bar{
+		Type:          grob.TraceTypeBar,
+		Name:          ls.Name,
+		Orientation:   grob.BarOrientationV,
+		X:             ls.Labels,
+		Y:             ls.Values,
+		Hovertemplate: ls.hoverTemplate(),
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.BarMarker{
+			Color: c,
+		}
+	}
+
+	trace.ErrorX, trace.ErrorY = barErrorBars(ls)
+	return []grob.Trace{trace}, nil
+}
+
+func hbarTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Bar{
+		Type:          grob.TraceTypeBar,
+		Name:          ls.Name,
+		Orientation:   grob.BarOrientationH,
+		X:             ls.Values,
+		Y:             ls.Labels,
+		Hovertemplate: ls.hoverTemplate(),
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+	}
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.BarMarker{
+			Color: c,
+		}
+	}
+
+	trace.ErrorX, trace.ErrorY = barErrorBars(ls)
+	return []grob.Trace{trace}, nil
+}
+
+func lineTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Scatter{
+		Type:          grob.TraceTypeScatter,
+		Name:          ls.Name,
+		X:             ls.Labels,
+		Y:             ls.Values,
+		Mode:          "lines",
+		Marker:        &grob.ScatterMarker{},
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+		Hovertemplate: ls.hoverTemplate(),
+	}
+
+	trace.Fill = scatterFill(ls.SeriesDef.Fill)
+
+	if ls.SeriesDef.Marker != MarkerTypeNone {
+		trace.Mode = "lines+markers"
+		trace.Marker.Symbol = ls.SeriesDef.Marker
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker.Color = c
+	}
+	trace.ErrorX, trace.ErrorY = scatterErrorBars(ls)
+	return []grob.Trace{trace}, nil
+}
+
+func scatterTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Scatter{
+		Type: grob.TraceTypeScatter,
+		Name: ls.Name,
+		X:    ls.Labels,
+		Y:    ls.Values,
+		Mode: "markers",
+		Marker: &grob.ScatterMarker{
+			Symbol: MarkerTypeCircle,
+		},
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+		Hovertemplate: ls.hoverTemplate(),
+	}
+
+	trace.Fill = scatterFill(ls.SeriesDef.Fill)
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker.Color = c
+	}
+
+	trace.ErrorX, trace.ErrorY = scatterErrorBars(ls)
+	return []grob.Trace{trace}, nil
+}
+
+// scatterFill returns the plotly fill of a line or scatter series.
+func scatterFill(fill FillType) grob.ScatterFill {
+	switch fill {
+	case FillTypeToZero:
+		return grob.ScatterFillTozeroy
+	case FillTypeToNext:
+		return grob.ScatterFillTonexty
+	default:
+		return ""
+	}
+}
+
+// areaTraces plots a series as a filled line. The areas of series in the
+// same stack are drawn on top of each other in the order of the series.
+// Missing values of a stacked series, including those of gaps that are
+// broken, are taken to be zero since a break would otherwise drop the areas
+// stacked above it, and labels missing from some series of a stack are
+// likewise given a zero value. Unless the series has a color the fill takes
+// the color plotly gives the line from the colorway of the theme.
+func areaTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Scatter{
+		Type:          grob.TraceTypeScatter,
+		Name:          ls.Name,
+		X:             ls.Labels,
+		Y:             ls.Values,
+		Mode:          "lines",
+		Visible:       b.Visible,
+		Yaxis:         ls.SeriesDef.Yaxis,
+		Hovertemplate: ls.hoverTemplate(),
+		Fill:          grob.ScatterFillTozeroy,
+	}
+	if ls.SeriesDef.Fill != FillTypeNone {
+		trace.Fill = scatterFill(ls.SeriesDef.Fill)
+	}
+
+	if ls.SeriesDef.Stack != "" {
+		values := make([]any, len(ls.Values))
+		for i, v := range ls.Values {
+			if v == nil {
+				v = 0
+			}
+			values[i] = v
+		}
+		trace.Y = values
+		trace.Stackgroup = ls.SeriesDef.Stack
+		trace.Stackgaps = grob.ScatterStackgapsInferZero
+		trace.Fill = grob.ScatterFillTonexty
+	}
+
+	if ls.SeriesDef.Marker != MarkerTypeNone {
+		trace.Mode = "lines+markers"
+		trace.Marker = &grob.ScatterMarker{Symbol: ls.SeriesDef.Marker}
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Line = &grob.ScatterLine{Color: c}
+		if trace.Marker != nil {
+			trace.Marker.Color = c
+		}
+	}
+	trace.ErrorX, trace.ErrorY = scatterErrorBars(ls)
+	return []grob.Trace{trace}, nil
+}
+
+func boxTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	// labels, if any, group the values into one box per label
+	trace := &grob.Box{
+		Type:           grob.TraceTypeBox,
+		Name:           ls.Name,
+		Y:              ls.Values,
+		Visible:        b.Visible,
+		Yaxis:          ls.SeriesDef.Yaxis,
+		Boxpoints:      pointsMode(ls.SeriesDef.Points),
+		Quartilemethod: grob.BoxQuartilemethod(ls.SeriesDef.QuartileMethod),
+	}
+	if len(ls.Labels) > 0 {
+		trace.X = ls.Labels
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.BoxMarker{
+			Color: c,
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
+
+func hboxTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Box{
+		Type:           grob.TraceTypeBox,
+		Name:           ls.Name,
+		X:              ls.Values,
+		Orientation:    grob.BoxOrientationH,
+		Visible:        b.Visible,
+		Yaxis:          ls.SeriesDef.Yaxis,
+		Boxpoints:      pointsMode(ls.SeriesDef.Points),
+		Quartilemethod: grob.BoxQuartilemethod(ls.SeriesDef.QuartileMethod),
+	}
+	if len(ls.Labels) > 0 {
+		trace.Y = ls.Labels
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.BoxMarker{
+			Color: c,
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
+
+func violinTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Violin{
+		Type:    grob.TraceTypeViolin,
+		Name:    ls.Name,
+		Y:       ls.Values,
+		Visible: b.Visible,
+		Yaxis:   ls.SeriesDef.Yaxis,
+		Points:  pointsMode(ls.SeriesDef.Points),
+	}
+	if len(ls.Labels) > 0 {
+		trace.X = ls.Labels
+	}
+	if ls.SeriesDef.Type == SeriesTypeHViolin {
+		trace.X, trace.Y = trace.Y, trace.X
+		trace.Orientation = grob.ViolinOrientationH
+	}
+	if ls.SeriesDef.ShowBox {
+		trace.Box = &grob.ViolinBox{Visible: grob.True}
+	}
+	if ls.SeriesDef.MeanLine {
+		trace.Meanline = &grob.ViolinMeanline{Visible: grob.True}
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		trace.Marker = &grob.ViolinMarker{
+			Color: c,
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
+
+func pieTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &pieTrace{
+		Pie: &grob.Pie{
+			Type:          grob.TraceTypePie,
+			Name:          ls.Name,
+			Labels:        ls.Labels,
+			Values:        ls.Values,
+			Hole:          ls.SeriesDef.Hole,
+			Textinfo:      grob.PieTextinfo(ls.SeriesDef.TextInfo),
+			Hovertemplate: ls.hoverTemplate(),
+			Visible:       b.Visible,
+		},
+	}
+	if ls.SeriesDef.Pull != "" {
+		trace.Pull = make([]float64, len(ls.Labels))
+		for i, l := range ls.Labels {
+			if stringify(l) == ls.SeriesDef.Pull {
+				trace.Pull[i] = 0.2
+			}
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
+
+func candlestickTraces(ls *LabeledSeries, b PlotBuild) ([]grob.Trace, error) {
+	trace := &grob.Candlestick{
+		Type:    grob.TraceTypeCandlestick,
+		Name:    ls.Name,
+		X:       ls.Labels,
+		Open:    ls.Columns["open"],
+		High:    ls.Columns["high"],
+		Low:     ls.Columns["low"],
+		Close:   ls.Columns["close"],
+		Visible: b.Visible,
+		Yaxis:   ls.SeriesDef.Yaxis,
+	}
+
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.IncreaseColor, ""); c != "" {
+		trace.Increasing = &grob.CandlestickIncreasing{
+			Line: &grob.CandlestickIncreasingLine{
+				Color: c,
+			},
+		}
+	}
+	if c := b.Config.MaybeLookupColor(ls.SeriesDef.DecreaseColor, ""); c != "" {
+		trace.Decreasing = &grob.CandlestickDecreasing{
+			Line: &grob.CandlestickDecreasingLine{
+				Color: c,
+			},
+		}
+	}
+	return []grob.Trace{trace}, nil
+}
@@ -0,0 +1,68 @@
+package ashby_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+	"github.com/plprobelab/ashby"
+)
+
+// the series type is registered as a program importing the package would
+func init() {
+	ashby.RegisterPlotType("steps", func(ls *ashby.LabeledSeries, b ashby.PlotBuild) ([]grob.Trace, error) {
+		return []grob.Trace{&grob.Scatter{
+			Type:    grob.TraceTypeScatter,
+			Name:    ls.Name,
+			X:       ls.Labels,
+			Y:       ls.Values,
+			Visible: b.Visible,
+			Line:    &grob.ScatterLine{Shape: grob.ScatterLineShapeHv},
+		}}, nil
+	})
+}
+
+func TestRegisterPlotTypeOutsidePackage(t *testing.T) {
+	ctx := context.Background()
+	cfg := &ashby.PlotConfig{
+		BasisTime: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC),
+		Sources:   map[string]ashby.DataSource{"static": &ashby.StaticDataSource{}},
+	}
+	pd, err := ashby.LoadPlotDef(ctx, "steps", []byte(`
+name: steps
+datasets:
+  - name: d
+    source: static
+    query: '{"x": [1, 2, 3], "y": [4, 5, 6]}'
+series:
+  - type: steps
+    name: s
+    dataset: d
+    labels: x
+    values: y
+`), cfg)
+	if err != nil {
+		t.Fatalf("load plot definition: %v", err)
+	}
+	data, err := ashby.GeneratePlot(ctx, pd, cfg.BasisTime)
+	if err != nil {
+		t.Fatalf("generate plot: %v", err)
+	}
+
+	var fig struct {
+		Data []struct {
+			Name string `json:"name"`
+			Line struct {
+				Shape string `json:"shape"`
+			} `json:"line"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &fig); err != nil {
+		t.Fatalf("unmarshal plot: %v", err)
+	}
+	if len(fig.Data) != 1 || fig.Data[0].Name != "s" || fig.Data[0].Line.Shape != "hv" {
+		t.Errorf("got traces %+v, want the single trace of the registered builder", fig.Data)
+	}
+}
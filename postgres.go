@@ -1,26 +1,48 @@
-package main
+package ashby
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// PgDataSource is a DataSource that queries a Postgres database. Connections
+// are pooled and reused across queries until the datasource is closed.
 type PgDataSource struct {
+	Pool PoolOptions
+
 	connstr  string
 	poolOnce sync.Once
 	err      error
 	pool     *pgxpool.Pool
 }
 
+func init() {
+	RegisterDataSource("postgres", func(cfg DataSourceConfig) (DataSource, error) {
+		src := NewPgDataSource(cfg.URL)
+		src.Pool = cfg.Pool
+		return src, nil
+	})
+}
+
 func NewPgDataSource(connstr string) *PgDataSource {
 	return &PgDataSource{
 		connstr: connstr,
 	}
 }
 
+// BindsParams reports that queries may use placeholders such as $1.
+func (p *PgDataSource) BindsParams() bool { return true }
+
+// RunsSetup reports that setup statements run on the connection of the query.
+func (p *PgDataSource) RunsSetup() bool { return true }
+
 func (p *PgDataSource) GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error) {
 	p.poolOnce.Do(func() {
 		conf, err := pgxpool.ParseConfig(p.connstr)
@@ -28,6 +50,11 @@ func (p *PgDataSource) GetDataSet(ctx context.Context, query string, params ...a
 			p.err = fmt.Errorf("unable to parse connection string: %w", err)
 			return
 		}
+		// pgxpool has no separate idle limit; idle connections are kept up
+		// to the maximum pool size
+		if p.Pool.MaxOpenConns > 0 {
+			conf.MaxConns = int32(p.Pool.MaxOpenConns)
+		}
 		pool, err := pgxpool.NewWithConfig(context.Background(), conf)
 		if err != nil {
 			p.err = fmt.Errorf("unable to connect to database: %w", err)
@@ -42,31 +69,81 @@ func (p *PgDataSource) GetDataSet(ctx context.Context, query string, params ...a
 
 	conn, err := p.pool.Acquire(ctx)
 	if err != nil {
-		p.err = fmt.Errorf("unable to connect to database: %w", err)
-		return nil, fmt.Errorf("execute query: %w", err)
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, params...)
+	// setup statements run in a transaction on the acquired connection so
+	// that the settings they make apply to the query and are undone when it
+	// is rolled back, before the connection is returned to the pool
+	var q interface {
+		Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	} = conn
+	if setup := SetupFromContext(ctx); len(setup) > 0 {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("begin transaction: %w", err)
+		}
+		defer tx.Rollback(context.Background())
+		for i, stmt := range setup {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return nil, fmt.Errorf("execute setup statement %d: %w", i+1, err)
+			}
+		}
+		q = tx
+	}
+
+	rows, err := q.Query(ctx, query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("execute query: %w", err)
 	}
+	defer rows.Close()
 
-	data := make(map[string][]any)
 	fds := rows.FieldDescriptions()
+	names := make([]string, len(fds))
+	for i, fd := range fds {
+		names[i] = fd.Name
+	}
+
+	rc := newRowCollector(ctx)
 	for rows.Next() {
 		vals, err := rows.Values()
 		if err != nil {
 			return nil, fmt.Errorf("read row values: %w", err)
 		}
-
-		for i, fd := range fds {
-			data[fd.Name] = append(data[fd.Name], vals[i])
+		if err := rc.Add(names, vals); err != nil {
+			return nil, err
 		}
 	}
 	if rows.Err() != nil {
 		return nil, fmt.Errorf("collect rows: %w", rows.Err())
 	}
 
-	return NewStaticDataSet(data), nil
+	return rc.DataSet(), nil
+}
+
+// Close closes all connections held by the datasource.
+func (p *PgDataSource) Close() error {
+	if p.pool != nil {
+		p.pool.Close()
+	}
+	return nil
+}
+
+// IsTransient reports whether err is a connection failure or one of the
+// Postgres errors that indicate the query may succeed if run again.
+func (p *PgDataSource) IsTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"53300", // too_many_connections
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// class 08 covers connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	return pgconn.SafeToRetry(err) || IsTransientError(err)
 }
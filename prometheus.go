@@ -0,0 +1,231 @@
+package ashby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusDataSource is a DataSource that runs PromQL range queries against
+// a Prometheus compatible HTTP API such as Prometheus or VictoriaMetrics.
+//
+// It is configured with a url such as
+// 'prometheus+https://hostname:9090/prefix?step=5m&lookback=168h&bearer_token=secret'.
+// The scheme 'prometheus' is equivalent to 'prometheus+http'. The range of
+// each query ends at the basis time of the plot and starts lookback earlier.
+// The lookback defaults to one period of the plot's frequency and the step
+// defaults to a value giving around 500 samples.
+//
+// Each sample becomes a row of the dataset with fields "time", "value" and
+// "series", which holds the formatted label set of the sample's series. Each
+// label is also available as a field of the same name.
+type PrometheusDataSource struct {
+	baseURL  string
+	token    string
+	step     time.Duration
+	lookback time.Duration
+	client   *http.Client
+	clock    Clock // tells the end of the range of queries without a basis time
+}
+
+func init() {
+	RegisterDataSource("prometheus", func(cfg DataSourceConfig) (DataSource, error) {
+		src, err := NewPrometheusDataSource(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		src.clock = cfg.Clock
+		return src, nil
+	})
+}
+
+func NewPrometheusDataSource(rawurl string) (*PrometheusDataSource, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("parse prometheus url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "prometheus", "prometheus+http":
+		u.Scheme = "http"
+	case "prometheus+https":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported prometheus url scheme: %q", u.Scheme)
+	}
+
+	p := &PrometheusDataSource{
+		client: http.DefaultClient,
+	}
+
+	q := u.Query()
+	if v := q.Get("step"); v != "" {
+		if p.step, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid step: %w", err)
+		}
+	}
+	if v := q.Get("lookback"); v != "" {
+		if p.lookback, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid lookback: %w", err)
+		}
+	}
+	p.token = q.Get("bearer_token")
+
+	u.RawQuery = ""
+	p.baseURL = strings.TrimSuffix(u.String(), "/")
+
+	return p, nil
+}
+
+// ReadsBasisTime reports that queries are evaluated up to the basis time.
+func (p *PrometheusDataSource) ReadsBasisTime() bool { return true }
+
+func (p *PrometheusDataSource) GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error) {
+	end := clockOrSystem(p.clock).Now()
+	lookback := p.lookback
+	if b, ok := QueryBasisFromContext(ctx); ok {
+		end = b.Time
+		if lookback == 0 {
+			lookback = b.Period()
+		}
+	}
+	if lookback == 0 {
+		lookback = 24 * time.Hour
+	}
+	start := end.Add(-lookback)
+
+	step := p.step
+	if step == 0 {
+		step = (lookback / 500).Truncate(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	}
+
+	form := url.Values{}
+	form.Set("query", strings.TrimSpace(query))
+	form.Set("start", strconv.FormatInt(start.Unix(), 10))
+	form.Set("end", strconv.FormatInt(end.Unix(), 10))
+	form.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/v1/query_range", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+		Data      struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Values [][2]any          `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("decode response: %w", &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status})
+		}
+		return nil, fmt.Errorf("decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s: %s: %w", result.ErrorType, result.Error, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+	if result.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type: %q", result.Data.ResultType)
+	}
+
+	// every label seen in any series becomes a field
+	labelSet := make(map[string]struct{})
+	for _, r := range result.Data.Result {
+		for k := range r.Metric {
+			labelSet[k] = struct{}{}
+		}
+	}
+	labels := make([]string, 0, len(labelSet))
+	for k := range labelSet {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+
+	data := map[string][]any{
+		"time":   {},
+		"value":  {},
+		"series": {},
+	}
+	for _, l := range labels {
+		data[l] = []any{}
+	}
+
+	for _, r := range result.Data.Result {
+		name := formatLabelSet(r.Metric)
+		for _, sample := range r.Values {
+			ts, ok := sample[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("unexpected sample timestamp: %v", sample[0])
+			}
+			vs, ok := sample[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected sample value: %v", sample[1])
+			}
+			v, err := strconv.ParseFloat(vs, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse sample value: %w", err)
+			}
+
+			data["time"] = append(data["time"], time.Unix(0, int64(ts*float64(time.Second))).UTC())
+			data["value"] = append(data["value"], v)
+			data["series"] = append(data["series"], name)
+			for _, l := range labels {
+				data[l] = append(data[l], r.Metric[l])
+			}
+		}
+	}
+
+	return NewStaticDataSet(data), nil
+}
+
+// formatLabelSet formats labels in the style used by Prometheus, such as
+// up{instance="localhost:9090",job="prometheus"}.
+func formatLabelSet(metric map[string]string) string {
+	keys := make([]string, 0, len(metric))
+	for k := range metric {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(metric["__name__"])
+	b.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(metric[k]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package ashby
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LoadQueryFiles reads the query files of the datasets of the plot definition
+// from fsys, which is rooted at the directory of the plot definition, and
+// sets the queries of the datasets to them. Query files are templated with
+// cfg in the same way as the plot definition itself, so that they may refer
+// to the basis time and template params. The params bound by the plot
+// definition produce markers in query files as they do in its queries.
+func (pd *PlotDef) LoadQueryFiles(ctx context.Context, fsys fs.FS, cfg *PlotConfig) error {
+	pd.queryFS = fsys
+	params, err := bindTemplateParams(cfg.TemplateParams, pd.Bind)
+	if err != nil {
+		return err
+	}
+	qcfg := *cfg
+	qcfg.TemplateParams = params
+	for i := range pd.Datasets {
+		dsd := &pd.Datasets[i]
+		if dsd.QueryFile == "" {
+			continue
+		}
+		if fsys == nil {
+			return fmt.Errorf("dataset %q: query file %q cannot be read, the plot definition was not loaded from a file", dsd.Name, dsd.QueryFile)
+		}
+		name := path.Clean(filepath.ToSlash(dsd.QueryFile))
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("dataset %q: query file must be a relative path within the directory of the plot definition: %q", dsd.Name, dsd.QueryFile)
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("dataset %q: read query file: %w", dsd.Name, err)
+		}
+		query, err := ExecuteTemplate(ctx, string(content), &qcfg)
+		if err != nil {
+			return fmt.Errorf("dataset %q: query file %q: %w", dsd.Name, dsd.QueryFile, err)
+		}
+		dsd.Query = query
+	}
+	return nil
+}
+
+// plotDefDir returns the filesystem rooted at the directory of the plot
+// definition file fname on the local filesystem.
+func plotDefDir(fname string) fs.FS {
+	return os.DirFS(filepath.Dir(fname))
+}
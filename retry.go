@@ -0,0 +1,101 @@
+package ashby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how a failing dataset query is retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay. The zero value runs each
+// query once.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound on the delay between attempts, zero for no bound
+	Jitter      float64       // fraction of each delay that is randomized, between 0 and 1
+}
+
+// TransientClassifier may be implemented by a DataSource that can recognize
+// which of its errors are temporary and worth retrying. Datasources that do
+// not implement it are classified using IsTransientError.
+type TransientClassifier interface {
+	IsTransient(err error) bool
+}
+
+// transientClassifier returns the function used to classify errors from src.
+func transientClassifier(src DataSource) func(error) bool {
+	if tc, ok := src.(TransientClassifier); ok {
+		return tc.IsTransient
+	}
+	return IsTransientError
+}
+
+// Do calls fn until it succeeds, returns an error that isTransient does not
+// accept, the attempts are exhausted or ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, isTransient func(error) bool, fn func(context.Context) error) error {
+	delay := p.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxAttempts || !isTransient(err) {
+			return err
+		}
+
+		wait := delay
+		if p.Jitter > 0 {
+			wait -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+		}
+		LoggerFromContext(ctx).Warn("retrying query after transient error", "attempt", attempt, "delay", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+// HTTPStatusError is returned by datasources that receive an unsuccessful
+// response from an HTTP server.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// IsTransientError reports whether err is likely to be caused by a temporary
+// condition such as a network failure, rate limiting or an unavailable
+// server.
+func IsTransientError(err error) bool {
+	var se *HTTPStatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
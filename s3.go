@@ -0,0 +1,233 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var _ Backend = (*S3Backend)(nil)
+
+// S3Backend is a Backend that stores files as objects in an S3 bucket. Object
+// keys are formed by joining Prefix with the slash separated file name.
+type S3Backend struct {
+	Bucket string
+	Prefix string
+	client *s3.Client
+}
+
+// NewS3Backend creates an S3Backend using the default AWS credential chain. If
+// region is empty then the region is taken from the AWS configuration.
+func NewS3Backend(ctx context.Context, bucket, prefix, region string) (*S3Backend, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	conf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	return &S3Backend{
+		Bucket: bucket,
+		Prefix: strings.Trim(prefix, "/"),
+		client: s3.NewFromConfig(conf),
+	}, nil
+}
+
+func (b *S3Backend) key(name string) string {
+	return path.Join(b.Prefix, filepath.ToSlash(name))
+}
+
+func (b *S3Backend) name(key string) string {
+	if b.Prefix != "" {
+		key = strings.TrimPrefix(key, b.Prefix+"/")
+	}
+	return filepath.FromSlash(key)
+}
+
+func (b *S3Backend) Write(ctx context.Context, name string, data []byte) error {
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(b.key(name)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType(name)),
+	}
+	if strings.HasSuffix(name, ".gz") {
+		in.ContentEncoding = aws.String("gzip")
+	}
+
+	_, err := b.client.PutObject(ctx, in)
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Read(ctx context.Context, name string) ([]byte, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (b *S3Backend) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, fmt.Errorf("head object: %w", err)
+	}
+
+	info := &s3FileInfo{
+		name: path.Base(b.key(name)),
+		size: aws.ToInt64(out.ContentLength),
+	}
+	if out.LastModified != nil {
+		info.modTime = *out.LastModified
+	}
+	return info, nil
+}
+
+// List lists the objects sharing the literal prefix of pattern and filters
+// them by matching the remainder of the pattern.
+func (b *S3Backend) List(ctx context.Context, pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	p := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(b.listPrefix(pattern)),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list objects: %w", err)
+		}
+		keys := make([]string, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+		names = append(names, b.matchKeys(pattern, keys)...)
+	}
+	return names, nil
+}
+
+// listPrefix returns the prefix of the keys of the objects that may match the
+// slash separated pattern, which is the key of its literal part before the
+// first glob metacharacter.
+func (b *S3Backend) listPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		pattern = pattern[:i]
+	}
+	return b.key(pattern)
+}
+
+// matchKeys returns the names of the objects with the keys that match the
+// slash separated pattern.
+func (b *S3Backend) matchKeys(pattern string, keys []string) []string {
+	var names []string
+	for _, key := range keys {
+		name := b.name(key)
+		if ok, _ := path.Match(pattern, filepath.ToSlash(name)); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (b *S3Backend) Remove(ctx context.Context, name string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(name)),
+	})
+	if err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+// Touch copies the object onto itself, which S3 only allows when its
+// metadata is replaced, so that its last modified time is updated.
+func (b *S3Backend) Touch(ctx context.Context, name string) error {
+	key := b.key(name)
+	in := &s3.CopyObjectInput{
+		Bucket:            aws.String(b.Bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String((&url.URL{Path: b.Bucket + "/" + key}).EscapedPath()),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		ContentType:       aws.String(contentType(name)),
+	}
+	if strings.HasSuffix(name, ".gz") {
+		in.ContentEncoding = aws.String("gzip")
+	}
+
+	if _, err := b.client.CopyObject(ctx, in); err != nil {
+		return fmt.Errorf("copy object: %w", err)
+	}
+	return nil
+}
+
+// contentTypes are the content types of the files written to S3, by
+// extension.
+var contentTypes = map[string]string{
+	".json": "application/json",
+	".html": "text/html; charset=utf-8",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".csv":  "text/csv; charset=utf-8",
+}
+
+// contentType returns the content type of the named file. The type of a
+// gzipped file is that of its contents, since it is served with a gzip
+// content encoding.
+func contentType(name string) string {
+	if ct, ok := contentTypes[path.Ext(strings.TrimSuffix(name, ".gz"))]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i *s3FileInfo) IsDir() bool        { return false }
+func (i *s3FileInfo) Sys() any           { return nil }
@@ -0,0 +1,83 @@
+package ashby
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	for name, want := range map[string]string{
+		"2023/05/08/peers.json":    "application/json",
+		"2023/05/08/peers.json.gz": "application/json",
+		"latest/peers.html":        "text/html; charset=utf-8",
+		"latest/peers.png":         "image/png",
+		"latest/peers.svg.gz":      "image/svg+xml",
+		"latest/peers.csv":         "text/csv; charset=utf-8",
+		"latest/peers.gz":          "application/octet-stream",
+		"latest/peers":             "application/octet-stream",
+	} {
+		if got := contentType(name); got != want {
+			t.Errorf("content type of %s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestS3BackendKeys(t *testing.T) {
+	for _, prefix := range []string{"", "reports", "reports/daily"} {
+		b := &S3Backend{Prefix: prefix}
+		for _, name := range []string{"2023/05/08/peers.json", "latest/peers.json", "manifest.json"} {
+			key := b.key(name)
+			if prefix != "" && key != prefix+"/"+name {
+				t.Errorf("key of %s with prefix %q: got %q, want %q", name, prefix, key, prefix+"/"+name)
+			}
+			if got := b.name(key); got != filepath.FromSlash(name) {
+				t.Errorf("name of key %q with prefix %q: got %q, want %q", key, prefix, got, name)
+			}
+		}
+	}
+}
+
+func TestS3BackendListPrefix(t *testing.T) {
+	b := &S3Backend{Prefix: "reports"}
+	for pattern, want := range map[string]string{
+		"2023/05/*/peers.json":    "reports/2023/05",
+		"2023/05/0?/peers.json":   "reports/2023/05/0",
+		`latest/peers\[eu\].json`: "reports/latest/peers",
+		"latest/[a-z]*.json":      "reports/latest",
+		"latest/peers.json":       "reports/latest/peers.json",
+		"*":                       "reports",
+	} {
+		if got := b.listPrefix(pattern); got != want {
+			t.Errorf("list prefix of %q: got %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestS3BackendMatchKeys(t *testing.T) {
+	b := &S3Backend{Prefix: "reports"}
+	keys := []string{
+		"reports/2023/05/08/peers.json",
+		"reports/2023/05/08/sub/peers.json",
+		"reports/2023/05/09/peers.json.gz",
+		"reports/2023/05/10/peers.json",
+		"reportsold/2023/05/11/peers.json",
+		"reports/2023/05/12/peers[eu].json",
+	}
+	for pattern, want := range map[string][]string{
+		"2023/05/*/peers.json":       {"2023/05/08/peers.json", "2023/05/10/peers.json"},
+		"2023/05/*/peers.json*":      {"2023/05/08/peers.json", "2023/05/09/peers.json.gz", "2023/05/10/peers.json"},
+		`2023/05/*/peers\[eu\].json`: {"2023/05/12/peers[eu].json"},
+		"2023/05/1[01]/peers.json":   {"2023/05/10/peers.json"},
+		"2023/05/*/*/peers.json":     {"2023/05/08/sub/peers.json"},
+	} {
+		got := b.matchKeys(pattern, keys)
+		var wantNames []string
+		for _, name := range want {
+			wantNames = append(wantNames, filepath.FromSlash(name))
+		}
+		if strings.Join(got, ",") != strings.Join(wantNames, ",") {
+			t.Errorf("names matching %q: got %q, want %q", pattern, got, wantNames)
+		}
+	}
+}
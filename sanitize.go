@@ -0,0 +1,119 @@
+package ashby
+
+import (
+	"math"
+	"reflect"
+)
+
+// sanitizeNonFinite replaces the NaN and infinite numbers held by v, which
+// must be a pointer, slice or map, with nulls, since JSON cannot represent
+// them and plotly shows a null as a gap. Numbers held by a field of a
+// concrete float type cannot be null and are set to zero instead, which
+// omits them from the JSON of plotly traces. It returns the number of values
+// replaced.
+func sanitizeNonFinite(v any) int {
+	return sanitizeValue(reflect.ValueOf(v))
+}
+
+func sanitizeValue(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return 0
+		}
+		return sanitizeValue(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		if replaced, n := sanitizedElem(e); n > 0 {
+			if !v.CanSet() {
+				return 0
+			}
+			if !replaced.IsValid() {
+				replaced = reflect.Zero(v.Type())
+			}
+			v.Set(replaced)
+			return n
+		}
+		return sanitizeValue(e)
+	case reflect.Struct:
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				n += sanitizeValue(f)
+			}
+		}
+		return n
+	case reflect.Slice, reflect.Array:
+		n := 0
+		for i := 0; i < v.Len(); i++ {
+			n += sanitizeValue(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			e := iter.Value()
+			if e.Kind() == reflect.Interface && !e.IsNil() {
+				e = e.Elem()
+			}
+			if replaced, rn := sanitizedElem(e); rn > 0 {
+				if !replaced.IsValid() {
+					replaced = reflect.Zero(v.Type().Elem())
+				}
+				v.SetMapIndex(iter.Key(), replaced)
+				n += rn
+				continue
+			}
+			n += sanitizeValue(e)
+		}
+		return n
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); !nonFinite(f) || !v.CanSet() {
+			return 0
+		}
+		v.SetFloat(0)
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sanitizedElem returns the replacement for the concrete value held by an
+// interface or map when the value is itself non-finite, which is the invalid
+// value standing for null, or a slice of floats holding non-finite numbers,
+// which is replaced by a slice of any so that they can be null. It returns
+// zero if the value needs no replacement in its container.
+func sanitizedElem(e reflect.Value) (reflect.Value, int) {
+	switch e.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if nonFinite(e.Float()) {
+			return reflect.Value{}, 1
+		}
+	case reflect.Slice:
+		if k := e.Type().Elem().Kind(); k != reflect.Float32 && k != reflect.Float64 {
+			return reflect.Value{}, 0
+		}
+		n := 0
+		vals := make([]any, e.Len())
+		for i := range vals {
+			f := e.Index(i).Float()
+			if nonFinite(f) {
+				n++
+				continue
+			}
+			vals[i] = e.Index(i).Interface()
+		}
+		if n > 0 {
+			return reflect.ValueOf(vals), n
+		}
+	}
+	return reflect.Value{}, 0
+}
+
+func nonFinite(f float64) bool {
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
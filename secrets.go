@@ -0,0 +1,170 @@
+package ashby
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A SecretResolver looks up the value of a secret from a reference whose
+// meaning depends on the provider.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// secretResolvers maps provider names used in secret references to their
+// resolvers.
+var secretResolvers = map[string]SecretResolver{
+	"env":  EnvSecretResolver{},
+	"file": FileSecretResolver{},
+	"gcp":  &GCPSecretResolver{client: http.DefaultClient},
+}
+
+// reSecretExpansion matches ${NAME} and ${secretRef:provider:ref}
+var reSecretExpansion = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// ExpandSecrets replaces each ${NAME} in s with the value of the environment
+// variable NAME and each ${secretRef:provider:ref} with the secret resolved
+// by the named provider. The expanded value must never be logged.
+func ExpandSecrets(ctx context.Context, s string) (string, error) {
+	var firstErr error
+	expanded := reSecretExpansion.ReplaceAllStringFunc(s, func(m string) string {
+		if firstErr != nil {
+			return m
+		}
+		val, err := resolveSecret(ctx, m[2:len(m)-1])
+		if err != nil {
+			firstErr = err
+			return m
+		}
+		return val
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return expanded, nil
+}
+
+func resolveSecret(ctx context.Context, expr string) (string, error) {
+	ref, isSecretRef := strings.CutPrefix(expr, "secretRef:")
+	if !isSecretRef {
+		return EnvSecretResolver{}.Resolve(ctx, expr)
+	}
+
+	provider, ref, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", fmt.Errorf("secret reference not valid, use format 'secretRef:provider:ref'")
+	}
+	r, ok := secretResolvers[provider]
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider: %q", provider)
+	}
+	val, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s secret: %w", provider, err)
+	}
+	return val, nil
+}
+
+// EnvSecretResolver resolves secrets from environment variables.
+type EnvSecretResolver struct{}
+
+func (EnvSecretResolver) Resolve(_ context.Context, ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", ref)
+	}
+	return val, nil
+}
+
+// FileSecretResolver resolves secrets from the contents of files, such as
+// those mounted by container orchestrators. A trailing newline is removed.
+type FileSecretResolver struct{}
+
+func (FileSecretResolver) Resolve(_ context.Context, ref string) (string, error) {
+	content, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// GCPSecretResolver resolves secrets from GCP Secret Manager. References are
+// secret version names such as 'projects/p/secrets/s/versions/latest'. It
+// authenticates with the access token in GOOGLE_OAUTH_ACCESS_TOKEN if set,
+// otherwise with a token from the GCE metadata server.
+type GCPSecretResolver struct {
+	client *http.Client
+}
+
+func (g *GCPSecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	token, err := g.token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://secretmanager.googleapis.com/v1/"+ref+":access", nil)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := g.getJSON(req, &result); err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode secret payload: %w", err)
+	}
+	return string(data), nil
+}
+
+func (g *GCPSecretResolver) token(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := g.getJSON(req, &result); err != nil {
+		return "", err
+	}
+	return result.AccessToken, nil
+}
+
+func (g *GCPSecretResolver) getJSON(req *http.Request, v any) error {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
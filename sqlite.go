@@ -0,0 +1,181 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	_ "modernc.org/sqlite" // registers the CGo-free sqlite driver
+)
+
+// SQLiteDataSource is a DataSource that queries a SQLite database file. It is
+// configured with a url such as 'sqlite:///path/to/file.db' or
+// 'sqlite:relative/file.db'. The path may be a template, which is executed
+// with the basis time of each query as .Now, so that a database may be chosen
+// per period, for example 'sqlite:///data/{{ .Now | date "2006-01" }}.db'.
+// Databases are opened read-only.
+type SQLiteDataSource struct {
+	Pool  PoolOptions
+	Clock Clock // tells the current time used for queries without a basis time, defaults to the system clock
+
+	path      *template.Template
+	templated bool // whether the path is templated and so may depend on the basis time
+
+	mu  sync.Mutex
+	dbs map[string]*sql.DB // open databases keyed by resolved path
+}
+
+func init() {
+	RegisterDataSource("sqlite", func(cfg DataSourceConfig) (DataSource, error) {
+		src, err := NewSQLiteDataSource(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		src.Pool = cfg.Pool
+		src.Clock = cfg.Clock
+		return src, nil
+	})
+}
+
+func NewSQLiteDataSource(url string) (*SQLiteDataSource, error) {
+	path := strings.TrimPrefix(url, "sqlite:")
+	path = strings.TrimPrefix(path, "//")
+	if path == "" {
+		return nil, fmt.Errorf("missing path in sqlite url: %q", url)
+	}
+
+	t, err := template.New("").Funcs(templateFuncs()).Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("parse sqlite path template: %w", err)
+	}
+	return &SQLiteDataSource{
+		path:      t,
+		templated: strings.Contains(path, "{{"),
+		dbs:       make(map[string]*sql.DB),
+	}, nil
+}
+
+// BindsParams reports that queries may use placeholders such as $1.
+func (s *SQLiteDataSource) BindsParams() bool { return true }
+
+// RunsSetup reports that setup statements, such as PRAGMA statements, run on
+// the connection of the query.
+func (s *SQLiteDataSource) RunsSetup() bool { return true }
+
+// ReadsBasisTime reports whether the database queried is chosen by templating
+// its path with the basis time.
+func (s *SQLiteDataSource) ReadsBasisTime() bool { return s.templated }
+
+// db returns the database for the basis time of the query, opening it if
+// needed.
+func (s *SQLiteDataSource) db(ctx context.Context) (*sql.DB, error) {
+	now := clockOrSystem(s.Clock).Now().UTC()
+	if b, ok := QueryBasisFromContext(ctx); ok {
+		now = b.Time
+	}
+	buf := new(bytes.Buffer)
+	if err := s.path.Execute(buf, map[string]any{"Now": now, "BasisTime": now}); err != nil {
+		return nil, fmt.Errorf("execute sqlite path template: %w", err)
+	}
+	path := buf.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if db, ok := s.dbs[path]; ok {
+		return db, nil
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	if s.Pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(s.Pool.MaxOpenConns)
+	}
+	if s.Pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(s.Pool.MaxIdleConns)
+	}
+	s.dbs[path] = db
+	return db, nil
+}
+
+func (s *SQLiteDataSource) GetDataSet(ctx context.Context, query string, params ...any) (DataSet, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single connection is taken from the pool so that the setup
+	// statements and the query share a session
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer conn.Close()
+	if setup := SetupFromContext(ctx); len(setup) > 0 {
+		// the settings made by setup statements would outlive the query, so
+		// the connection is discarded rather than returned to the pool
+		defer conn.Raw(func(any) error { return driver.ErrBadConn })
+		for i, stmt := range setup {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return nil, fmt.Errorf("execute setup statement %d: %w", i+1, err)
+			}
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("read columns: %w", err)
+	}
+
+	rc := newRowCollector(ctx)
+	vals := make([]any, len(names))
+	dest := make([]any, len(names))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("read row values: %w", err)
+		}
+		for i, v := range vals {
+			// text columns may be scanned as bytes
+			if b, ok := v.([]byte); ok {
+				vals[i] = string(b)
+			}
+		}
+		if err := rc.Add(names, vals); err != nil {
+			return nil, err
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("collect rows: %w", rows.Err())
+	}
+
+	return rc.DataSet(), nil
+}
+
+// Close closes all databases opened by the datasource.
+func (s *SQLiteDataSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for path, db := range s.dbs {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.dbs, path)
+	}
+	return err
+}
@@ -1,10 +1,11 @@
-package main
+package ashby
 
 import (
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -34,6 +35,7 @@ type StaticDataSet struct {
 	Data     map[string][]any
 	rowcount int
 	nextrow  int
+	fields   []string // optional order of the fields
 	err      error
 }
 
@@ -55,6 +57,20 @@ func NewStaticDataSet(data map[string][]any) *StaticDataSet {
 	return ds
 }
 
+// Fields returns the names of the fields of the dataset, sorted unless the
+// dataset was given an order.
+func (s *StaticDataSet) Fields() []string {
+	if s.fields != nil {
+		return append([]string{}, s.fields...)
+	}
+	names := make([]string, 0, len(s.Data))
+	for name := range s.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (s *StaticDataSet) ResetIterator() {
 	s.nextrow = 0
 }
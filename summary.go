@@ -0,0 +1,138 @@
+package ashby
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// PlotOutcome is the result of processing a plot definition in batch mode.
+type PlotOutcome string
+
+const (
+	PlotOutcomeUpdated   PlotOutcome = "updated"   // the plot was generated and its output written
+	PlotOutcomeUnchanged PlotOutcome = "unchanged" // the plot was generated but its output already held the same content
+	PlotOutcomeSkipped   PlotOutcome = "skipped"   // the plot was not written, such as because its output is fresh or its datasets are empty
+	PlotOutcomeFailed    PlotOutcome = "failed"    // the plot could not be generated
+	PlotOutcomeValidated PlotOutcome = "validated" // the plot definition was validated without running its queries
+	PlotOutcomeExcluded  PlotOutcome = "excluded"  // the plot was not selected by the name and tag filters
+	PlotOutcomeVerified  PlotOutcome = "verified"  // the latest copy of the plot is its newest dated plot
+	PlotOutcomeRepaired  PlotOutcome = "repaired"  // the latest copy of the plot was replaced with its newest dated plot
+)
+
+func (o PlotOutcome) String() string { return string(o) }
+
+// PlotResult records the outcome of processing a plot definition.
+type PlotResult struct {
+	PlotDef   string         `json:"plotdef"`
+	Name      string         `json:"name,omitempty"`      // empty if the plot definition could not be parsed
+	Params    map[string]any `json:"params,omitempty"`    // parameters of the profile variant the plot was generated for
+	Variant   string         `json:"variant,omitempty"`   // name of the template variant of the plot definition, if any
+	BasisTime *time.Time     `json:"basisTime,omitempty"` // basis time of the period the plot was generated for by a backfill
+	Outcome   PlotOutcome    `json:"outcome"`
+	Duration  float64        `json:"durationSeconds"`
+	Error     string         `json:"error,omitempty"`
+	Timing    *PlotTiming    `json:"timing,omitempty"` // time taken to generate the plot, if recorded
+	err       error          // the error that caused the plot to fail, if any
+}
+
+// logger returns a logger derived from base that identifies the plot by its
+// plot definition, name, if it is known, and template variant.
+func (pr *PlotResult) logger(base *slog.Logger) *slog.Logger {
+	logger := base.With("plotdef", pr.PlotDef)
+	if pr.Name != "" {
+		logger = logger.With("plot", pr.Name)
+	}
+	if pr.Variant != "" {
+		logger = logger.With("variant", pr.Variant)
+	}
+	return logger
+}
+
+// BatchError is returned by a batch run in which plots failed to generate.
+// It groups the errors by plot definition so that each can be acted on
+// without rerunning the batch.
+type BatchError struct {
+	Failures []PlotResult // ordered by plot definition
+}
+
+// NewBatchError returns an error for the failed plots among the results,
+// which must be ordered by plot definition, or nil if none failed.
+func NewBatchError(plots []PlotResult) error {
+	var failures []PlotResult
+	for _, pr := range plots {
+		if pr.Outcome == PlotOutcomeFailed {
+			failures = append(failures, pr)
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &BatchError{Failures: failures}
+}
+
+func (e *BatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d plots failed to generate:", len(e.Failures))
+	for i, pr := range e.Failures {
+		if i == 0 || pr.PlotDef != e.Failures[i-1].PlotDef {
+			b.WriteString("\n  " + pr.PlotDef)
+			if pr.Name != "" {
+				b.WriteString(" (" + pr.Name + ")")
+			}
+			b.WriteString(":")
+		}
+		b.WriteString("\n    ")
+		if len(pr.Params) > 0 {
+			fmt.Fprintf(&b, "params %v: ", pr.Params)
+		}
+		if pr.Variant != "" {
+			fmt.Fprintf(&b, "variant %q: ", pr.Variant)
+		}
+		// joined errors are reported on separate lines
+		b.WriteString(strings.ReplaceAll(pr.Error, "\n", "\n      "))
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the failed plots.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, pr := range e.Failures {
+		if pr.err != nil {
+			errs = append(errs, pr.err)
+		}
+	}
+	return errs
+}
+
+// RunSummary is a machine-readable report of a batch run. Plots that were
+// excluded by the filters are counted in the total but not listed.
+type RunSummary struct {
+	BasisTime time.Time    `json:"basisTime"`
+	Started   time.Time    `json:"started"`
+	Duration  float64      `json:"durationSeconds"`
+	Total     int          `json:"total"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Skipped   int          `json:"skipped"`
+	Failed    int          `json:"failed"`
+	Plots     []PlotResult `json:"plots"`
+}
+
+// WriteSummary writes the summary as JSON to fname.
+func WriteSummary(fname string, s *RunSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal summary: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := writeOutput(fname, data); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package ashby
 
 import (
 	"bytes"
@@ -8,8 +8,10 @@ import (
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v3"
 )
 
 func ExecuteTemplate(ctx context.Context, source string, cfg *PlotConfig) (string, error) {
@@ -19,23 +21,22 @@ func ExecuteTemplate(ctx context.Context, source string, cfg *PlotConfig) (strin
 		StartOfWeek time.Time
 	}
 
-	// See http://masterminds.github.io/sprig/
-	fm := sprig.FuncMap()
-	fm["timestamptz"] = pgTimestampTZ
-	fm["timestamp"] = pgTimestamp
-	fm["simpledate"] = simpleDateFormat
-	fm["isodate"] = isoDateFormat
-	fm["dayModify"] = dayModify     // a version of sprig's dateModify that accepts a number of days
-	fm["weekModify"] = weekModify   // a version of sprig's dateModify that accepts a number of weeks
-	fm["monthModify"] = monthModify // a version of sprig's dateModify that accepts a number of months
-	fm["toUpper"] = strings.ToUpper
-	fm["toTitle"] = strings.ToTitle
-
-	t, err := template.New("").Funcs(fm).Parse(source)
+	t, err := template.New("").Funcs(templateFuncs()).Parse(source)
 	if err != nil {
 		return "", fmt.Errorf("parse query template: %w", err)
 	}
 
+	// bound params must be known before templating so that their references
+	// produce markers instead of their values
+	bound, err := boundParams(source)
+	if err != nil {
+		return "", err
+	}
+	params, err := bindTemplateParams(cfg.TemplateParams, bound)
+	if err != nil {
+		return "", err
+	}
+
 	data := map[string]any{
 		"Now":         cfg.BasisTime,
 		"StartOfHour": cfg.BasisTime.Truncate(time.Hour),
@@ -48,17 +49,105 @@ func ExecuteTemplate(ctx context.Context, source string, cfg *PlotConfig) (strin
 		"EndOfPreviousDay":    cfg.BasisTime.Truncate(24 * time.Hour).Add(-time.Nanosecond),
 		"EndOfPreviousWeek":   cfg.BasisTime.Truncate(7 * 24 * time.Hour).Add(-time.Nanosecond),
 		"StartOfPreviousWeek": cfg.BasisTime.Truncate(7 * 24 * time.Hour).Add(-7 * 24 * time.Hour),
-		"Params":              cfg.TemplateParams,
+		"Params":              params,
+		"BasisTime":           cfg.BasisTime,
+	}
+
+	// the window of the period being plotted is only available when the
+	// frequency is known before templating
+	if w, ok := templateWindow(source, cfg.BasisTime, cfg.Defaults); ok {
+		data["Frequency"] = w.Frequency
+		data["PeriodStart"] = w.PeriodStart
+		data["WindowStart"] = w.WindowStart
+		data["WindowEnd"] = w.WindowEnd
 	}
 
 	buf := new(bytes.Buffer)
 	if err := t.Execute(buf, data); err != nil {
 		return "", fmt.Errorf("execute query template: %w", err)
 	}
+	if err := checkBoundParams(buf.String(), bound); err != nil {
+		return "", err
+	}
 
 	return buf.String(), nil
 }
 
+// TemplateWindow is the window of time covered by the period being plotted,
+// which is the last complete period of the plot's frequency before the basis
+// time. WindowEnd is exclusive and equal to PeriodStart, the start of the
+// period containing the basis time.
+type TemplateWindow struct {
+	Frequency   PlotFrequency
+	PeriodStart time.Time
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+// templateWindow returns the window of the plot definition in source, using
+// the same period boundaries as the Organizer. It returns false if the
+// frequency cannot be read from the untemplated source or the defaults, or is
+// unsupported.
+func templateWindow(source string, basisTime time.Time, defaults *PlotDefaults) (TemplateWindow, bool) {
+	var fields struct {
+		Frequency PlotFrequency `yaml:"frequency"`
+		Timezone  string        `yaml:"timezone"`
+		WeekStart string        `yaml:"weekStart"`
+	}
+	if err := yaml.Unmarshal([]byte(source), &fields); err != nil {
+		return TemplateWindow{}, false
+	}
+	doc := &PlotDef{Frequency: fields.Frequency, Timezone: fields.Timezone, WeekStart: fields.WeekStart}
+	defaults.apply(doc)
+	if _, ok := datedLayout(doc.Frequency); !ok {
+		return TemplateWindow{}, false
+	}
+
+	var loc *time.Location
+	if doc.Timezone != "" {
+		l, err := time.LoadLocation(doc.Timezone)
+		if err != nil {
+			return TemplateWindow{}, false
+		}
+		loc = l
+	}
+	weekStart := time.Monday
+	if doc.WeekStart != "" {
+		d, err := parseWeekday(doc.WeekStart)
+		if err != nil {
+			return TemplateWindow{}, false
+		}
+		weekStart = d
+	}
+
+	start := doc.Frequency.Truncate(basisTime, loc, weekStart)
+	return TemplateWindow{
+		Frequency:   doc.Frequency,
+		PeriodStart: start,
+		WindowStart: doc.Frequency.Truncate(start.Add(-time.Nanosecond), loc, weekStart),
+		WindowEnd:   start,
+	}, true
+}
+
+// templateFuncs returns the functions available to plot definition and
+// filename templates. These are the sprig functions, which include lower,
+// trimPrefix and env, together with helpers for dates and queries.
+func templateFuncs() template.FuncMap {
+	// See http://masterminds.github.io/sprig/
+	fm := sprig.FuncMap()
+	fm["timestamptz"] = pgTimestampTZ
+	fm["timestamp"] = pgTimestamp
+	fm["simpledate"] = simpleDateFormat
+	fm["isodate"] = isoDateFormat
+	fm["dayModify"] = dayModify     // a version of sprig's dateModify that accepts a number of days
+	fm["weekModify"] = weekModify   // a version of sprig's dateModify that accepts a number of weeks
+	fm["monthModify"] = monthModify // a version of sprig's dateModify that accepts a number of months
+	fm["addDays"] = addDays
+	fm["startOfWeek"] = startOfWeek
+	fm["slugify"] = slugify
+	return fm
+}
+
 func pgTimestampTZ(t time.Time) string {
 	return "'" + t.Format("2006-01-02 15:04:05 Z") + "'::timestamptz"
 }
@@ -101,3 +190,36 @@ func monthModify(fmt string, date time.Time) time.Time {
 
 	return date.AddDate(0, n, 0)
 }
+
+// addDays returns the date n calendar days after date, or before it if n is
+// negative, such as {{ .Now | addDays -7 }}.
+func addDays(n int, date time.Time) time.Time {
+	return date.AddDate(0, 0, n)
+}
+
+// startOfWeek returns the start of the Monday of the week containing date, in
+// the location of date.
+func startOfWeek(date time.Time) time.Time {
+	daysSinceMonday := (int(date.Weekday()) + 6) % 7
+	y, m, d := date.AddDate(0, 0, -daysSinceMonday).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+}
+
+// slugify lower-cases s and replaces each run of characters that are not
+// letters or digits with a single hyphen, such as "My Site" to "my-site".
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
@@ -0,0 +1,232 @@
+package ashby
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+	"gopkg.in/yaml.v3"
+)
+
+// Theme is a named set of styles applied to the layout of a plot. Colors may
+// be hex values or names defined in colors.yaml. Styles set explicitly in the
+// layout of a plot definition take precedence over those of its theme.
+type Theme struct {
+	Name           string   `yaml:"name"`
+	Colorway       []string `yaml:"colorway"`       // colors given to series in turn
+	Background     string   `yaml:"background"`     // color of the area around the plot
+	PlotBackground string   `yaml:"plotBackground"` // color of the plotting area, defaults to the background
+	FontFamily     string   `yaml:"fontFamily"`
+	FontSize       float64  `yaml:"fontSize"`
+	FontColor      string   `yaml:"fontColor"`
+	GridColor      string   `yaml:"gridColor"`
+}
+
+// ThemeDoc represents a document that defines a set of themes
+type ThemeDoc struct {
+	Themes []Theme `yaml:"themes"`
+}
+
+// builtinThemes are available to all plots and may be replaced by themes of
+// the same name defined in themes.yaml.
+var builtinThemes = []Theme{
+	{
+		Name:       "light",
+		Colorway:   plotlyColorway,
+		Background: "#ffffff",
+		FontFamily: "Open Sans, verdana, arial, sans-serif",
+		FontColor:  "#2a3f5f",
+		GridColor:  "#e5ecf6",
+	},
+	{
+		Name:       "dark",
+		Colorway:   []string{"#636efa", "#ef553b", "#00cc96", "#ab63fa", "#ffa15a", "#19d3f3", "#ff6692", "#b6e880", "#ff97ff", "#fecb52"},
+		Background: "#111111",
+		FontFamily: "Open Sans, verdana, arial, sans-serif",
+		FontColor:  "#f2f5fa",
+		GridColor:  "#283442",
+	},
+}
+
+// LoadThemes returns the built-in themes together with any defined in
+// themes.yaml in conffs, which may be nil.
+func LoadThemes(conffs fs.FS) (map[string]*Theme, error) {
+	themes := make(map[string]*Theme)
+	for i := range builtinThemes {
+		t := builtinThemes[i]
+		themes[t.Name] = &t
+	}
+	if conffs == nil {
+		return themes, nil
+	}
+
+	content, err := fs.ReadFile(conffs, "themes.yaml")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return themes, nil
+		}
+		return nil, fmt.Errorf("failed to read themes: %w", err)
+	}
+
+	var td ThemeDoc
+	if err := yaml.Unmarshal(content, &td); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal themes.yaml: %w", err)
+	}
+	for i := range td.Themes {
+		t := td.Themes[i]
+		if t.Name == "" {
+			return nil, fmt.Errorf("theme %d in themes.yaml has no name", i)
+		}
+		themes[t.Name] = &t
+	}
+	return themes, nil
+}
+
+// LoadColors reads the default color and the named colors of plots from
+// colors.yaml in conffs into cfg. The error wraps fs.ErrNotExist if there is
+// no colors.yaml.
+func LoadColors(cfg *PlotConfig, conffs fs.FS) error {
+	content, err := fs.ReadFile(conffs, "colors.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to read colors: %w", err)
+	}
+
+	var cd ColorDoc
+	if err := yaml.Unmarshal(content, &cd); err != nil {
+		return fmt.Errorf("failed to unmarshal colors.yaml: %w", err)
+	}
+	cfg.DefaultColor = cd.Default
+	cfg.Colors = make(map[string]string, len(cd.Colors))
+	for _, nc := range cd.Colors {
+		cfg.Colors[nc.Name] = nc.Color
+	}
+	return nil
+}
+
+// Apply sets the styles of the theme on the parts of the layout that have
+// not already been styled.
+func (t *Theme) Apply(l *PlotLayout, cfg *PlotConfig) {
+	color := func(name string) grob.Color {
+		if name == "" {
+			return nil
+		}
+		return cfg.MaybeLookupColor(name, "")
+	}
+
+	if len(l.Colorway) == 0 && len(t.Colorway) > 0 {
+		colorway := make(grob.ColorList, len(t.Colorway))
+		for i, c := range t.Colorway {
+			colorway[i] = color(c)
+		}
+		l.Colorway = colorway
+	}
+	if l.PaperBgcolor == nil {
+		l.PaperBgcolor = color(t.Background)
+	}
+	if l.PlotBgcolor == nil {
+		if t.PlotBackground != "" {
+			l.PlotBgcolor = color(t.PlotBackground)
+		} else {
+			l.PlotBgcolor = color(t.Background)
+		}
+	}
+
+	if t.FontFamily != "" || t.FontSize != 0 || t.FontColor != "" {
+		if l.Font == nil {
+			l.Font = &grob.LayoutFont{}
+		}
+		if l.Font.Family == nil && t.FontFamily != "" {
+			l.Font.Family = t.FontFamily
+		}
+		if l.Font.Size == 0 {
+			l.Font.Size = t.FontSize
+		}
+		if l.Font.Color == nil {
+			l.Font.Color = color(t.FontColor)
+		}
+	}
+
+	if t.GridColor != "" {
+		if l.Xaxis == nil {
+			l.Xaxis = &grob.LayoutXaxis{}
+		}
+		if l.Xaxis.Gridcolor == nil {
+			l.Xaxis.Gridcolor = color(t.GridColor)
+		}
+		if l.Yaxis == nil {
+			l.Yaxis = &grob.LayoutYaxis{}
+		}
+		if l.Yaxis.Gridcolor == nil {
+			l.Yaxis.Gridcolor = color(t.GridColor)
+		}
+		if l.Yaxis2 != nil && l.Yaxis2.Gridcolor == nil {
+			l.Yaxis2.Gridcolor = color(t.GridColor)
+		}
+		for _, axis := range l.facetXaxes {
+			if axis.Gridcolor == nil {
+				axis.Gridcolor = color(t.GridColor)
+			}
+		}
+		for _, axis := range l.facetYaxes {
+			if axis.Gridcolor == nil {
+				axis.Gridcolor = color(t.GridColor)
+			}
+		}
+	}
+}
+
+// clone returns a copy of the layout that may be styled without modifying the
+// original.
+func (l *PlotLayout) clone() *PlotLayout {
+	c := *l
+	if l.Font != nil {
+		font := *l.Font
+		c.Font = &font
+	}
+	if l.Xaxis != nil {
+		xaxis := *l.Xaxis
+		c.Xaxis = &xaxis
+	}
+	if l.Yaxis != nil {
+		yaxis := *l.Yaxis
+		c.Yaxis = &yaxis
+	}
+	if l.Yaxis2 != nil {
+		yaxis2 := *l.Yaxis2
+		c.Yaxis2 = &yaxis2
+	}
+	c.facetXaxes = make([]*grob.LayoutXaxis, len(l.facetXaxes))
+	for i, axis := range l.facetXaxes {
+		xaxis := *axis
+		c.facetXaxes[i] = &xaxis
+	}
+	c.facetYaxes = make([]*grob.LayoutYaxis, len(l.facetYaxes))
+	for i, axis := range l.facetYaxes {
+		yaxis := *axis
+		c.facetYaxes[i] = &yaxis
+	}
+	return &c
+}
+
+// ThemedFigure returns a copy of a figure generated for the plot with its
+// layout styled by the theme in place of the plot's own theme. The data of
+// the figure is shared with the original.
+func (pd *PlotDef) ThemedFigure(fig *grob.Fig, theme *Theme, cfg *PlotConfig) FigureData {
+	base := pd.unthemed
+	if base == nil {
+		base = &pd.Layout
+	}
+	layout := base.clone()
+	theme.Apply(layout, cfg)
+
+	themed := *fig
+	themed.Layout = &layout.Layout
+	return FigureData{
+		Fig:       &themed,
+		Layout:    layout,
+		Params:    pd.Parameters,
+		DynLayout: pd.DynLayout,
+		Config:    pd.Config,
+	}
+}
@@ -0,0 +1,202 @@
+package ashby
+
+import (
+	"fmt"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// ThresholdDef marks a target value or an acceptable range of values of a y
+// axis, drawn as a horizontal line or a shaded band across the plot. Values,
+// like the rest of the plot definition, may be template expressions. Points
+// and bars of the series plotted against the axis that exceed the threshold,
+// that is lie above a line, or below it if below is set, or outside a band,
+// may be given a highlight color.
+type ThresholdDef struct {
+	Value     any     `yaml:"value"`     // value of a target line
+	From      any     `yaml:"from"`      // lower value of a band
+	To        any     `yaml:"to"`        // upper value of a band
+	Color     string  `yaml:"color"`     // color of the line or band
+	Label     string  `yaml:"label"`     // optional text shown at the right end of the line or top of the band
+	Dash      string  `yaml:"dash"`      // dash style of a line, such as dot or dash
+	Opacity   float64 `yaml:"opacity"`   // opacity of a band, defaults to 0.2
+	Below     bool    `yaml:"below"`     // if values below a target line exceed it, rather than those above
+	Highlight string  `yaml:"highlight"` // optional color of the points and bars that exceed the threshold
+	Yaxis     string  `yaml:"yaxis"`     // optional name of the y axis the values refer to, such as y2
+}
+
+// plotlyColorway is the sequence of colors plotly gives traces without a
+// color of their own when the layout has no colorway.
+var plotlyColorway = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// transparent is the color of markers that are drawn only to highlight some
+// of the points of a line.
+const transparent = "rgba(0,0,0,0)"
+
+func (t *ThresholdDef) band() bool {
+	return t.Value == nil
+}
+
+func (t *ThresholdDef) validate() error {
+	if t.band() {
+		if t.From == nil || t.To == nil {
+			return fmt.Errorf("threshold must have a value or both from and to")
+		}
+	} else if t.From != nil || t.To != nil {
+		return fmt.Errorf("threshold may have either a value or from and to, not both")
+	}
+	if t.Opacity < 0 || t.Opacity > 1 {
+		return fmt.Errorf("threshold opacity must be between 0 and 1: %v", t.Opacity)
+	}
+	if t.Highlight != "" {
+		for _, v := range []any{t.Value, t.From, t.To} {
+			if _, ok := numericValue(normalizeValue(v)); v != nil && !ok {
+				return fmt.Errorf("threshold with a highlight must have numeric values: %v", v)
+			}
+		}
+		if t.Below && t.band() {
+			return fmt.Errorf("below may only be set for a threshold line")
+		}
+	}
+	return nil
+}
+
+// exceeds reports whether a value exceeds the threshold.
+func (t *ThresholdDef) exceeds(v float64) bool {
+	if t.band() {
+		from, _ := numericValue(normalizeValue(t.From))
+		to, _ := numericValue(normalizeValue(t.To))
+		return v < from || v > to
+	}
+	value, _ := numericValue(normalizeValue(t.Value))
+	if t.Below {
+		return v < value
+	}
+	return v > value
+}
+
+// thresholdShapes returns the shapes and labels drawn for the thresholds.
+// Bands are drawn below the traces so that they do not hide the data.
+func thresholdShapes(defs []ThresholdDef, cfg *PlotConfig) ([]any, []any) {
+	var shapes, labels []any
+	for _, def := range defs {
+		color := cfg.MaybeLookupColor(def.Color, "")
+		s := PlotShape{
+			RefX: "paper",
+			RefY: axisRef(def.Yaxis),
+			X0:   0,
+			X1:   1,
+			Line: PlotShapeLine{Color: color, Dash: def.Dash},
+		}
+		top := normalizeValue(def.Value)
+		if def.band() {
+			s.Type, s.Y0, s.Y1 = "rect", normalizeValue(def.From), normalizeValue(def.To)
+			s.Fillcolor, s.Opacity, s.Layer = color, def.Opacity, "below"
+			if s.Opacity == 0 {
+				s.Opacity = 0.2
+			}
+			top = s.Y1
+		} else {
+			s.Type, s.Y0, s.Y1 = "line", top, top
+		}
+		shapes = append(shapes, s)
+
+		if def.Label != "" {
+			labels = append(labels, PlotAnnotation{
+				RefX:    "paper",
+				RefY:    axisRef(def.Yaxis),
+				X:       1,
+				Y:       top,
+				Text:    def.Label,
+				XAnchor: "right",
+				YAnchor: "bottom",
+			})
+		}
+	}
+	return shapes, labels
+}
+
+// highlightThresholds colors the points or bars of a trace plotting the series
+// that exceed the thresholds of its value axis which have a highlight. Other
+// points keep the color of the series, which is the one plotly gives the
+// trace from the colorway if the series has none. The markers of lines are
+// shown only for the points that are highlighted.
+func highlightThresholds(trace grob.Trace, ls *LabeledSeries, pd *PlotDef, cfg *PlotConfig, index int) {
+	var defs []ThresholdDef
+	for _, def := range pd.Thresholds {
+		if def.Highlight != "" && axisRef(def.Yaxis) == ls.SeriesDef.valueAxis() {
+			defs = append(defs, def)
+		}
+	}
+	if len(defs) == 0 {
+		return
+	}
+
+	colors := make([]any, len(ls.Values))
+	exceeded := false
+	for i, v := range ls.Values {
+		f, ok := numericValue(v)
+		if !ok {
+			continue
+		}
+		for _, def := range defs {
+			if def.exceeds(f) {
+				colors[i], exceeded = cfg.MaybeLookupColor(def.Highlight, ""), true
+				break
+			}
+		}
+	}
+	if !exceeded {
+		return
+	}
+
+	fill := func(base string) []any {
+		for i, c := range colors {
+			if c == nil {
+				colors[i] = base
+			}
+		}
+		return colors
+	}
+	switch t := trace.(type) {
+	case *grob.Bar:
+		if t.Marker == nil {
+			t.Marker = &grob.BarMarker{}
+		}
+		t.Marker.Color = fill(seriesColor(ls, pd, cfg, index))
+	case *grob.Scatter:
+		if t.Marker == nil {
+			t.Marker = &grob.ScatterMarker{}
+		}
+		if t.Mode == "lines" {
+			t.Mode = "lines+markers"
+			if t.Line == nil {
+				t.Line = &grob.ScatterLine{}
+			}
+			if t.Line.Color == nil {
+				t.Line.Color = seriesColor(ls, pd, cfg, index)
+			}
+			t.Marker.Color = fill(transparent)
+		} else {
+			t.Marker.Color = fill(seriesColor(ls, pd, cfg, index))
+		}
+	}
+}
+
+// seriesColor returns the color of the series, or the color plotly gives the
+// trace at index from the colorway of the layout or theme if it has none.
+func seriesColor(ls *LabeledSeries, pd *PlotDef, cfg *PlotConfig, index int) string {
+	if c := cfg.MaybeLookupColor(ls.SeriesDef.Color, ls.Name); c != "" {
+		return c
+	}
+	if n := len(pd.Layout.Colorway); n > 0 {
+		if c, ok := pd.Layout.Colorway[index%n].(string); ok {
+			return c
+		}
+	}
+	colorway := plotlyColorway
+	if theme, ok := cfg.Themes[pd.Theme]; ok && len(theme.Colorway) > 0 {
+		colorway = theme.Colorway
+	}
+	return cfg.MaybeLookupColor(colorway[index%len(colorway)], "")
+}
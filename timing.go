@@ -0,0 +1,59 @@
+package ashby
+
+import (
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// PlotTiming records how long generating a plot took, split into the time
+// spent getting its datasets and the time spent building the figure from
+// them, together with the time taken by each dataset query.
+type PlotTiming struct {
+	Fetch   float64       `json:"fetchSeconds"`  // time spent getting the datasets, including joins and computed datasets
+	Render  float64       `json:"renderSeconds"` // time spent building the figure from the datasets
+	Queries []QueryTiming `json:"queries"`
+}
+
+// QueryTiming records how long the query of a dataset took, including any
+// retries.
+type QueryTiming struct {
+	Dataset  string  `json:"dataset"`
+	Source   string  `json:"source"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// addQuery records the duration of the query of a dataset.
+func (t *PlotTiming) addQuery(dataset string, source string, d time.Duration) {
+	t.Queries = append(t.Queries, QueryTiming{Dataset: dataset, Source: source, Duration: d.Seconds()})
+}
+
+// log logs the breakdown of the timing of the plot.
+func (t *PlotTiming) log(logger *slog.Logger) {
+	logger.Info("plot timing", "fetch", secondsDuration(t.Fetch), "render", secondsDuration(t.Render), "queries", len(t.Queries))
+	for _, q := range t.Queries {
+		logger.Info("query timing", "dataset", q.Dataset, "source", q.Source, "duration", secondsDuration(q.Duration))
+	}
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// setTimingMeta adds the timing to the meta of the layout under a timing key,
+// unless the plot definition gives the meta a value other than a map. The
+// meta is copied so that a meta shared with the defaults is not changed.
+func setTimingMeta(layout *PlotLayout, t *PlotTiming) {
+	meta := map[string]any{}
+	switch m := layout.Meta.(type) {
+	case nil:
+	case map[string]any:
+		for k, v := range m {
+			meta[k] = v
+		}
+	default:
+		return
+	}
+	meta["timing"] = t
+	layout.Meta = meta
+}
@@ -0,0 +1,250 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// numericValue converts a dataset value to a float64, reporting false if the
+// value is not numeric.
+func numericValue(v any) (float64, bool) {
+	switch tv := v.(type) {
+	case float64:
+		return tv, true
+	case float32:
+		return float64(tv), true
+	case int:
+		return float64(tv), true
+	case int8:
+		return float64(tv), true
+	case int16:
+		return float64(tv), true
+	case int32:
+		return float64(tv), true
+	case int64:
+		return float64(tv), true
+	case uint:
+		return float64(tv), true
+	case uint8:
+		return float64(tv), true
+	case uint16:
+		return float64(tv), true
+	case uint32:
+		return float64(tv), true
+	case uint64:
+		return float64(tv), true
+	default:
+		return 0, false
+	}
+}
+
+// horizontal reports whether the series plots its values along the x axis.
+func (s *SeriesDef) horizontal() bool {
+	switch s.Type {
+	case SeriesTypeHBar, SeriesTypeHBox, SeriesTypeHViolin:
+		return true
+	default:
+		return false
+	}
+}
+
+// valueAxis returns the name of the axis the values of the series are plotted on.
+func (s *SeriesDef) valueAxis() string {
+	if s.horizontal() {
+		return "x"
+	}
+	return s.yAxisName()
+}
+
+// labelAxis returns the name of the axis the labels of the series are plotted on.
+func (s *SeriesDef) labelAxis() string {
+	if s.horizontal() {
+		return s.yAxisName()
+	}
+	return "x"
+}
+
+func (s *SeriesDef) yAxisName() string {
+	if s.Yaxis == "" {
+		return "y"
+	}
+	return s.Yaxis
+}
+
+// logAxes returns the names of the axes of the plot that use a log scale.
+func (pd *PlotDef) logAxes() map[string]bool {
+	axes := make(map[string]bool)
+	if pd.Layout.Xaxis != nil && pd.Layout.Xaxis.Type == grob.LayoutXaxisTypeLog {
+		axes["x"] = true
+	}
+	if pd.Layout.Yaxis != nil && pd.Layout.Yaxis.Type == grob.LayoutYaxisTypeLog {
+		axes["y"] = true
+	}
+	if pd.Layout.Yaxis2 != nil && pd.Layout.Yaxis2.Type == grob.LayoutYaxisTypeLog {
+		axes["y2"] = true
+	}
+	return axes
+}
+
+// guardLogValues applies mode to the non-positive numeric values of a series
+// that would be plotted on a log axis, which cannot display them. Values are
+// guarded when guardValues is set and labels when guardLabels is set.
+func guardLogValues(ls *LabeledSeries, guardValues, guardLabels bool, mode NonPositiveMode, clamp float64) {
+	var guarded [][]any
+	if guardLabels {
+		guarded = append(guarded, ls.Labels)
+	}
+	if guardValues {
+		guarded = append(guarded, ls.Values)
+		for _, col := range ls.Columns {
+			guarded = append(guarded, col)
+		}
+	}
+
+	switch mode {
+	case NonPositiveModeClamp:
+		for _, vals := range guarded {
+			floor := clamp
+			if floor <= 0 {
+				floor = smallestPositive(vals)
+			}
+			for i, v := range vals {
+				if f, ok := numericValue(v); ok && f <= 0 {
+					vals[i] = floor
+				}
+			}
+		}
+	case NonPositiveModeDrop:
+		var drop []bool
+		for _, vals := range guarded {
+			for i, v := range vals {
+				if f, ok := numericValue(v); ok && f <= 0 {
+					if drop == nil {
+						drop = make([]bool, len(vals))
+					}
+					if i < len(drop) {
+						drop[i] = true
+					}
+				}
+			}
+		}
+		if drop == nil {
+			return
+		}
+		ls.Labels = dropIndexes(ls.Labels, drop)
+		ls.Values = dropIndexes(ls.Values, drop)
+		for role, col := range ls.Columns {
+			ls.Columns[role] = dropIndexes(col, drop)
+		}
+	}
+}
+
+// smallestPositive returns the smallest positive numeric value in vals, or 1
+// if there is none.
+func smallestPositive(vals []any) float64 {
+	min := math.Inf(1)
+	for _, v := range vals {
+		if f, ok := numericValue(v); ok && f > 0 && f < min {
+			min = f
+		}
+	}
+	if math.IsInf(min, 1) {
+		return 1
+	}
+	return min
+}
+
+// dropIndexes returns the values whose index is not marked in drop.
+func dropIndexes(vals []any, drop []bool) []any {
+	if vals == nil {
+		return nil
+	}
+	kept := vals[:0]
+	for i, v := range vals {
+		if i < len(drop) && drop[i] {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
+
+// MovingAverageDef configures a smoothed copy of a series.
+type MovingAverageDef struct {
+	Window int               `yaml:"window"` // number of points averaged
+	Type   MovingAverageType `yaml:"type"`   // the weighting of the points in the window, defaults to simple
+}
+
+type MovingAverageType string
+
+const (
+	MovingAverageTypeSimple      MovingAverageType = "simple"   // unweighted mean of the window
+	MovingAverageTypeWeighted    MovingAverageType = "weighted" // mean of the window weighted linearly towards the most recent point
+	MovingAverageTypeExponential MovingAverageType = "ema"      // exponential moving average with a span of the window
+)
+
+func (t MovingAverageType) String() string { return string(t) }
+
+// movingAverage smooths vals according to def. Windows at the start of the
+// series are averaged over the points available rather than left empty.
+// Non-numeric values produce nil and are excluded from the averages.
+func movingAverage(vals []any, def *MovingAverageDef) []any {
+	switch def.Type {
+	case MovingAverageTypeWeighted:
+		out := make([]any, len(vals))
+		for i := range vals {
+			if _, ok := numericValue(vals[i]); !ok {
+				continue
+			}
+			var sum, weights float64
+			for j := i; j >= 0 && j > i-def.Window; j-- {
+				if f, ok := numericValue(vals[j]); ok {
+					w := float64(def.Window - (i - j))
+					sum += w * f
+					weights += w
+				}
+			}
+			out[i] = sum / weights
+		}
+		return out
+	case MovingAverageTypeExponential:
+		out := make([]any, len(vals))
+		alpha := 2 / float64(def.Window+1)
+		var ema float64
+		seeded := false
+		for i, v := range vals {
+			f, ok := numericValue(v)
+			if !ok {
+				continue
+			}
+			if !seeded {
+				ema, seeded = f, true
+			} else {
+				ema = alpha*f + (1-alpha)*ema
+			}
+			out[i] = ema
+		}
+		return out
+	default:
+		return rollingMean(vals, def.Window)
+	}
+}
+
+// movingAverageTrace returns a line trace of the moving average of a series.
+func movingAverageTrace(ls *LabeledSeries) *grob.Scatter {
+	def := ls.SeriesDef.MovingAverage
+	abbrev := "SMA"
+	switch def.Type {
+	case MovingAverageTypeWeighted:
+		abbrev = "WMA"
+	case MovingAverageTypeExponential:
+		abbrev = "EMA"
+	}
+
+	trace := overlayTrace(ls)
+	trace.Name = fmt.Sprintf("%s (%d point %s)", ls.Name, def.Window, abbrev)
+	setOverlayValues(trace, ls, movingAverage(ls.Values, def))
+	return trace
+}
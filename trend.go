@@ -0,0 +1,292 @@
+package ashby
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// TrendlineSpec is a parsed trendline option of a series.
+type TrendlineSpec struct {
+	Kind string // linear, poly or rolling-mean
+	N    int    // degree of a polynomial or window of a rolling mean
+}
+
+// parseTrendline parses a trendline option of the form linear, poly:N or
+// rolling-mean:N.
+func parseTrendline(s string) (TrendlineSpec, error) {
+	kind, arg, hasArg := strings.Cut(s, ":")
+	switch kind {
+	case "linear":
+		if hasArg {
+			return TrendlineSpec{}, fmt.Errorf("linear trendline takes no argument")
+		}
+		return TrendlineSpec{Kind: kind, N: 1}, nil
+	case "poly", "rolling-mean":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return TrendlineSpec{}, fmt.Errorf("%s trendline requires a positive integer argument, use format '%s:N'", kind, kind)
+		}
+		return TrendlineSpec{Kind: kind, N: n}, nil
+	default:
+		return TrendlineSpec{}, fmt.Errorf("unknown trendline: %q", s)
+	}
+}
+
+// trendlineTrace computes the trendline of a series and returns it as a line
+// trace. The series itself is not modified.
+func trendlineTrace(ls *LabeledSeries, spec TrendlineSpec) (*grob.Scatter, error) {
+	xs := labelPositions(ls.Labels, len(ls.Values))
+
+	// only points with a numeric value contribute to the fit
+	var fx, fy []float64
+	for i, v := range ls.Values {
+		if f, ok := numericValue(v); ok && !math.IsNaN(f) {
+			fx = append(fx, xs[i])
+			fy = append(fy, f)
+		}
+	}
+
+	trace := overlayTrace(ls)
+	trace.Line.Dash = "dash"
+
+	switch spec.Kind {
+	case "linear", "poly":
+		if len(fx) <= spec.N {
+			return nil, fmt.Errorf("not enough points to fit a degree %d polynomial: %d", spec.N, len(fx))
+		}
+		coeffs, err := polyFit(fx, fy, spec.N)
+		if err != nil {
+			return nil, err
+		}
+
+		ys := make([]any, len(xs))
+		for i, x := range xs {
+			ys[i] = polyEval(coeffs, x)
+		}
+		fitted := make([]float64, len(fx))
+		for i, x := range fx {
+			fitted[i] = polyEval(coeffs, x)
+		}
+		r2 := rSquared(fy, fitted)
+
+		setOverlayValues(trace, ls, ys)
+		trace.Name = fmt.Sprintf("%s trend (R²=%.3f)", ls.Name, r2)
+		trace.Hovertext = formatPolynomial(coeffs) + fmt.Sprintf("<br>R²=%.4f", r2)
+	case "rolling-mean":
+		setOverlayValues(trace, ls, rollingMean(ls.Values, spec.N))
+		trace.Name = fmt.Sprintf("%s rolling mean (%d)", ls.Name, spec.N)
+	}
+
+	return trace, nil
+}
+
+// overlayTrace returns a line trace to be drawn over a series, such as a
+// trendline. Its values are set with setOverlayValues.
+func overlayTrace(ls *LabeledSeries) *grob.Scatter {
+	return &grob.Scatter{
+		Type:  grob.TraceTypeScatter,
+		Mode:  "lines",
+		Yaxis: ls.SeriesDef.Yaxis,
+		Line:  &grob.ScatterLine{},
+	}
+}
+
+// setOverlayValues sets the values of an overlay trace against the labels of
+// the series, respecting its orientation.
+func setOverlayValues(trace *grob.Scatter, ls *LabeledSeries, vals []any) {
+	if ls.SeriesDef.horizontal() {
+		trace.X, trace.Y = vals, ls.Labels
+		return
+	}
+	trace.X, trace.Y = ls.Labels, vals
+}
+
+// labelPositions converts series labels to positions on a continuous axis.
+// Numeric labels are used as-is and times are converted to unix seconds. Any
+// other labels are treated as categories positioned by their index.
+func labelPositions(labels []any, n int) []float64 {
+	xs := make([]float64, n)
+	for i := range xs {
+		xs[i] = float64(i)
+	}
+	if len(labels) != n {
+		return xs
+	}
+
+	pos := make([]float64, n)
+	for i, l := range labels {
+		if f, ok := numericValue(l); ok {
+			pos[i] = f
+			continue
+		}
+		if s, ok := l.(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				pos[i] = float64(t.Unix())
+				continue
+			}
+		}
+		return xs
+	}
+	return pos
+}
+
+// polyFit returns the coefficients, lowest order first, of the least squares
+// polynomial of the given degree through the points.
+func polyFit(xs, ys []float64, degree int) ([]float64, error) {
+	// x values are standardized for numerical stability, which matters for
+	// large values such as unix timestamps
+	mean, scale := meanAndScale(xs)
+
+	n := degree + 1
+	// normal equations as an augmented matrix
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n+1)
+	}
+	for k, x := range xs {
+		z := (x - mean) / scale
+		pows := make([]float64, 2*n)
+		pows[0] = 1
+		for p := 1; p < len(pows); p++ {
+			pows[p] = pows[p-1] * z
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				m[i][j] += pows[i+j]
+			}
+			m[i][n] += pows[i] * ys[k]
+		}
+	}
+
+	// gaussian elimination with partial pivoting
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("trendline fit is degenerate")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := col + 1; r < n; r++ {
+			f := m[r][col] / m[col][col]
+			for c := col; c <= n; c++ {
+				m[r][c] -= f * m[col][c]
+			}
+		}
+	}
+	scaled := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := m[r][n]
+		for c := r + 1; c < n; c++ {
+			sum -= m[r][c] * scaled[c]
+		}
+		scaled[r] = sum / m[r][r]
+	}
+
+	// expand b_k ((x-mean)/scale)^k into coefficients of x
+	coeffs := make([]float64, n)
+	for k, b := range scaled {
+		for j := 0; j <= k; j++ {
+			coeffs[j] += b * binomial(k, j) * math.Pow(-mean, float64(k-j)) / math.Pow(scale, float64(k))
+		}
+	}
+	return coeffs, nil
+}
+
+func meanAndScale(xs []float64) (float64, float64) {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+
+	var ss float64
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	scale := math.Sqrt(ss / float64(len(xs)))
+	if scale == 0 {
+		scale = 1
+	}
+	return mean, scale
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
+
+func polyEval(coeffs []float64, x float64) float64 {
+	var y float64
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = y*x + coeffs[i]
+	}
+	return y
+}
+
+// rSquared returns the coefficient of determination of fitted values.
+func rSquared(ys, fitted []float64) float64 {
+	var mean float64
+	for _, y := range ys {
+		mean += y
+	}
+	mean /= float64(len(ys))
+
+	var ssRes, ssTot float64
+	for i, y := range ys {
+		ssRes += (y - fitted[i]) * (y - fitted[i])
+		ssTot += (y - mean) * (y - mean)
+	}
+	if ssTot == 0 {
+		return 1
+	}
+	return 1 - ssRes/ssTot
+}
+
+// formatPolynomial formats coefficients, lowest order first, as an equation.
+func formatPolynomial(coeffs []float64) string {
+	var terms []string
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		switch i {
+		case 0:
+			terms = append(terms, fmt.Sprintf("%.4g", coeffs[i]))
+		case 1:
+			terms = append(terms, fmt.Sprintf("%.4gx", coeffs[i]))
+		default:
+			terms = append(terms, fmt.Sprintf("%.4gx^%d", coeffs[i], i))
+		}
+	}
+	return "y = " + strings.Join(terms, " + ")
+}
+
+// rollingMean returns the mean of each value and up to window-1 preceding
+// numeric values. Non-numeric values are skipped and produce nil.
+func rollingMean(vals []any, window int) []any {
+	out := make([]any, len(vals))
+	for i := range vals {
+		if _, ok := numericValue(vals[i]); !ok {
+			continue
+		}
+		var sum float64
+		var n int
+		for j := i; j >= 0 && j > i-window; j-- {
+			if f, ok := numericValue(vals[j]); ok {
+				sum += f
+				n++
+			}
+		}
+		out[i] = sum / float64(n)
+	}
+	return out
+}
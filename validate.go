@@ -0,0 +1,197 @@
+package ashby
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A ValidationProblem is a problem found in a plot definition. Problems that
+// do not prevent the plot from being generated are warnings.
+type ValidationProblem struct {
+	File    string
+	Field   string // path of the field with the problem, empty if it concerns the whole definition
+	Message string
+	Warning bool
+}
+
+func (p ValidationProblem) String() string {
+	var b strings.Builder
+	if p.Warning {
+		b.WriteString("warning: ")
+	} else {
+		b.WriteString("error: ")
+	}
+	b.WriteString(p.File)
+	if p.Field != "" {
+		b.WriteString(": " + p.Field)
+	}
+	b.WriteString(": " + p.Message)
+	return b.String()
+}
+
+// ValidatePlotDefFile returns the problems found in the plot definition in
+// the file. A plot definition with template variants is checked once for
+// each of them.
+func ValidatePlotDefFile(ctx context.Context, fname string, cfg *PlotConfig) []ValidationProblem {
+	fcontent, err := os.ReadFile(fname)
+	if err != nil {
+		return []ValidationProblem{{File: fname, Message: err.Error()}}
+	}
+
+	variants, err := plotVariants(ctx, fname, string(fcontent), cfg)
+	if err != nil {
+		return []ValidationProblem{{File: fname, Field: "variants", Message: err.Error()}}
+	}
+	if len(variants) == 0 {
+		return validatePlotDef(ctx, fname, string(fcontent), cfg)
+	}
+
+	var problems []ValidationProblem
+	for i := range variants {
+		for _, p := range validatePlotDef(ctx, fname, string(fcontent), variants[i].config(cfg)) {
+			p.Message = fmt.Sprintf("variant %q: %s", variants[i].Name, p.Message)
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// validatePlotDef templates and checks the source of a plot definition.
+// Unknown fields are reported as warnings since they are ignored when the
+// plot is generated.
+func validatePlotDef(ctx context.Context, fname string, source string, cfg *PlotConfig) []ValidationProblem {
+	templated, err := ExecuteTemplate(ctx, source, cfg)
+	if err != nil {
+		return []ValidationProblem{{File: fname, Message: err.Error()}}
+	}
+
+	var problems []ValidationProblem
+	add := func(field string, format string, args ...any) {
+		problems = append(problems, ValidationProblem{File: fname, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var pd PlotDef
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(templated)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&pd); err != nil {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			add("", "%v", err)
+			return problems
+		}
+		// unknown fields are the only errors that go away when the
+		// definition is decoded without checking for them
+		lax := make(map[string]bool)
+		var lpd PlotDef
+		if err := yaml.Unmarshal([]byte(templated), &lpd); err != nil {
+			var lte *yaml.TypeError
+			if errors.As(err, &lte) {
+				for _, msg := range lte.Errors {
+					lax[msg] = true
+				}
+			}
+		}
+		for _, msg := range te.Errors {
+			problems = append(problems, ValidationProblem{
+				File:    fname,
+				Message: msg,
+				Warning: !lax[msg],
+			})
+		}
+	}
+	cfg.Defaults.apply(&pd)
+
+	if pd.Name == "" {
+		add("name", "is required")
+	}
+	if pd.Frequency == "" {
+		add("frequency", "is required")
+	} else if _, err := pd.Frequency.parseInterval(); err != nil {
+		add("frequency", "%v", err)
+	} else if _, ok := datedLayout(pd.Frequency); !ok {
+		add("frequency", "unsupported plot frequency: %q", pd.Frequency)
+	}
+	if len(pd.Datasets) == 0 {
+		add("datasets", "at least one dataset is required")
+	}
+
+	datasets := make(map[string]bool)
+	for i, ds := range pd.Datasets {
+		field := fmt.Sprintf("datasets[%d]", i)
+		switch {
+		case ds.Name == "":
+			add(field+".name", "is required")
+		case datasets[ds.Name]:
+			add(field+".name", "duplicate dataset: %q", ds.Name)
+		}
+		datasets[ds.Name] = true
+		if ds.Source == "" {
+			add(field+".source", "is required")
+		}
+	}
+	for i, j := range pd.Joins {
+		field := fmt.Sprintf("joins[%d]", i)
+		if j.Left.DataSet != "" && !datasets[j.Left.DataSet] {
+			add(field+".left.dataset", "unknown dataset: %q", j.Left.DataSet)
+		}
+		if j.Right.DataSet != "" && !datasets[j.Right.DataSet] {
+			add(field+".right.dataset", "unknown dataset: %q", j.Right.DataSet)
+		}
+		if datasets[j.Name] {
+			add(field+".name", "duplicate dataset: %q", j.Name)
+		}
+		datasets[j.Name] = true
+	}
+	for i, c := range pd.Computed {
+		datasets[c.Name] = true
+		for j, cd := range c.DataSets {
+			if !datasets[cd.DataSet] {
+				add(fmt.Sprintf("computed[%d].datasets[%d].dataset", i, j), "unknown dataset: %q", cd.DataSet)
+			}
+		}
+	}
+
+	for i, s := range pd.Series {
+		field := fmt.Sprintf("series[%d]", i)
+		if _, ok := plotBuilder(s.Type); !ok {
+			add(field+".type", "unknown series type: %q", s.Type)
+		}
+		if !datasets[s.DataSet] {
+			add(field+".dataset", "unknown dataset: %q", s.DataSet)
+		}
+	}
+	for i, s := range pd.Scalars {
+		if !datasets[s.DataSet] {
+			add(fmt.Sprintf("scalars[%d].dataset", i), "unknown dataset: %q", s.DataSet)
+		}
+	}
+	for i, t := range pd.Tables {
+		if !datasets[t.DataSet] {
+			add(fmt.Sprintf("tables[%d].dataset", i), "unknown dataset: %q", t.DataSet)
+		}
+	}
+
+	for _, p := range problems {
+		if !p.Warning {
+			return problems
+		}
+	}
+
+	// the remaining checks are those made when the plot definition is
+	// parsed for generation, which stop at the first problem
+	parsed, err := parsePlotDef(fname, []byte(templated), cfg.Defaults)
+	if err != nil {
+		add("", "%v", err)
+		return problems
+	}
+	if err := parsed.LoadQueryFiles(ctx, plotDefDir(fname), cfg); err != nil {
+		add("datasets", "%v", err)
+	}
+	return problems
+}
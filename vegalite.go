@@ -0,0 +1,187 @@
+package ashby
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const vegaLiteSchema = "https://vega.github.io/schema/vega-lite/v5.json"
+
+// plottedSeries is a series as it was plotted, kept so that the plot can be
+// written in formats other than plotly.
+type plottedSeries struct {
+	series *LabeledSeries
+	color  string // resolved color of the series, empty if plotly chose it
+}
+
+// vegaLiteMark returns the Vega-Lite mark that draws a series, reporting
+// false if the type of series cannot be expressed as one.
+func vegaLiteMark(s *SeriesDef) (string, bool) {
+	switch s.Type {
+	case SeriesTypeBar, SeriesTypeHBar:
+		return "bar", true
+	case SeriesTypeLine:
+		if s.Fill == FillTypeToZero {
+			return "area", true
+		}
+		return "line", true
+	case SeriesTypeScatter:
+		return "point", true
+	case SeriesTypeArea:
+		return "area", true
+	default:
+		return "", false
+	}
+}
+
+// vegaLiteSpec returns the Vega-Lite specification of the plot generated by
+// the last call to generateFig. The points of every series are given as a
+// single table of values with the fields series, label and value, which are
+// encoded by color, the label axis and the value axis. Each type of mark is
+// drawn by its own layer. Only bar, line and scatter series are supported,
+// and options that are specific to plotly, such as the layout, are not
+// translated other than the title.
+func vegaLiteSpec(pd *PlotDef) ([]byte, error) {
+	if len(pd.Scalars) > 0 || len(pd.Tables) > 0 {
+		return nil, fmt.Errorf("vega-lite output only supports series, not scalars or tables")
+	}
+	if pd.Facet != nil {
+		return nil, fmt.Errorf("vega-lite output does not support facets")
+	}
+
+	var (
+		values  = []map[string]any{}
+		marks   []string
+		byMark  = make(map[string][]string)
+		labels  []any
+		domain  []string
+		colors  []string
+		colored bool
+	)
+	for _, ps := range pd.plotted {
+		ls := ps.series
+		mark, ok := vegaLiteMark(ls.SeriesDef)
+		if !ok {
+			return nil, fmt.Errorf("vega-lite output does not support %s series", ls.SeriesDef.Type)
+		}
+		if _, seen := byMark[mark]; !seen {
+			marks = append(marks, mark)
+		}
+		byMark[mark] = append(byMark[mark], ls.Name)
+
+		for i, v := range ls.Values {
+			var l any
+			if i < len(ls.Labels) {
+				l = ls.Labels[i]
+			}
+			labels = append(labels, l)
+			values = append(values, map[string]any{"series": ls.Name, "label": l, "value": v})
+		}
+
+		domain = append(domain, ls.Name)
+		colors = append(colors, ps.color)
+		if ps.color != "" {
+			colored = true
+		}
+	}
+	if len(marks) == 0 {
+		return nil, fmt.Errorf("vega-lite output requires at least one series")
+	}
+
+	labelAxis, valueAxis := "x", "y"
+	horizontal := pd.plotted[0].series.SeriesDef.horizontal()
+	for _, ps := range pd.plotted {
+		if ps.series.SeriesDef.horizontal() != horizontal {
+			return nil, fmt.Errorf("vega-lite output does not support mixing horizontal and vertical series")
+		}
+	}
+	if horizontal {
+		labelAxis, valueAxis = "y", "x"
+	}
+	color := map[string]any{"field": "series", "type": "nominal"}
+	if colored {
+		// series without a color of their own are given a default one
+		for i, c := range colors {
+			if c == "" {
+				colors[i] = vegaLiteDefaultColors[i%len(vegaLiteDefaultColors)]
+			}
+		}
+		color["scale"] = map[string]any{"domain": domain, "range": colors}
+	}
+	encoding := map[string]any{
+		labelAxis: map[string]any{"field": "label", "type": vegaLiteFieldType(labels)},
+		valueAxis: map[string]any{"field": "value", "type": "quantitative"},
+		"color":   color,
+	}
+
+	spec := map[string]any{
+		"$schema":  vegaLiteSchema,
+		"data":     map[string]any{"values": values},
+		"encoding": encoding,
+	}
+	if title := plotTitle(pd); title != "" {
+		spec["title"] = title
+	}
+	if len(marks) == 1 {
+		spec["mark"] = marks[0]
+	} else {
+		var layers []map[string]any
+		for _, mark := range marks {
+			names := byMark[mark]
+			sort.Strings(names)
+			layers = append(layers, map[string]any{
+				"mark":      mark,
+				"transform": []map[string]any{{"filter": map[string]any{"field": "series", "oneOf": names}}},
+			})
+		}
+		spec["layer"] = layers
+	}
+
+	// values that are not finite numbers are replaced with nulls as in the
+	// plotly figure, since they cannot be encoded as JSON
+	sanitizeNonFinite(spec)
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal vega-lite spec: %w", err)
+	}
+	return data, nil
+}
+
+// vegaLiteDefaultColors is the default Vega-Lite category palette.
+var vegaLiteDefaultColors = []string{"#4c78a8", "#f58518", "#e45756", "#72b7b2", "#54a24b", "#eeca3b", "#b279a2", "#ff9da6", "#9d755d", "#bab0ac"}
+
+// vegaLiteFieldType returns the Vega-Lite type of a field holding the values,
+// which is temporal if they are all times, quantitative if they are all
+// numbers and nominal otherwise.
+func vegaLiteFieldType(vals []any) string {
+	temporal, numeric := true, true
+	for _, v := range vals {
+		if v == nil {
+			continue
+		}
+		if _, _, ok := parseTimeLabel(v); !ok {
+			temporal = false
+		}
+		if _, ok := numericValue(v); !ok {
+			numeric = false
+		}
+	}
+	switch {
+	case numeric:
+		return "quantitative"
+	case temporal:
+		return "temporal"
+	default:
+		return "nominal"
+	}
+}
+
+// plotTitle returns the text of the title of the plot, if any.
+func plotTitle(pd *PlotDef) string {
+	if pd.Layout.Title == nil {
+		return ""
+	}
+	s, _ := pd.Layout.Title.Text.(string)
+	return s
+}
@@ -0,0 +1,162 @@
+package ashby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// LatestStatus describes whether the latest copy of a plot and of the
+// outputs written alongside it are those of its newest dated plot.
+type LatestStatus struct {
+	Newest string   // path of the newest dated plot, empty if there are none
+	Stale  []string // latest paths that are missing or differ from the newest dated plot
+	paths  []string // dated paths of the newest plot and its outputs, in the order of stale
+}
+
+// CheckLatest finds the newest dated plot and compares it with the latest
+// copy of the plot. The newest plot is the one that IsLatest reports for the
+// period parsed from its path. Outputs such as images are only compared if
+// they exist alongside the newest plot.
+func (o *Organizer) CheckLatest(ctx context.Context, pd *PlotDef) (*LatestStatus, error) {
+	existing, err := o.Glob(ctx, pd, clockOrSystem(o.Clock).Now())
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	status := &LatestStatus{}
+	for _, path := range existing {
+		ts, err := o.PathTime(pd, path)
+		if err != nil {
+			slog.Warn("skipping unrecognized plot path", "path", path, "error", err)
+			continue
+		}
+		latest, err := o.IsLatest(ctx, pd, ts)
+		if err != nil {
+			return nil, fmt.Errorf("is latest: %w", err)
+		}
+		if latest {
+			status.Newest = path
+		}
+	}
+	if status.Newest == "" {
+		return status, nil
+	}
+
+	latestPath, err := o.LatestFilepath(pd)
+	if err != nil {
+		return nil, err
+	}
+	check := func(latest string, path string) error {
+		ok, err := o.latestMatches(ctx, latest, path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			status.Stale = append(status.Stale, latest)
+			status.paths = append(status.paths, path)
+		}
+		return nil
+	}
+	if err := check(latestPath, status.Newest); err != nil {
+		return nil, err
+	}
+	for _, ext := range []string{"png", "svg", "html", "csv", vegaLiteExt} {
+		path := siblingPath(status.Newest, ext)
+		if _, err := o.backend().Stat(ctx, path); err != nil {
+			continue
+		}
+		if err := check(siblingPath(latestPath, ext), path); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// latestMatches reports whether the latest copy is a symlink to the dated
+// file at path or, if it is a copy, has the same content.
+func (o *Organizer) latestMatches(ctx context.Context, latest string, path string) (bool, error) {
+	info, err := o.backend().Stat(ctx, latest)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat latest: %w", err)
+	}
+	if sb, ok := o.backend().(SymlinkBackend); ok && info.Mode()&fs.ModeSymlink != 0 {
+		return symlinkUnchanged(ctx, sb, latest, path), nil
+	}
+
+	data, err := o.backend().Read(ctx, path)
+	if err != nil {
+		return false, fmt.Errorf("read plot: %w", err)
+	}
+	return o.outputUnchanged(ctx, latest, data), nil
+}
+
+// RepairLatest replaces the stale latest paths of the status with the newest
+// dated plot and its outputs, using the organizer's latest mode.
+func (o *Organizer) RepairLatest(ctx context.Context, pd *PlotDef, status *LatestStatus) error {
+	for i, latest := range status.Stale {
+		path := status.paths[i]
+		if o.DryRun {
+			slog.Info("dry run: would repair latest plot", "name", pd.Name, "filename", latest, "newest", path, "mode", o.LatestMode)
+			continue
+		}
+		data, err := o.backend().Read(ctx, path)
+		if err != nil {
+			return fmt.Errorf("read plot: %w", err)
+		}
+		unlock := o.lock(latest)
+		err = o.writeLatest(ctx, latest, path, data)
+		unlock()
+		if err != nil {
+			return fmt.Errorf("write latest: %w", err)
+		}
+	}
+	return nil
+}
+
+// verifyLatest checks the latest copies of the plot and of its dark variant,
+// repairing them if requested.
+func (j *plotJob) verifyLatest(ctx context.Context, pd *PlotDef) (PlotOutcome, error) {
+	logger := LoggerFromContext(ctx)
+	orgs := []*Organizer{j.org}
+	if j.darkOrg != nil {
+		orgs = append(orgs, j.darkOrg)
+	}
+
+	var stale []string
+	outcome := PlotOutcomeVerified
+	for _, org := range orgs {
+		status, err := org.CheckLatest(ctx, pd)
+		if err != nil {
+			return PlotOutcomeFailed, fmt.Errorf("failed to check latest plot: %w", err)
+		}
+		if status.Newest == "" {
+			logger.Info("skipping plot, no dated plots exist")
+			return PlotOutcomeSkipped, nil
+		}
+		if len(status.Stale) == 0 {
+			logger.Debug("latest plot is current", "newest", status.Newest)
+			continue
+		}
+		if !j.opts.Repair {
+			stale = append(stale, status.Stale...)
+			continue
+		}
+		if err := org.RepairLatest(ctx, pd, status); err != nil {
+			return PlotOutcomeFailed, fmt.Errorf("failed to repair latest plot: %w", err)
+		}
+		logger.Info("repaired latest plot", "newest", status.Newest, "filenames", strings.Join(status.Stale, ","))
+		outcome = PlotOutcomeRepaired
+	}
+	if len(stale) > 0 {
+		return PlotOutcomeFailed, fmt.Errorf("latest plot is not the newest dated plot: %s", strings.Join(stale, ", "))
+	}
+	return outcome, nil
+}
@@ -0,0 +1,24 @@
+package ashby
+
+import "runtime/debug"
+
+// modulePath is the path of the module holding the ashby package.
+const modulePath = "github.com/plprobelab/ashby"
+
+// appVersion returns the version of the ashby module the running binary was
+// built with, which is the main module when it is the ashby command.
+func appVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath && dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "(unknown)"
+}
@@ -0,0 +1,144 @@
+package ashby
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
+)
+
+// XRangeDef limits the visible part of a time x axis. It is applied as the
+// range of the axis rather than by removing points so that all the data
+// returned by the queries is still plotted and used by computations such as
+// smoothing, and can be panned to.
+//
+// A relative range gives the length of time shown before its end, which is
+// the start of the period that contains the basis time for plots with a
+// frequency, as used for the window of their queries, and the basis time
+// itself otherwise. An absolute range gives its start and, optionally, its
+// end as RFC3339 times or dates.
+type XRangeDef struct {
+	Last string `yaml:"last"` // length of a relative range, such as 30d, 2w, 3mo or 12h
+	From string `yaml:"from"` // start of an absolute range
+	To   string `yaml:"to"`   // optional end of the range, overriding the end derived from the basis time
+}
+
+// validate checks that the range is complete and its times can be parsed.
+func (r *XRangeDef) validate() error {
+	switch {
+	case r.Last != "" && r.From != "":
+		return fmt.Errorf("xrange may have either last or from, not both")
+	case r.Last == "" && r.From == "":
+		return fmt.Errorf("xrange requires last or from")
+	}
+	if r.Last != "" {
+		if _, err := parseRangeLength(r.Last); err != nil {
+			return fmt.Errorf("invalid xrange length: %w", err)
+		}
+	}
+	for _, s := range []string{r.From, r.To} {
+		if s == "" {
+			continue
+		}
+		if _, _, ok := parseTimeLabel(s); !ok {
+			return fmt.Errorf("xrange time is not an RFC3339 time or date: %q", s)
+		}
+	}
+	return nil
+}
+
+// resolve returns the start and end of the range for a plot generated as of
+// basisTime.
+func (r *XRangeDef) resolve(pd *PlotDef, basisTime time.Time) (time.Time, time.Time, error) {
+	end := basisTime
+	if _, ok := datedLayout(pd.Frequency); ok {
+		end = pd.Frequency.Truncate(basisTime, pd.location, pd.StartOfWeek())
+	}
+	if r.To != "" {
+		t, _, ok := parseTimeLabel(r.To)
+		if !ok {
+			return time.Time{}, time.Time{}, fmt.Errorf("xrange time is not an RFC3339 time or date: %q", r.To)
+		}
+		end = t
+	}
+
+	if r.From != "" {
+		start, _, ok := parseTimeLabel(r.From)
+		if !ok {
+			return time.Time{}, time.Time{}, fmt.Errorf("xrange time is not an RFC3339 time or date: %q", r.From)
+		}
+		return start, end, nil
+	}
+
+	length, err := parseRangeLength(r.Last)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid xrange length: %w", err)
+	}
+	return length.before(end), end, nil
+}
+
+// rangeLength is a length of time made of calendar units and a duration.
+type rangeLength struct {
+	years, months, days int
+	d                   time.Duration
+}
+
+// before returns the time the length of time before t.
+func (l rangeLength) before(t time.Time) time.Time {
+	return t.AddDate(-l.years, -l.months, -l.days).Add(-l.d)
+}
+
+// after returns the time the length of time after t.
+func (l rangeLength) after(t time.Time) time.Time {
+	return t.AddDate(l.years, l.months, l.days).Add(l.d)
+}
+
+// parseRangeLength parses a length of time. Days, weeks, months and years,
+// written with the units d, w, mo and y, are counted in calendar units so that
+// lengths in local time are not shifted by daylight saving. Other durations
+// are those accepted by time.ParseDuration.
+func parseRangeLength(s string) (rangeLength, error) {
+	units := []struct {
+		suffix string
+		length func(int) rangeLength
+	}{
+		{"d", func(v int) rangeLength { return rangeLength{days: v} }},
+		{"w", func(v int) rangeLength { return rangeLength{days: 7 * v} }},
+		{"mo", func(v int) rangeLength { return rangeLength{months: v} }},
+		{"y", func(v int) rangeLength { return rangeLength{years: v} }},
+	}
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v <= 0 {
+				return rangeLength{}, fmt.Errorf("not a positive length of time: %q", s)
+			}
+			return u.length(v), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return rangeLength{}, fmt.Errorf("not a positive length of time: %q", s)
+	}
+	return rangeLength{d: d}, nil
+}
+
+// applyXRange sets the range of the x axis of the figure from the xrange of
+// the plot definition. The axis is copied so that an axis shared with the
+// defaults of other plots is not changed.
+func applyXRange(fig *grob.Fig, pd *PlotDef, basisTime time.Time) error {
+	start, end, err := pd.XRange.resolve(pd, basisTime)
+	if err != nil {
+		return err
+	}
+
+	var axis grob.LayoutXaxis
+	if fig.Layout.Xaxis != nil {
+		axis = *fig.Layout.Xaxis
+	}
+	axis.Range = []string{start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)}
+	fig.Layout.Xaxis = &axis
+	return nil
+}